@@ -14,6 +14,7 @@ import {
   Share2,
   Hash
 } from 'lucide-react';
+import type { MultiUploadResponse } from './api/FileServices';
 import { AuthGuard } from './components/Auth/AuthGuard';
 import { FileUpload } from './components/FileUpload/FileUpload';
 import { SearchFilter, type SearchFilters } from './components/SearchFilter/SearchFilter';
@@ -52,7 +53,7 @@ interface DeduplicationStats {
   savingsPercentage: number;
 }
 
-const BASE_URL = import.meta.env.VITE_API_BASE_URL || "http://localhost:4000";
+const BASE_URL = `${import.meta.env.VITE_API_BASE_URL || "http://localhost:4000"}/v1`;
 
 function App() {
   const { user } = useUser();
@@ -132,7 +133,7 @@ function App() {
           uploadDate: f.uploadDate,
           uploader: username,
           downloadCount: f.downloadCount || 0,
-          isPublic: false,
+          isPublic: f.isPublic ?? false,
           isDeduplicated: f.refCount > 1,  // ✅ backend refCount decides
           hash: f.hash,
           refCount: f.refCount || 1,
@@ -161,49 +162,62 @@ function App() {
       setIsLoading(true);
 
       try {
+        // One request for the whole selection; username goes first so the
+        // server knows the owner before it reads any file
+        const formData = new FormData();
+        formData.append("username", user.primaryEmailAddress?.emailAddress || user.id);
         for (let i = 0; i < fileList.length; i++) {
-          const file = fileList[i];
+          formData.append("file", fileList[i]);
+        }
+
+        const res = await fetch(`${BASE_URL}/uploads`, {
+          method: "POST",
+          body: formData,
+        });
 
-          const formData = new FormData();
-          formData.append("file", file);
-          formData.append("username", user.primaryEmailAddress?.emailAddress || user.id);
+        if (!res.ok) {
+          addNotification("❌ Upload failed", "error");
+          setIsLoading(false);
+          return;
+        }
 
-          const res = await fetch(`${BASE_URL}/upload`, {
-            method: "POST",
-            body: formData,
-          });
+        const data: MultiUploadResponse = await res.json();
 
-          if (!res.ok) {
-            addNotification(`❌ Failed to upload ${file.name}`, "error");
-            continue;
+        data.results.forEach((result, i) => {
+          if (result.status === "rejected" || !result.file) {
+            addNotification(`❌ Failed to upload ${result.fileName}: ${result.reason}`, "error");
+            return;
           }
-
-          const data = await res.json();
+          const f = result.file;
 
           const uploadedFile: FileItem = {
-            id: Date.now() + i,
-            name: data.fileName,
-            size: data.size,
-            mimeType: data.mimeType,
+            id: f.id || Date.now() + i,
+            name: f.fileName,
+            size: f.size,
+            mimeType: f.mimeType,
             uploadDate: new Date().toISOString(),
             uploader: user.primaryEmailAddress?.emailAddress || "unknown",
             downloadCount: 0,
             isPublic: false,
-            isDeduplicated: data.duplicate || false, // ✅ from backend
-            hash: data.hash,
-            refCount: data.refCount || 1,
-            savings: data.duplicate ? data.size : 0,
-            s3Key: data.s3Key || data.key,
+            isDeduplicated: f.duplicate, // ✅ from backend
+            hash: f.hash,
+            refCount: 1,
+            savings: f.duplicate ? f.size : 0,
+            s3Key: f.s3Key,
           };
 
           setFiles((prev) => [...prev, uploadedFile]);
 
           addNotification(
             uploadedFile.isDeduplicated
-              ? `⚠️ Duplicate skipped: ${file.name}`
-              : `✅ Uploaded: ${file.name}`,
+              ? `⚠️ Duplicate skipped: ${f.fileName}`
+              : `✅ Uploaded: ${f.fileName}`,
             uploadedFile.isDeduplicated ? "info" : "success"
           );
+        });
+
+        if (!data.complete) {
+          addNotification("⚠️ Upload size limit reached; remaining files were not stored", "error");
         }
       } catch (error) {
         console.error("Upload failed:", error);
@@ -1,15 +1,110 @@
-const BASE_URL = import.meta.env.VITE_API_BASE_URL || "http://localhost:4000";
+// The server also answers at the unversioned paths, but those are deprecated.
+const BASE_URL = `${import.meta.env.VITE_API_BASE_URL || "http://localhost:4000"}/v1`;
+
+// Types mirror the server's OpenAPI document (GET /openapi.json).
+
+export type ScanStatus = "pending" | "clean" | "infected" | "error";
 
 export interface FileResponse {
+  id: number;
+  fileName: string;
+  size: number;
+  mimeType: string;
+  uploadDate: string;
+  hash: string;
+  s3Key: string;
+  refCount: number;
+  scanStatus: ScanStatus;
+  thumbnailStatus: "none" | "pending" | "ready" | "failed";
+  folder: string;
+  tags: string[];
+  isPublic: boolean;
+  trashedAt?: string; // only in the trash listing
+}
+
+export interface UploadResponse {
+  message: string;
+  id: number;
+  fileName: string;
+  size: number;
+  mimeType: string;
+  s3Key: string;
+  hash: string;
+  duplicate: boolean;
+  scanStatus: ScanStatus;
+}
+
+export interface UploadResult {
+  fileName: string;
+  status: "stored" | "duplicate" | "rejected";
+  code?: string;
+  reason?: string;
+  file?: UploadResponse;
+}
+
+// POST /uploads: 200 when no file was rejected, 207 otherwise
+export interface MultiUploadResponse {
+  stored: number;
+  duplicates: number;
+  rejected: number;
+  complete: boolean; // false when the size cap stopped the upload
+  results: UploadResult[];
+}
+
+// Every error response has this body; code is stable, message is for people.
+export interface ErrorResponse {
+  error: { code: string; message: string; requestId?: string };
+}
+
+export class ApiError extends Error {
+  constructor(public status: number, public code: string, message: string, public requestId?: string) {
+    super(message);
+  }
+}
+
+async function apiError(res: Response, fallback: string): Promise<ApiError> {
+  try {
+    const body: ErrorResponse = await res.json();
+    return new ApiError(res.status, body.error.code, body.error.message || fallback, body.error.requestId);
+  } catch {
+    return new ApiError(res.status, "internal", fallback);
+  }
+}
+
+export type BulkOperation = "delete" | "restore" | "move" | "tag" | "share";
+
+export interface BulkRequest {
+  operation: BulkOperation;
+  fileIds: number[];
+  atomic?: boolean; // all or nothing: one failing file fails with 409
+  permanent?: boolean; // delete: skip the trash
+  folder?: string; // move
+  addTags?: string[]; // tag
+  removeTags?: string[]; // tag
+  public?: boolean; // share
+}
+
+// POST /files/bulk: 200 when every file succeeded, 207 otherwise
+export interface BulkResponse {
+  operation: BulkOperation;
+  committed: boolean;
+  succeeded: number;
+  failed: number;
+  results: { fileId: number; status: "ok" | "failed"; code?: string; reason?: string }[];
+}
+
+export interface SearchResult {
+  id: number;
   fileName: string;
   size: number;
   mimeType: string;
-  key: string;
-  uploader: string;
   uploadDate: string;
+  s3Key: string;
+  rank: number;
+  snippet: string; // HTML-escaped, matches wrapped in <mark>
 }
 
-export async function uploadFile(file: File, username: string): Promise<FileResponse> {
+export async function uploadFile(file: File, username: string): Promise<UploadResponse> {
   const formData = new FormData();
   formData.append("file", file);
   formData.append("username", username);
@@ -19,13 +114,37 @@ export async function uploadFile(file: File, username: string): Promise<FileResp
     body: formData,
   });
 
-  if (!res.ok) throw new Error("Upload failed");
+  if (!res.ok) throw await apiError(res, "Upload failed");
+  return res.json();
+}
+
+export async function uploadFiles(files: File[], username: string): Promise<MultiUploadResponse> {
+  const formData = new FormData();
+  formData.append("username", username); // must precede the files
+  files.forEach((file) => formData.append("file", file));
+
+  const res = await fetch(`${BASE_URL}/uploads`, {
+    method: "POST",
+    body: formData,
+  });
+
+  if (!res.ok) throw await apiError(res, "Upload failed");
   return res.json();
 }
 
-export async function listFiles(username: string): Promise<FileResponse[]> {
-  const res = await fetch(`${BASE_URL}/files?username=${username}`);
-  if (!res.ok) throw new Error("Failed to fetch files");
+export async function listFiles(username: string, trash = false): Promise<FileResponse[]> {
+  const res = await fetch(`${BASE_URL}/files?username=${username}${trash ? "&trash=true" : ""}`);
+  if (!res.ok) throw await apiError(res, "Failed to fetch files");
+  return res.json();
+}
+
+export async function bulkFiles(username: string, req: BulkRequest): Promise<BulkResponse> {
+  const res = await fetch(`${BASE_URL}/files/bulk`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ username, ...req }),
+  });
+  if (!res.ok) throw await apiError(res, "Bulk operation failed");
   return res.json();
 }
 
@@ -33,9 +152,28 @@ export async function deleteFile(username: string, key: string): Promise<void> {
   const res = await fetch(`${BASE_URL}/delete?username=${username}&key=${key}`, {
     method: "DELETE",
   });
-  if (!res.ok) throw new Error("Delete failed");
+  if (!res.ok) throw await apiError(res, "Delete failed");
 }
 
 export function getDownloadUrl(username: string, key: string): string {
   return `${BASE_URL}/download?username=${username}&key=${key}`;
 }
+
+export function getPreviewUrl(username: string, key: string): string {
+  return `${getDownloadUrl(username, key)}&disposition=inline`;
+}
+
+export function getThumbnailUrl(
+  username: string,
+  fileId: number,
+  size: "small" | "medium" | "large" = "medium"
+): string {
+  return `${BASE_URL}/files/${fileId}/thumbnail?username=${username}&size=${size}`;
+}
+
+export async function searchFiles(username: string, query: string, limit = 20, offset = 0): Promise<SearchResult[]> {
+  const params = new URLSearchParams({ username, q: query, limit: String(limit), offset: String(offset) });
+  const res = await fetch(`${BASE_URL}/search?${params}`);
+  if (!res.ok) throw await apiError(res, "Search failed");
+  return res.json();
+}
@@ -24,7 +24,7 @@ interface SystemStats {
   deduplicationSavings: number;
 }
 
-const BASE_URL = import.meta.env.VITE_API_BASE_URL || "http://localhost:4000";
+const BASE_URL = `${import.meta.env.VITE_API_BASE_URL || "http://localhost:4000"}/v1`;
 
 const COLORS = ["#3B82F6", "#10B981", "#F59E0B", "#8B5CF6"];
 
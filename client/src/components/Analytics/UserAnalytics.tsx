@@ -16,7 +16,7 @@ interface UserStats {
   deduplicationSavings: number;
 }
 
-const BASE_URL = import.meta.env.VITE_API_BASE_URL || "http://localhost:4000";
+const BASE_URL = `${import.meta.env.VITE_API_BASE_URL || "http://localhost:4000"}/v1`;
 
 const COLORS = ["#3B82F6", "#10B981", "#F59E0B", "#EF4444", "#8B5CF6", "#06B6D4"];
 
@@ -20,7 +20,7 @@ interface DeduplicationGroup {
   savedSpace: number;
 }
 
-const BASE_URL = import.meta.env.VITE_API_BASE_URL || "http://localhost:4000";
+const BASE_URL = `${import.meta.env.VITE_API_BASE_URL || "http://localhost:4000"}/v1`;
 
 export const DeduplicationManager: React.FC<{ userEmail: string }> = ({ userEmail }) => {
   const [files, setFiles] = useState<FileItem[]>([]);
@@ -0,0 +1,125 @@
+package apiversion
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//
+// 🔹 API versions: one subrouter per version
+//
+// Each version is mounted under its own prefix (/v1, /v2, ...) and gets its
+// own middleware, so a version can change its contract, or how requests are
+// checked, without touching the others. The unversioned paths from before
+// versioning are kept as a deprecated alias of one version.
+//
+
+// Header names the version that served a response.
+const Header = "API-Version"
+
+// Version is one version of the HTTP API.
+type Version struct {
+	Name       string               // path prefix without the slash: "v1"
+	Routes     func(r *mux.Router)  // registers the version's routes on its subrouter
+	Middleware []mux.MiddlewareFunc // runs after the router-wide middleware, for this version only
+}
+
+// Mount registers v under /<name> on r and returns its subrouter.
+func Mount(r *mux.Router, v Version) *mux.Router {
+	sub := r.PathPrefix("/" + v.Name).Subrouter()
+	sub.Use(Tag(v.Name))
+	sub.Use(v.Middleware...)
+	v.Routes(sub)
+	sub.NotFoundHandler = fallback(sub, r)
+	return sub
+}
+
+// fallback answers requests under a version prefix that no route matched,
+// with r's NotFound or MethodNotAllowed handler. mux cannot tell the two
+// apart inside a PathPrefix subrouter: the prefix matcher of every later
+// route clears the method mismatch.
+func fallback(sub, r *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if otherMethodMatches(sub, req) {
+			if r.MethodNotAllowedHandler != nil {
+				r.MethodNotAllowedHandler.ServeHTTP(w, req)
+				return
+			}
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.NotFoundHandler != nil {
+			r.NotFoundHandler.ServeHTTP(w, req)
+			return
+		}
+		http.NotFound(w, req)
+	})
+}
+
+// otherMethodMatches reports whether a route of sub would match req with
+// some other method.
+func otherMethodMatches(sub *mux.Router, req *http.Request) bool {
+	found := false
+	_ = sub.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if found || err != nil {
+			return nil
+		}
+		for _, m := range methods {
+			try := req.Clone(req.Context())
+			try.Method = m
+			if route.Match(try, &mux.RouteMatch{}) {
+				found = true
+				break
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// Legacy is the deprecation announced on unversioned routes.
+type Legacy struct {
+	Since  time.Time // when the unversioned routes were deprecated
+	Sunset time.Time // when they will be removed; zero if not decided
+}
+
+// MountLegacy registers v's routes at the root of r, as they were before
+// versioning, with its middleware and the Deprecation and Sunset headers
+// (RFC 9745, RFC 8594). Register it after every versioned route.
+func MountLegacy(r *mux.Router, v Version, l Legacy) *mux.Router {
+	sub := r.NewRoute().Subrouter()
+	sub.Use(Tag(v.Name), Deprecated(v.Name, l))
+	sub.Use(v.Middleware...)
+	v.Routes(sub)
+	return sub
+}
+
+// Tag sets the API-Version response header.
+func Tag(name string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(Header, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Deprecated marks responses as deprecated and links the same path under
+// the successor version.
+func Deprecated(successor string, l Legacy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Deprecation", fmt.Sprintf("@%d", l.Since.Unix()))
+			if !l.Sunset.IsZero() {
+				h.Set("Sunset", l.Sunset.UTC().Format(http.TimeFormat))
+			}
+			h.Add("Link", fmt.Sprintf(`</%s%s>; rel="successor-version"`, successor, r.URL.EscapedPath()))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// 🔹 Config: every setting the server reads, in one place
+//
+// Each field names its environment variable (env), its default and a help
+// line; flags are derived from the variable name (DB_URL → -db-url).
+// Fields tagged secret are masked by Redacted. Per-plan upload type lists
+// have no fixed variable: Load collects them from UPLOAD_TYPES_<PLAN>_*.
+// The OTEL_* variables are read by the OpenTelemetry SDK.
+//
+type Config struct {
+	Server   Server   `yaml:"server" toml:"server"`
+	Database Database `yaml:"database" toml:"database"`
+	Storage  Storage  `yaml:"storage" toml:"storage"`
+	Uploads  Uploads  `yaml:"uploads" toml:"uploads"`
+	Scanner  Scanner  `yaml:"scanner" toml:"scanner"`
+	Jobs     Jobs     `yaml:"jobs" toml:"jobs"`
+	Webhooks Webhooks `yaml:"webhooks" toml:"webhooks"`
+	Metrics  Metrics  `yaml:"metrics" toml:"metrics"`
+	Log      Log      `yaml:"log" toml:"log"`
+}
+
+type Server struct {
+	Mode             string        `yaml:"mode" toml:"mode" env:"RUN_MODE" default:"lambda" help:"lambda, http or worker"`
+	Port             int           `yaml:"port" toml:"port" env:"PORT" default:"8080" help:"listen port in http mode"`
+	ReadyMaxQueueLag time.Duration `yaml:"readyMaxQueueLag" toml:"readyMaxQueueLag" env:"READY_MAX_QUEUE_LAG" default:"15m" help:"job queue lag at which /readyz reports degraded"`
+	OpenAPIValidate  bool          `yaml:"openapiValidate" toml:"openapiValidate" env:"OPENAPI_VALIDATE" help:"log JSON responses that do not match /openapi.json (development and staging)"`
+	LegacyRoutes     bool          `yaml:"legacyRoutes" toml:"legacyRoutes" env:"LEGACY_ROUTES" default:"true" help:"also serve v1 at the unversioned paths, with Deprecation headers"`
+	LegacySunset     string        `yaml:"legacySunset" toml:"legacySunset" env:"LEGACY_SUNSET" default:"2027-04-30" help:"date (YYYY-MM-DD) announced in the Sunset header of unversioned routes; empty sends none"`
+	ClientOrigin     string        `yaml:"clientOrigin" toml:"clientOrigin" env:"CLIENT_ORIGIN" help:"web client origin (https://app.example.com) allowed to frame inline previews besides this server"`
+}
+
+type Database struct {
+	URL      string `yaml:"url" toml:"url" env:"DB_URL" secret:"true" help:"full Postgres DSN; overrides the individual DB_* settings"`
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST"`
+	Port     int    `yaml:"port" toml:"port" env:"DB_PORT" default:"5432"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" toml:"name" env:"DB_NAME"`
+	SSLMode  string `yaml:"sslMode" toml:"sslMode" env:"DB_SSLMODE" default:"require" help:"disable, allow, prefer, require, verify-ca or verify-full; not applied to DB_URL"`
+
+	MaxConns         int           `yaml:"maxConns" toml:"maxConns" env:"DB_MAX_CONNS" help:"pool size per process; 0 picks 2 under Lambda and 10 elsewhere"`
+	MinConns         int           `yaml:"minConns" toml:"minConns" env:"DB_MIN_CONNS" help:"connections kept open while idle"`
+	MaxConnLifetime  time.Duration `yaml:"maxConnLifetime" toml:"maxConnLifetime" env:"DB_MAX_CONN_LIFETIME" default:"1h" help:"0 keeps the pgx default (1h)"`
+	MaxConnIdleTime  time.Duration `yaml:"maxConnIdleTime" toml:"maxConnIdleTime" env:"DB_MAX_CONN_IDLE_TIME" default:"5m" help:"0 keeps the pgx default (30m)"`
+	ConnectTimeout   time.Duration `yaml:"connectTimeout" toml:"connectTimeout" env:"DB_CONNECT_TIMEOUT" default:"5s"`
+	StatementTimeout time.Duration `yaml:"statementTimeout" toml:"statementTimeout" env:"DB_STATEMENT_TIMEOUT" help:"server-side limit per statement; 0 disables it"`
+	ApplicationName  string        `yaml:"applicationName" toml:"applicationName" env:"DB_APPLICATION_NAME" default:"skyvault" help:"shown in pg_stat_activity"`
+
+	ReplicaURL string `yaml:"replicaURL" toml:"replicaURL" env:"DB_REPLICA_URL" secret:"true" help:"read replica DSN for analytics and listings; empty sends all reads to the primary"`
+}
+
+type Storage struct {
+	Bucket string `yaml:"bucket" toml:"bucket" env:"S3_BUCKET,S3_BUCKET_NAME" help:"S3 bucket holding file content"`
+	Region string `yaml:"region" toml:"region" env:"AWS_REGION"`
+}
+
+type Uploads struct {
+	MaxStorageMB   int64  `yaml:"maxStorageMB" toml:"maxStorageMB" env:"MAX_STORAGE_MB" help:"per-user quota; 0 disables it"`
+	QuotaBasis     string `yaml:"quotaBasis" toml:"quotaBasis" env:"QUOTA_BASIS" default:"logical" help:"logical or physical"`
+	BillingBasis   string `yaml:"billingBasis" toml:"billingBasis" env:"BILLING_BASIS" default:"logical" help:"logical or physical"`
+	DedupMode      string `yaml:"dedupMode" toml:"dedupMode" env:"DEDUP_MODE" default:"file" help:"file or chunk"`
+	RejectMismatch bool   `yaml:"rejectMismatch" toml:"rejectMismatch" env:"UPLOAD_REJECT_MISMATCH" default:"true" help:"reject uploads whose content contradicts their Content-Type"`
+	UsageTimezone  string `yaml:"usageTimezone" toml:"usageTimezone" env:"USAGE_TIMEZONE" default:"UTC" help:"timezone whose calendar months bound monthly usage"`
+	MaxRequestMB   int64  `yaml:"maxRequestMB" toml:"maxRequestMB" env:"UPLOAD_MAX_REQUEST_MB" default:"100" help:"total size of the files in one multi-file upload"`
+	MaxFiles       int    `yaml:"maxFiles" toml:"maxFiles" env:"UPLOAD_MAX_FILES" default:"50" help:"files accepted in one multi-file upload"`
+
+	// Types holds the allow/deny lists per plan (UPLOAD_TYPES_<PLAN>_ALLOW
+	// and _DENY), keyed by PlanKey. The "default" entry backs plans without
+	// a list of their own.
+	Types map[string]TypeLists `yaml:"types" toml:"types"`
+}
+
+// TypeLists are media types (exact or major/*) for one plan. A nil list is
+// not configured; an empty one is, and overrides the default.
+type TypeLists struct {
+	Allow []string `yaml:"allow" toml:"allow"`
+	Deny  []string `yaml:"deny" toml:"deny"`
+}
+
+// PlanKey is how a plan name appears in Types and in UPLOAD_TYPES_<PLAN>_*
+// (pro-plus → pro_plus).
+func PlanKey(plan string) string {
+	return strings.ToLower(strings.ReplaceAll(plan, "-", "_"))
+}
+
+// TypeLists returns the lists for plan, each falling back to the default
+// entry when the plan does not configure it.
+func (u Uploads) TypeLists(plan string) TypeLists {
+	own, def := u.Types[PlanKey(plan)], u.Types["default"]
+	if own.Allow == nil {
+		own.Allow = def.Allow
+	}
+	if own.Deny == nil {
+		own.Deny = def.Deny
+	}
+	return own
+}
+
+type Scanner struct {
+	Engine    string `yaml:"engine" toml:"engine" env:"SCANNER" default:"none" help:"none, fake or clamd"`
+	ClamdAddr string `yaml:"clamdAddr" toml:"clamdAddr" env:"CLAMD_ADDR" help:"clamd host:port or unix socket path"`
+}
+
+type Jobs struct {
+	WorkerConcurrency int `yaml:"workerConcurrency" toml:"workerConcurrency" env:"WORKER_CONCURRENCY" default:"4"`
+	RetentionDays     int `yaml:"retentionDays" toml:"retentionDays" env:"JOBS_RETENTION_DAYS" default:"7"`
+	DeadRetentionDays int `yaml:"deadRetentionDays" toml:"deadRetentionDays" env:"JOBS_DEAD_RETENTION_DAYS" default:"30"`
+}
+
+type Webhooks struct {
+	AllowPrivate  bool `yaml:"allowPrivate" toml:"allowPrivate" env:"WEBHOOK_ALLOW_PRIVATE" help:"allow deliveries to private addresses (local testing)"`
+	RetentionDays int  `yaml:"retentionDays" toml:"retentionDays" env:"WEBHOOK_RETENTION_DAYS" default:"30"`
+}
+
+type Metrics struct {
+	PushgatewayURL string `yaml:"pushgatewayURL" toml:"pushgatewayURL" env:"PROMETHEUS_PUSHGATEWAY_URL" secret:"true" help:"push metrics here after Lambda invocations"`
+	Addr           string `yaml:"addr" toml:"addr" env:"METRICS_ADDR" help:"worker listener for /metrics and probes"`
+}
+
+type Log struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" default:"info" help:"debug, info, warn or error"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" default:"json" help:"json or text"`
+	Redact bool   `yaml:"redact" toml:"redact" env:"LOG_REDACT" default:"true" help:"mask emails and storage keys in logs"`
+}
+
+var (
+	current   *Config
+	currentMu sync.RWMutex
+)
+
+// Set makes c the configuration returned by Get.
+func Set(c *Config) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = c
+}
+
+// Get returns the configuration installed by Set. Before that (tools, one-off
+// scripts) it falls back to defaults and the environment, unvalidated.
+func Get() *Config {
+	currentMu.RLock()
+	c := current
+	currentMu.RUnlock()
+	if c != nil {
+		return c
+	}
+
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if current == nil {
+		c, err := Load(nil)
+		if err != nil {
+			c = Defaults()
+		}
+		current = c
+	}
+	return current
+}
+
+//
+// 🔹 Validate: reject settings the server cannot start with
+//
+// Every problem is reported at once rather than one per restart.
+//
+func (c *Config) Validate() error {
+	var errs []error
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	oneOf := func(name, v string, allowed ...string) {
+		for _, a := range allowed {
+			if v == a {
+				return
+			}
+		}
+		bad("%s must be one of %s, got %q", name, strings.Join(allowed, ", "), v)
+	}
+
+	oneOf("RUN_MODE", c.Server.Mode, "lambda", "http", "worker")
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		bad("PORT must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if c.Server.ReadyMaxQueueLag <= 0 {
+		bad("READY_MAX_QUEUE_LAG must be positive")
+	}
+	if c.Server.LegacySunset != "" {
+		if _, err := time.Parse(time.DateOnly, c.Server.LegacySunset); err != nil {
+			bad("LEGACY_SUNSET must be a date like 2027-04-30, got %q", c.Server.LegacySunset)
+		}
+	}
+	if c.Server.ClientOrigin != "" {
+		if u, err := url.Parse(c.Server.ClientOrigin); err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+			bad("CLIENT_ORIGIN must be an origin like https://app.example.com, got %q", c.Server.ClientOrigin)
+		}
+	}
+
+	if c.Database.URL != "" {
+		if u, err := url.Parse(c.Database.URL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			bad("DB_URL must be a postgres:// or postgresql:// URL")
+		}
+	} else {
+		for _, f := range []struct{ name, v string }{
+			{"DB_HOST", c.Database.Host}, {"DB_USER", c.Database.User}, {"DB_NAME", c.Database.Name},
+		} {
+			if f.v == "" {
+				bad("%s is required when DB_URL is not set", f.name)
+			}
+		}
+		if c.Database.Port < 1 || c.Database.Port > 65535 {
+			bad("DB_PORT must be between 1 and 65535, got %d", c.Database.Port)
+		}
+		oneOf("DB_SSLMODE", c.Database.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	}
+	if c.Database.ReplicaURL != "" {
+		if u, err := url.Parse(c.Database.ReplicaURL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			bad("DB_REPLICA_URL must be a postgres:// or postgresql:// URL")
+		}
+	}
+	if c.Database.MaxConns < 0 || c.Database.MinConns < 0 {
+		bad("DB_MAX_CONNS and DB_MIN_CONNS must not be negative")
+	}
+	if c.Database.MaxConns > 0 && c.Database.MinConns > c.Database.MaxConns {
+		bad("DB_MIN_CONNS (%d) exceeds DB_MAX_CONNS (%d)", c.Database.MinConns, c.Database.MaxConns)
+	}
+	if c.Database.ConnectTimeout <= 0 {
+		bad("DB_CONNECT_TIMEOUT must be positive")
+	}
+	if c.Database.StatementTimeout < 0 || c.Database.MaxConnLifetime < 0 || c.Database.MaxConnIdleTime < 0 {
+		bad("database timeouts must not be negative")
+	}
+
+	if c.Storage.Bucket == "" {
+		bad("S3_BUCKET is required")
+	}
+	if c.Storage.Region == "" {
+		bad("AWS_REGION is required")
+	}
+
+	if c.Uploads.MaxStorageMB < 0 {
+		bad("MAX_STORAGE_MB must not be negative")
+	}
+	oneOf("QUOTA_BASIS", c.Uploads.QuotaBasis, "logical", "physical")
+	oneOf("BILLING_BASIS", c.Uploads.BillingBasis, "logical", "physical")
+	oneOf("DEDUP_MODE", c.Uploads.DedupMode, "file", "chunk")
+	if _, err := time.LoadLocation(c.Uploads.UsageTimezone); err != nil {
+		bad("USAGE_TIMEZONE: %v", err)
+	}
+	if c.Uploads.MaxRequestMB < 1 || c.Uploads.MaxFiles < 1 {
+		bad("UPLOAD_MAX_REQUEST_MB and UPLOAD_MAX_FILES must be positive")
+	}
+
+	oneOf("SCANNER", c.Scanner.Engine, "none", "fake", "clamd")
+	if c.Scanner.Engine == "clamd" && c.Scanner.ClamdAddr == "" {
+		bad("SCANNER=clamd requires CLAMD_ADDR")
+	}
+
+	if c.Jobs.WorkerConcurrency < 1 {
+		bad("WORKER_CONCURRENCY must be at least 1")
+	}
+	if c.Jobs.RetentionDays < 1 || c.Jobs.DeadRetentionDays < 1 || c.Webhooks.RetentionDays < 1 {
+		bad("retention periods must be at least 1 day")
+	}
+
+	oneOf("LOG_LEVEL", strings.ToLower(c.Log.Level), "debug", "info", "warn", "error")
+	oneOf("LOG_FORMAT", strings.ToLower(c.Log.Format), "json", "text")
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,323 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+//
+// 🔹 Load: defaults < config file < environment < flags
+//
+// The file comes from -config or CONFIG_FILE and is YAML (.yaml/.yml) or
+// TOML (.toml); unknown keys are an error so typos do not go unnoticed.
+// Load does not validate: call Validate on the result.
+//
+func Load(args []string) (*Config, error) {
+	c := Defaults()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file (env CONFIG_FILE)")
+	var flagged []func() error
+	eachField(c, func(f field) {
+		name := strings.ToLower(strings.ReplaceAll(f.env[0], "_", "-"))
+		usage := f.help
+		if usage == "" {
+			usage = f.env[0]
+		} else {
+			usage += " (env " + f.env[0] + ")"
+		}
+		fs.Func(name, usage, func(v string) error {
+			// Applied after the file and environment, once parsing is done.
+			flagged = append(flagged, func() error { return f.set(v) })
+			return nil
+		})
+	})
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if *path != "" {
+		if err := loadFile(c, *path); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []string
+	eachField(c, func(f field) {
+		// The first non-empty variable wins. A variable set to "" clears a
+		// text setting but is a mistake for anything that must parse.
+		emptyName := ""
+		for _, name := range f.env {
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if v == "" {
+				if emptyName == "" {
+					emptyName = name
+				}
+				continue
+			}
+			if err := f.set(v); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			}
+			return
+		}
+		if emptyName == "" {
+			return
+		}
+		if f.v.Kind() == reflect.String {
+			f.v.SetString("")
+		} else {
+			errs = append(errs, fmt.Sprintf("%s is set but empty; unset it or give a value", emptyName))
+		}
+	})
+	errs = append(errs, loadTypeLists(c)...)
+	for _, apply := range flagged {
+		if err := apply(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %s", strings.Join(errs, "; "))
+	}
+	return c, nil
+}
+
+// loadTypeLists reads UPLOAD_TYPES_<PLAN>_ALLOW / _DENY into
+// c.Uploads.Types, over any lists from the config file. A variable set to
+// "" configures an empty list. Lists are lowercased and trimmed.
+func loadTypeLists(c *Config) []string {
+	types := map[string]TypeLists{}
+	for plan, l := range c.Uploads.Types {
+		types[PlanKey(plan)] = TypeLists{Allow: normalizeTypes(l.Allow), Deny: normalizeTypes(l.Deny)}
+	}
+	var errs []string
+	for _, kv := range os.Environ() {
+		name, v, _ := strings.Cut(kv, "=")
+		rest, ok := strings.CutPrefix(name, "UPLOAD_TYPES_")
+		if !ok {
+			continue
+		}
+		list := splitTypes(v)
+		if plan, ok := strings.CutSuffix(rest, "_ALLOW"); ok && plan != "" {
+			l := types[PlanKey(plan)]
+			l.Allow = list
+			types[PlanKey(plan)] = l
+		} else if plan, ok := strings.CutSuffix(rest, "_DENY"); ok && plan != "" {
+			l := types[PlanKey(plan)]
+			l.Deny = list
+			types[PlanKey(plan)] = l
+		} else {
+			errs = append(errs, fmt.Sprintf("%s: want UPLOAD_TYPES_<PLAN>_ALLOW or _DENY", name))
+		}
+	}
+	c.Uploads.Types = types
+	return errs
+}
+
+func splitTypes(v string) []string {
+	return normalizeTypes(strings.Split(v, ","))
+}
+
+// normalizeTypes lowercases and trims each type and drops empty ones. The
+// result is never nil, so a configured empty list stays configured.
+func normalizeTypes(types []string) []string {
+	if types == nil {
+		return nil
+	}
+	out := []string{}
+	for _, t := range types {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Defaults returns a Config holding only the default tag values.
+func Defaults() *Config {
+	c := &Config{}
+	eachField(c, func(f field) {
+		if f.def != "" {
+			if err := f.set(f.def); err != nil {
+				panic(fmt.Sprintf("config: bad default for %s: %v", f.env[0], err))
+			}
+		}
+	})
+	return c
+}
+
+func loadFile(c *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && err != io.EOF {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parse %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file %s: want .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+//
+// 🔹 Redaction
+//
+const redactedValue = "********"
+
+// Redacted returns a copy with secrets masked. A URL keeps everything but
+// its password and credential-like query parameters (password=, token=, …),
+// so the host and database can still be checked.
+func (c *Config) Redacted() *Config {
+	r := *c
+	eachField(&r, func(f field) {
+		if !f.secret || f.v.String() == "" {
+			return
+		}
+		if u, err := url.Parse(f.v.String()); err == nil && u.Host != "" {
+			f.v.SetString(redactURL(u))
+			return
+		}
+		f.v.SetString(redactedValue)
+	})
+	return &r
+}
+
+// redactURL masks the password and any query parameter whose name suggests
+// a credential, the way url.URL.Redacted masks a password.
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	masked := false
+	for name := range q {
+		lower := strings.ToLower(name)
+		for _, hint := range []string{"pass", "secret", "token", "key", "auth", "signature"} {
+			if strings.Contains(lower, hint) {
+				q[name] = []string{"xxxxx"}
+				masked = true
+				break
+			}
+		}
+	}
+	if masked {
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
+
+// String renders the redacted configuration as YAML, so printing a Config
+// never leaks a secret.
+func (c *Config) String() string {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return "config: " + err.Error()
+	}
+	return string(out)
+}
+
+// DSN is the Postgres connection string: DB_URL as given, or one assembled
+// from the DB_* settings and DB_SSLMODE.
+func (d Database) DSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     fmt.Sprintf("%s:%d", d.Host, d.Port),
+		Path:     "/" + d.Name,
+		RawQuery: url.Values{"sslmode": {d.SSLMode}, "search_path": {"public"}}.Encode(),
+	}
+	return u.String()
+}
+
+//
+// 🔹 Reflection over the tagged fields
+//
+type field struct {
+	v      reflect.Value
+	env    []string
+	def    string
+	help   string
+	secret bool
+}
+
+func eachField(c *Config, fn func(field)) {
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		st := section.Type()
+		for j := 0; j < st.NumField(); j++ {
+			tag := st.Field(j).Tag
+			if tag.Get("env") == "" {
+				continue
+			}
+			fn(field{
+				v:      section.Field(j),
+				env:    strings.Split(tag.Get("env"), ","),
+				def:    tag.Get("default"),
+				help:   tag.Get("help"),
+				secret: tag.Get("secret") == "true",
+			})
+		}
+	}
+}
+
+func (f field) set(s string) error {
+	switch f.v.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.v.SetInt(int64(d))
+		return nil
+	}
+	switch f.v.Kind() {
+	case reflect.String:
+		f.v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("want true or false, got %q", s)
+		}
+		f.v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("want an integer, got %q", s)
+		}
+		f.v.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.v.Type())
+	}
+	return nil
+}
@@ -1,64 +1,164 @@
 package db
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
-	"time"
+	"strconv"
+	"strings"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"server/config"
+	"server/tracing"
 )
 
+// DB is the primary pool: every write, and every read that must see them.
 var DB *pgxpool.Pool
 
-func Connect() error {
-	dsn := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=require&search_path=public",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		getEnv("DB_PORT", "5432"),
-		os.Getenv("DB_NAME"),
-	)
+// Replica is the read-replica pool, or nil when DB_REPLICA_URL is not set.
+// Use Reader rather than reading it directly.
+var Replica *pgxpool.Pool
 
+func Connect(c config.Database) error {
+	var err error
+	DB, err = open(c, c.DSN(), false)
+	if err != nil {
+		return err
+	}
+	if c.ReplicaURL == "" {
+		return nil
+	}
 
+	Replica, err = open(c, c.ReplicaURL, true)
+	if err != nil {
+		DB.Close()
+		return fmt.Errorf("replica: %w", err)
+	}
+	return nil
+}
 
-	cfg, err := pgxpool.ParseConfig(dsn)
+// Reader returns the pool for queries that tolerate replication lag
+// (analytics, listings): the replica when one is configured, else the
+// primary.
+func Reader() *pgxpool.Pool {
+	if Replica != nil {
+		return Replica
+	}
+	return DB
+}
+
+func open(c config.Database, dsn string, readOnly bool) (*pgxpool.Pool, error) {
+	cfg, err := poolConfig(c, dsn, readOnly)
 	if err != nil {
-		return fmt.Errorf("failed to parse config: %w", err)
+		return nil, err
 	}
 
-	// Pool settings
-	cfg.MaxConns = 10
-	cfg.MinConns = 2
-	cfg.MaxConnLifetime = time.Hour
+	// 🔭 One span per SQL statement
+	cfg.ConnConfig.Tracer = tracing.QueryTracer{}
 
-	DB, err = pgxpool.NewWithConfig(context.Background(), cfg)
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create pool: %w", err)
+		return nil, fmt.Errorf("failed to create pool: %w", err)
 	}
 
 	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(cfg.ConnConfig.ConnectTimeout, c.ConnectTimeout))
 	defer cancel()
-	if err := DB.Ping(ctx); err != nil {
-		return fmt.Errorf("failed to ping DB: %w", err)
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping DB: %w", err)
 	}
 
-	fmt.Println("✅ Connected to AWS RDS PostgreSQL")
-	return nil
+	slog.Info("connected to PostgreSQL",
+		"host", cfg.ConnConfig.Host,
+		"database", cfg.ConnConfig.Database,
+		"read_only", readOnly,
+		"max_conns", cfg.MaxConns,
+	)
+	return pool, nil
 }
 
-func Close() {
-	if DB != nil {
-		DB.Close()
-		fmt.Println("🔌 DB connection closed")
+// poolConfig parses dsn and fills in the DB_* pool and session settings.
+// A setting the DSN already carries (pool_max_conns, connect_timeout,
+// statement_timeout, …) wins, and a zero setting keeps the pgx default.
+func poolConfig(c config.Database, dsn string, readOnly bool) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	inDSN := dsnKeys(dsn)
+
+	// Pool settings. Each Lambda environment serves one request at a time,
+	// so a big pool there only multiplies idle connections on the server.
+	if !inDSN["pool_max_conns"] {
+		cfg.MaxConns = int32(c.MaxConns)
+		if cfg.MaxConns == 0 {
+			cfg.MaxConns = 10
+			if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+				cfg.MaxConns = 2
+			}
+		}
+	}
+	if !inDSN["pool_min_conns"] && c.MinConns > 0 {
+		cfg.MinConns = int32(c.MinConns)
+	}
+	cfg.MinConns = min(cfg.MinConns, cfg.MaxConns)
+	if !inDSN["pool_max_conn_lifetime"] && c.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = c.MaxConnLifetime
+	}
+	if !inDSN["pool_max_conn_idle_time"] && c.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+	if !inDSN["connect_timeout"] && c.ConnectTimeout > 0 {
+		cfg.ConnConfig.ConnectTimeout = c.ConnectTimeout
+	}
+
+	// Session settings, unless the DSN already sets them
+	params := cfg.ConnConfig.RuntimeParams
+	if _, ok := params["application_name"]; !ok && c.ApplicationName != "" {
+		params["application_name"] = c.ApplicationName
+	}
+	if _, ok := params["statement_timeout"]; !ok && c.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)
 	}
+	if readOnly {
+		// Guards against DB_REPLICA_URL pointing at a writable server (the
+		// primary, in development): a write sent through Reader fails there
+		// just as it would on a real replica.
+		params["default_transaction_read_only"] = "on"
+	}
+	return cfg, nil
+}
+
+// dsnKeys lists the parameter names dsn sets, in URL
+// (postgres://…?pool_max_conns=4) or keyword/value (pool_max_conns=4) form.
+func dsnKeys(dsn string) map[string]bool {
+	keys := map[string]bool{}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if u, err := url.Parse(dsn); err == nil {
+			for k := range u.Query() {
+				keys[k] = true
+			}
+		}
+		return keys
+	}
+	for _, field := range strings.Fields(dsn) {
+		if k, _, ok := strings.Cut(field, "="); ok {
+			keys[strings.TrimSpace(k)] = true
+		}
+	}
+	return keys
 }
 
-func getEnv(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+func Close() {
+	if Replica != nil {
+		Replica.Close()
+	}
+	if DB != nil {
+		DB.Close()
+		slog.Info("DB connection closed")
 	}
-	return fallback
 }
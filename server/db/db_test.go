@@ -0,0 +1,63 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"server/config"
+)
+
+func TestPoolConfig(t *testing.T) {
+	c := config.Defaults().Database
+	c.MaxConns = 3
+	c.MinConns = 1
+	c.MaxConnLifetime = 2 * time.Hour
+	c.MaxConnIdleTime = time.Minute
+	c.ConnectTimeout = 5 * time.Second
+	c.StatementTimeout = 30 * time.Second
+
+	tests := []struct {
+		name             string
+		dsn              string
+		change           func(*config.Database)
+		maxConns         int32
+		lifetime         time.Duration
+		idle             time.Duration
+		connectTimeout   time.Duration
+		statementTimeout string
+	}{
+		{"settings apply", "postgres://app@db/skyvault", nil, 3, 2 * time.Hour, time.Minute, 5 * time.Second, "30000"},
+		{"URL wins", "postgres://app@db/skyvault?pool_max_conns=7&pool_max_conn_lifetime=10m&pool_max_conn_idle_time=20s&connect_timeout=2&statement_timeout=100",
+			nil, 7, 10 * time.Minute, 20 * time.Second, 2 * time.Second, "100"},
+		{"keyword DSN wins", "host=db user=app pool_max_conns=5 pool_max_conn_lifetime=15m",
+			nil, 5, 15 * time.Minute, time.Minute, 5 * time.Second, "30000"},
+		{"zero keeps pgx defaults", "postgres://app@db/skyvault", func(d *config.Database) {
+			d.MaxConnLifetime, d.MaxConnIdleTime, d.StatementTimeout = 0, 0, 0
+		}, 3, time.Hour, 30 * time.Minute, 5 * time.Second, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := c
+			if tt.change != nil {
+				tt.change(&d)
+			}
+			cfg, err := poolConfig(d, tt.dsn, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.MaxConns != tt.maxConns || cfg.MaxConnLifetime != tt.lifetime || cfg.MaxConnIdleTime != tt.idle {
+				t.Errorf("pool max=%d lifetime=%v idle=%v, want %d %v %v",
+					cfg.MaxConns, cfg.MaxConnLifetime, cfg.MaxConnIdleTime, tt.maxConns, tt.lifetime, tt.idle)
+			}
+			if cfg.ConnConfig.ConnectTimeout != tt.connectTimeout {
+				t.Errorf("connect timeout %v, want %v", cfg.ConnConfig.ConnectTimeout, tt.connectTimeout)
+			}
+			if got := cfg.ConnConfig.RuntimeParams["statement_timeout"]; got != tt.statementTimeout {
+				t.Errorf("statement_timeout %q, want %q", got, tt.statementTimeout)
+			}
+			if cfg.MinConns != 1 {
+				t.Errorf("min conns %d, want 1", cfg.MinConns)
+			}
+		})
+	}
+}
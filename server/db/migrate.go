@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the advisory lock serialising Migrate across
+// processes ("skyv").
+const migrationLockKey = 0x736b7976
+
+// Migrate applies every embedded migration newer than the recorded schema
+// version. Migrations run in order, each inside its own transaction, on top
+// of the baseline schema in dump.sql. Instances starting together take turns
+// through a session advisory lock held on one connection for the whole run;
+// the later ones find everything applied.
+func Migrate(ctx context.Context) error {
+	conn, err := DB.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration connection: %w", err)
+	}
+	defer conn.Release()
+
+	// The wait for another instance's migrations is not bound by
+	// DB_STATEMENT_TIMEOUT; a session lock outlives the transaction taking it.
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	_, err = tx.Exec(ctx, `SET LOCAL statement_timeout = 0`)
+	if err == nil {
+		_, err = tx.Exec(ctx, `SELECT pg_advisory_lock($1)`, int64(migrationLockKey))
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, int64(migrationLockKey)); err != nil {
+			// Closing the connection releases the lock with the session
+			_ = conn.Conn().Close(context.Background())
+		}
+	}()
+
+	return migrate(ctx, conn.Conn())
+}
+
+// migrate runs the migrations on conn, which holds the migration lock.
+func migrate(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS public.schema_migrations (
+			version integer PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamp without time zone DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		version, err := migrationVersion(entry.Name())
+		if err != nil {
+			return err
+		}
+
+		var applied bool
+		err = conn.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM public.schema_migrations WHERE version=$1)`,
+			version,
+		).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("failed to check migration %d: %w", version, err)
+		}
+		if applied {
+			continue
+		}
+
+		sql, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", version, err)
+		}
+		// DB_STATEMENT_TIMEOUT is meant for requests, not schema changes
+		if _, err := tx.Exec(ctx, `SET LOCAL statement_timeout = 0`); err != nil {
+			_ = tx.Rollback(ctx)
+			return fmt.Errorf("failed to begin migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(ctx, string(sql)); err != nil {
+			_ = tx.Rollback(ctx)
+			return fmt.Errorf("migration %s failed: %w", entry.Name(), err)
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO public.schema_migrations (version, name) VALUES ($1, $2)`,
+			version, entry.Name(),
+		); err != nil {
+			_ = tx.Rollback(ctx)
+			return fmt.Errorf("failed to record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", version, err)
+		}
+		slog.InfoContext(ctx, "applied migration", "version", version, "name", entry.Name())
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the newest applied migration and the newest one
+// embedded in this binary. applied < latest means Migrate has not run (or
+// failed); applied > latest means a newer release has migrated the
+// database ahead of this one.
+func SchemaVersion(ctx context.Context) (applied, latest int, err error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	for _, entry := range entries {
+		v, err := migrationVersion(entry.Name())
+		if err != nil {
+			return 0, 0, err
+		}
+		latest = max(latest, v)
+	}
+
+	err = DB.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM public.schema_migrations`).Scan(&applied)
+	if err != nil {
+		return 0, latest, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return applied, latest, nil
+}
+
+// migrationVersion parses the numeric prefix of a file like "0001_name.sql".
+func migrationVersion(name string) (int, error) {
+	prefix, _, ok := strings.Cut(name, "_")
+	if !ok {
+		return 0, fmt.Errorf("invalid migration file name %q", name)
+	}
+	v, err := strconv.Atoi(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("invalid migration version in %q: %w", name, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,15 @@
+-- Per-user, per-calendar-month usage ledger. Rows are keyed by the first day
+-- of the month in the configured usage timezone (USAGE_TIMEZONE).
+CREATE TABLE IF NOT EXISTS public.user_usage_monthly (
+    user_id integer NOT NULL REFERENCES public.users(id) ON DELETE CASCADE,
+    month date NOT NULL,
+    uploads integer NOT NULL DEFAULT 0,
+    downloads integer NOT NULL DEFAULT 0,
+    upload_bytes bigint NOT NULL DEFAULT 0,
+    egress_bytes bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, month)
+);
+
+-- Month the *_this_month counters in user_stats belong to. Counters from an
+-- older month are treated as zero and reset on the next write.
+ALTER TABLE public.user_stats ADD COLUMN IF NOT EXISTS stats_month date;
@@ -0,0 +1,4 @@
+-- Keyset pagination indexes for the admin user listing.
+CREATE INDEX IF NOT EXISTS user_stats_storage_used_idx ON public.user_stats (storage_used, user_id);
+CREATE INDEX IF NOT EXISTS user_stats_files_count_idx ON public.user_stats (files_count, user_id);
+CREATE INDEX IF NOT EXISTS user_stats_last_active_idx ON public.user_stats ((COALESCE(last_active, 'epoch'::timestamp)), user_id);
@@ -0,0 +1,36 @@
+-- Storage attribution per user. Each reference to a blob is charged an equal
+-- share of the blob's physical size (size / ref_count), so users who hold the
+-- same content split its cost and every holder is credited the same savings.
+-- Summed over all users: logical - attributed = system deduplication savings.
+CREATE OR REPLACE VIEW public.user_storage_attribution AS
+SELECT uf.user_id,
+       COALESCE(SUM(fb.size), 0)::bigint AS logical_bytes,
+       ROUND(COALESCE(SUM(fb.size::numeric / GREATEST(fb.ref_count, 1)), 0))::bigint AS attributed_bytes,
+       (COALESCE(SUM(fb.size), 0)
+        - ROUND(COALESCE(SUM(fb.size::numeric / GREATEST(fb.ref_count, 1)), 0)))::bigint AS dedup_savings
+FROM public.user_files uf
+JOIN public.file_blobs fb ON fb.id = uf.blob_id
+GROUP BY uf.user_id;
+
+-- Repair ref_count drift left by older deletes that removed several
+-- references while decrementing once.
+UPDATE public.file_blobs fb
+SET ref_count = c.refs
+FROM (
+    SELECT fb2.id, COUNT(uf.id)::integer AS refs
+    FROM public.file_blobs fb2
+    LEFT JOIN public.user_files uf ON uf.blob_id = fb2.id
+    GROUP BY fb2.id
+) c
+WHERE c.id = fb.id AND fb.ref_count IS DISTINCT FROM c.refs;
+
+-- Replace the accumulated savings counters with derived values.
+UPDATE public.user_stats us
+SET deduplication_savings = COALESCE(
+    (SELECT a.dedup_savings FROM public.user_storage_attribution a WHERE a.user_id = us.user_id), 0);
+
+UPDATE public.system_stats
+SET deduplication_savings = (
+    SELECT COALESCE(SUM(size * GREATEST(ref_count - 1, 0)), 0) FROM public.file_blobs
+)
+WHERE snapshot_date = (SELECT MAX(snapshot_date) FROM public.system_stats);
@@ -0,0 +1,20 @@
+-- user_stats.storage_used and files_count now count every reference the
+-- user holds (logical). attributed_storage is the user's equal share of the
+-- physical bytes, as defined by user_storage_attribution.
+ALTER TABLE public.user_stats ADD COLUMN IF NOT EXISTS attributed_storage bigint DEFAULT 0;
+
+-- system_stats.total_storage stays physical; logical_storage is what users see.
+ALTER TABLE public.system_stats ADD COLUMN IF NOT EXISTS logical_storage bigint DEFAULT 0;
+
+UPDATE public.user_stats us
+SET files_count = COALESCE((SELECT COUNT(*) FROM public.user_files uf WHERE uf.user_id = us.user_id), 0),
+    storage_used = COALESCE(
+        (SELECT a.logical_bytes FROM public.user_storage_attribution a WHERE a.user_id = us.user_id), 0),
+    attributed_storage = COALESCE(
+        (SELECT a.attributed_bytes FROM public.user_storage_attribution a WHERE a.user_id = us.user_id), 0);
+
+UPDATE public.system_stats
+SET total_files = (SELECT COUNT(*) FROM public.user_files),
+    total_storage = (SELECT COALESCE(SUM(size), 0) FROM public.file_blobs),
+    logical_storage = (SELECT COALESCE(SUM(size * ref_count), 0) FROM public.file_blobs)
+WHERE snapshot_date = (SELECT MAX(snapshot_date) FROM public.system_stats);
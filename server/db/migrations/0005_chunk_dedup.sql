@@ -0,0 +1,24 @@
+-- Content-defined chunk storage (DEDUP_MODE=chunk). A chunked blob's bytes
+-- live in refcounted chunk objects; blob_chunks is its ordered manifest and
+-- file_blobs.s3_key points at a JSON copy of that manifest.
+ALTER TABLE public.file_blobs ADD COLUMN IF NOT EXISTS storage_mode text NOT NULL DEFAULT 'file';
+
+CREATE TABLE IF NOT EXISTS public.chunks (
+    id serial PRIMARY KEY,
+    hash text NOT NULL UNIQUE,
+    s3_key text NOT NULL UNIQUE,
+    size integer NOT NULL,
+    ref_count integer NOT NULL DEFAULT 1,
+    created_at timestamp without time zone DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS public.blob_chunks (
+    blob_id integer NOT NULL REFERENCES public.file_blobs(id) ON DELETE CASCADE,
+    seq integer NOT NULL,
+    chunk_id integer NOT NULL REFERENCES public.chunks(id),
+    "offset" bigint NOT NULL,
+    size integer NOT NULL,
+    PRIMARY KEY (blob_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS blob_chunks_chunk_id_idx ON public.blob_chunks (chunk_id);
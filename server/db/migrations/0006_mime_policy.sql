@@ -0,0 +1,9 @@
+-- Upload type policy: file_blobs.mime_type is the effective type; the
+-- client's claim and the server's content sniff are kept alongside it.
+ALTER TABLE public.file_blobs ADD COLUMN IF NOT EXISTS claimed_mime_type text;
+ALTER TABLE public.file_blobs ADD COLUMN IF NOT EXISTS detected_mime_type text;
+
+UPDATE public.file_blobs SET claimed_mime_type = mime_type WHERE claimed_mime_type IS NULL;
+
+-- Plan names select the UPLOAD_TYPES_<PLAN>_ALLOW / _DENY policy.
+ALTER TABLE public.users ADD COLUMN IF NOT EXISTS plan text NOT NULL DEFAULT 'free';
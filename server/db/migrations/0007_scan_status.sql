@@ -0,0 +1,11 @@
+-- Malware scan verdict per blob. Duplicates share the blob row and so reuse
+-- its verdict. Existing blobs start as pending and are scanned on first
+-- download.
+ALTER TABLE public.file_blobs ADD COLUMN IF NOT EXISTS scan_status text NOT NULL DEFAULT 'pending';
+ALTER TABLE public.file_blobs ADD COLUMN IF NOT EXISTS scan_signature text;
+ALTER TABLE public.file_blobs ADD COLUMN IF NOT EXISTS scan_engine text;
+ALTER TABLE public.file_blobs ADD COLUMN IF NOT EXISTS scanned_at timestamp without time zone;
+
+ALTER TABLE public.file_blobs DROP CONSTRAINT IF EXISTS file_blobs_scan_status_check;
+ALTER TABLE public.file_blobs ADD CONSTRAINT file_blobs_scan_status_check
+    CHECK (scan_status IN ('pending', 'clean', 'infected', 'error'));
@@ -0,0 +1,46 @@
+-- Durable background jobs. Workers claim queued rows with
+-- FOR UPDATE SKIP LOCKED; failed jobs are retried with exponential backoff
+-- and end up as status 'dead' (the dead-letter set) after max_attempts.
+CREATE TABLE IF NOT EXISTS public.jobs (
+    id bigserial PRIMARY KEY,
+    type text NOT NULL,
+    payload jsonb NOT NULL DEFAULT '{}'::jsonb,
+    status text NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'running', 'succeeded', 'dead')),
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL DEFAULT 5,
+    run_at timestamp without time zone NOT NULL DEFAULT now(),
+    unique_key text,
+    locked_by text,
+    locked_at timestamp without time zone,
+    last_error text,
+    created_at timestamp without time zone NOT NULL DEFAULT now(),
+    updated_at timestamp without time zone NOT NULL DEFAULT now(),
+    finished_at timestamp without time zone
+);
+
+CREATE INDEX IF NOT EXISTS jobs_ready_idx ON public.jobs (run_at, id) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS jobs_running_idx ON public.jobs (locked_at) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS jobs_finished_idx ON public.jobs (finished_at) WHERE status IN ('succeeded', 'dead');
+
+-- At most one pending copy of a job with a given unique_key.
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_unique_key_idx ON public.jobs (unique_key)
+    WHERE unique_key IS NOT NULL AND status IN ('queued', 'running');
+
+-- Cron schedules. next_run_at is advanced atomically by whichever worker
+-- fires the schedule, so each occurrence is enqueued once.
+CREATE TABLE IF NOT EXISTS public.job_schedules (
+    name text PRIMARY KEY,
+    spec text NOT NULL,
+    job_type text NOT NULL,
+    payload jsonb NOT NULL DEFAULT '{}'::jsonb,
+    next_run_at timestamp without time zone NOT NULL,
+    last_run_at timestamp without time zone
+);
+
+-- Blobs uploaded before scanning existed get scanned by the workers.
+INSERT INTO public.jobs (type, payload, unique_key)
+SELECT 'scan.blob', jsonb_build_object('blob_id', id), 'scan.blob:' || id
+FROM public.file_blobs
+WHERE scan_status IN ('pending', 'error')
+ON CONFLICT DO NOTHING;
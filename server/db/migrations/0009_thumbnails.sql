@@ -0,0 +1,31 @@
+-- Image thumbnails. Derived objects live under thumbnails/<hash>/ and are
+-- keyed by blob hash, so every reference to a deduplicated image shares one
+-- set. thumbnail_status: none (not an image we render), pending, ready,
+-- failed.
+ALTER TABLE public.file_blobs
+    ADD COLUMN IF NOT EXISTS thumbnail_status text NOT NULL DEFAULT 'none'
+        CHECK (thumbnail_status IN ('none', 'pending', 'ready', 'failed'));
+
+CREATE TABLE IF NOT EXISTS public.blob_thumbnails (
+    hash text NOT NULL,
+    size text NOT NULL,
+    s3_key text NOT NULL UNIQUE,
+    mime_type text NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    bytes bigint NOT NULL,
+    created_at timestamp without time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (hash, size)
+);
+
+-- Existing clean images get thumbnails from the worker.
+UPDATE public.file_blobs
+SET thumbnail_status = 'pending'
+WHERE mime_type IN ('image/jpeg', 'image/png', 'image/gif')
+  AND scan_status = 'clean';
+
+INSERT INTO public.jobs (type, payload, unique_key)
+SELECT 'thumbnail.blob', jsonb_build_object('blob_id', id), 'thumbnail.blob:' || id
+FROM public.file_blobs
+WHERE thumbnail_status = 'pending'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,24 @@
+-- Full-text search over file contents. Text is extracted once per blob by
+-- the worker (so deduplicated copies share it) into content_text; the
+-- tsvector is derived from it and GIN indexed. content_status: none (not a
+-- type we extract), pending, indexed, failed.
+ALTER TABLE public.file_blobs
+    ADD COLUMN IF NOT EXISTS content_status text NOT NULL DEFAULT 'none'
+        CHECK (content_status IN ('none', 'pending', 'indexed', 'failed')),
+    ADD COLUMN IF NOT EXISTS content_text text,
+    ADD COLUMN IF NOT EXISTS content_tsv tsvector
+        GENERATED ALWAYS AS (to_tsvector('english'::regconfig, COALESCE(content_text, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS file_blobs_content_tsv_idx ON public.file_blobs USING gin (content_tsv);
+
+-- Existing clean documents get indexed by the worker.
+UPDATE public.file_blobs
+SET content_status = 'pending'
+WHERE mime_type IN ('text/plain', 'text/markdown', 'text/x-markdown', 'text/csv', 'application/json', 'application/pdf')
+  AND scan_status = 'clean';
+
+INSERT INTO public.jobs (type, payload, unique_key)
+SELECT 'extract.text', jsonb_build_object('blob_id', id), 'extract.text:' || id
+FROM public.file_blobs
+WHERE content_status = 'pending'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,47 @@
+-- Outgoing webhooks. A subscription with user_id NULL is system-wide and
+-- receives every user's events; an empty event_types array means all types.
+CREATE TABLE IF NOT EXISTS public.webhook_subscriptions (
+    id serial PRIMARY KEY,
+    user_id integer REFERENCES public.users(id) ON DELETE CASCADE,
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types text[] NOT NULL DEFAULT '{}',
+    description text NOT NULL DEFAULT '',
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamp without time zone NOT NULL DEFAULT now(),
+    updated_at timestamp without time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_user_idx ON public.webhook_subscriptions (user_id) WHERE active;
+
+-- The outbox: events are written in the same transaction as the change
+-- they describe, together with the job that fans them out.
+CREATE TABLE IF NOT EXISTS public.webhook_events (
+    id bigserial PRIMARY KEY,
+    event_type text NOT NULL,
+    user_id integer,
+    payload jsonb NOT NULL,
+    created_at timestamp without time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_events_created_idx ON public.webhook_events (created_at);
+
+-- One row per (subscription, event), updated after every attempt.
+CREATE TABLE IF NOT EXISTS public.webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    subscription_id integer NOT NULL REFERENCES public.webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id bigint NOT NULL REFERENCES public.webhook_events(id) ON DELETE CASCADE,
+    status text NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts integer NOT NULL DEFAULT 0,
+    response_status integer,
+    response_body text,
+    last_error text,
+    duration_ms integer,
+    created_at timestamp without time zone NOT NULL DEFAULT now(),
+    updated_at timestamp without time zone NOT NULL DEFAULT now(),
+    delivered_at timestamp without time zone,
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx ON public.webhook_deliveries (subscription_id, id DESC);
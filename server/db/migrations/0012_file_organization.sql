@@ -0,0 +1,9 @@
+-- Folders, tags and a trash for user files, managed by the bulk operations
+-- endpoint. A trashed file keeps its blob reference, and still counts
+-- towards the user's storage, until it is deleted for good.
+ALTER TABLE public.user_files ADD COLUMN IF NOT EXISTS folder text NOT NULL DEFAULT '/';
+ALTER TABLE public.user_files ADD COLUMN IF NOT EXISTS tags text[] NOT NULL DEFAULT '{}';
+ALTER TABLE public.user_files ADD COLUMN IF NOT EXISTS trashed_at timestamp without time zone;
+
+CREATE INDEX IF NOT EXISTS user_files_trash_idx ON public.user_files (user_id, trashed_at) WHERE trashed_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS user_files_tags_idx ON public.user_files USING gin (tags);
@@ -0,0 +1,6 @@
+-- Chunks whose ref_count drops to zero are no longer deleted on the spot:
+-- the purge.chunks job removes them once gc_after has passed. Releasing a
+-- chunk, or an upload about to reuse one, pushes gc_after forward.
+ALTER TABLE public.chunks ADD COLUMN IF NOT EXISTS gc_after timestamp without time zone;
+
+CREATE INDEX IF NOT EXISTS chunks_gc_idx ON public.chunks (gc_after) WHERE ref_count <= 0;
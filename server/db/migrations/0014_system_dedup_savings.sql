@@ -0,0 +1,4 @@
+-- System deduplication savings are derived by GET /admin/system-stats as
+-- logical bytes minus physical bytes (distinct chunks for chunked blobs).
+-- The stored counter used a different formula and was never read.
+ALTER TABLE public.system_stats DROP COLUMN IF EXISTS deduplication_savings;
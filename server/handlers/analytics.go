@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
-	"log"
 
-	"server/db"
+	"server/store"
 )
 
 // ✅ Matches system_stats schema
@@ -18,6 +19,18 @@ type SystemStats struct {
 	TotalUploads         int   `json:"totalUploads"`
 	TotalDownloads       int   `json:"totalDownloads"`
 	DeduplicationSavings int64 `json:"deduplicationSavings"`
+
+	LogicalStorage  int64  `json:"logicalStorage"`
+	PhysicalStorage int64  `json:"physicalStorage"`
+	BillingBasis    string `json:"billingBasis"`
+	BillableStorage int64  `json:"billableStorage"`
+
+	// Chunk-level deduplication (DEDUP_MODE=chunk): bytes of unique chunked
+	// blobs vs bytes of the distinct chunks actually stored.
+	ChunkedBlobs       int   `json:"chunkedBlobs"`
+	ChunkLogicalBytes  int64 `json:"chunkLogicalBytes"`
+	ChunkPhysicalBytes int64 `json:"chunkPhysicalBytes"`
+	ChunkSavings       int64 `json:"chunkSavings"`
 }
 
 // ✅ Matches user_stats schema
@@ -30,207 +43,397 @@ type UserStats struct {
 	UploadsThisMonth   int       `json:"uploadsThisMonth"`
 	DownloadsThisMonth int       `json:"downloadsThisMonth"`
 	DeduplicationSaved int64     `json:"deduplicationSavings"`
+
+	// StorageUsed is logical; PhysicalStorage is the attributed share.
+	PhysicalStorage int64  `json:"physicalStorage"`
+	QuotaBasis      string `json:"quotaBasis"`
+	QuotaBytes      int64  `json:"quotaBytes"`
+	QuotaUsed       int64  `json:"quotaUsed"`
+	BillingBasis    string `json:"billingBasis"`
+	BillableStorage int64  `json:"billableStorage"`
+}
+
+// applyStoragePolicy fills the quota and billing figures of u.
+func (u *UserStats) applyStoragePolicy(p storagePolicy) {
+	u.QuotaBasis = p.QuotaBasis
+	u.QuotaBytes = p.QuotaBytes
+	u.QuotaUsed = basisBytes(p.QuotaBasis, u.StorageUsed, u.PhysicalStorage)
+	u.BillingBasis = p.BillingBasis
+	u.BillableStorage = basisBytes(p.BillingBasis, u.StorageUsed, u.PhysicalStorage)
 }
 
-//
 // 🔹 System-wide stats
 //
-func GetSystemStats(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// Savings = logical - physical, where a chunked blob's physical bytes are
+// the distinct chunks stored.
+func (h *Handlers) GetSystemStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
 	defer cancel()
 
-	query := `
-		SELECT total_users, total_files, total_storage,
-		       total_uploads, total_downloads, deduplication_savings
-		FROM system_stats
-		ORDER BY snapshot_date DESC
-		LIMIT 1
-	`
-
-	var stats SystemStats
-	err := db.DB.QueryRow(ctx, query).Scan(
-		&stats.TotalUsers,
-		&stats.TotalFiles,
-		&stats.TotalStorage,
-		&stats.TotalUploads,
-		&stats.TotalDownloads,
-		&stats.DeduplicationSavings,
-	)
+	report, err := h.store.Stats.System(ctx)
 	if err != nil {
-		http.Error(w, "Failed to fetch system stats: "+err.Error(), http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "GetSystemStats query failed", "error", err)
+		writeError(w, r, codeInternal, "Failed to fetch system stats")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(stats)
+	p := currentStoragePolicy()
+	stats := SystemStats{
+		TotalUsers:         report.Users,
+		TotalFiles:         report.Files,
+		TotalStorage:       report.Physical,
+		TotalUploads:       report.Uploads,
+		TotalDownloads:     report.Downloads,
+		LogicalStorage:     report.Logical,
+		PhysicalStorage:    report.Physical,
+		ChunkedBlobs:       report.ChunkedBlobs,
+		ChunkLogicalBytes:  report.ChunkLogical,
+		ChunkPhysicalBytes: report.ChunkPhysical,
+	}
+	stats.DeduplicationSavings = stats.LogicalStorage - stats.PhysicalStorage
+	stats.ChunkSavings = stats.ChunkLogicalBytes - stats.ChunkPhysicalBytes
+	stats.BillingBasis = p.BillingBasis
+	stats.BillableStorage = basisBytes(p.BillingBasis, stats.LogicalStorage, stats.PhysicalStorage)
+
+	writeJSON(w, r, http.StatusOK, stats)
+}
+
+// UserStatsPage is one page of the admin user listing.
+type UserStatsPage struct {
+	Users      []UserStats `json:"users"`
+	Total      int         `json:"total"`
+	NextCursor string      `json:"nextCursor,omitempty"`
 }
 
-//
 // 🔹 Admin endpoint: all users' stats
 //
-func GetAllUserStats(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// Query params:
+//
+//	limit          page size (default 50, max 200)
+//	cursor         nextCursor from the previous page
+//	sort           id | storage | files | activity (default id)
+//	order          asc | desc (default asc for id, desc otherwise)
+//	q              case-insensitive email substring
+//	inactive_days  only users with no activity in the last N days
+func (h *Handlers) GetAllUserStats(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
 
-	query := `
-		SELECT u.id, u.email,
-		       us.files_count, us.storage_used, us.last_active,
-		       us.uploads_this_month, us.downloads_this_month, us.deduplication_savings
-		FROM users u
-		JOIN user_stats us ON u.id = us.user_id
-		ORDER BY u.id ASC
-	`
+	limit := 50
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			writeError(w, r, codeInvalidRequest, "limit must be between 1 and 200")
+			return
+		}
+		limit = n
+	}
 
-	rows, err := db.DB.Query(ctx, query)
-	if err != nil {
-		http.Error(w, "Failed to fetch user stats: "+err.Error(), http.StatusInternalServerError)
+	sort := params.Get("sort")
+	if sort == "" {
+		sort = store.SortByID
+	}
+	switch sort {
+	case store.SortByID, store.SortByStorage, store.SortByFiles, store.SortByActivity:
+	default:
+		writeError(w, r, codeInvalidRequest, "sort must be one of id, storage, files, activity")
+		return
+	}
+
+	order := params.Get("order")
+	if order == "" {
+		order = "desc"
+		if sort == store.SortByID {
+			order = "asc"
+		}
+	}
+	if order != "asc" && order != "desc" {
+		writeError(w, r, codeInvalidRequest, "order must be asc or desc")
 		return
 	}
-	defer rows.Close()
-
-	var users []UserStats
-	for rows.Next() {
-		var u UserStats
-		if err := rows.Scan(
-			&u.ID,
-			&u.Email,
-			&u.FilesCount,
-			&u.StorageUsed,
-			&u.LastActive,
-			&u.UploadsThisMonth,
-			&u.DownloadsThisMonth,
-			&u.DeduplicationSaved,
-		); err == nil {
-			users = append(users, u)
+
+	q := store.UserQuery{
+		Search:       params.Get("q"),
+		InactiveDays: -1,
+		Sort:         sort,
+		Desc:         order == "desc",
+		Limit:        limit + 1,
+		Month:        currentUsageMonth(),
+	}
+
+	if v := params.Get("inactive_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			writeError(w, r, codeInvalidRequest, "inactive_days must be a non-negative integer")
+			return
 		}
+		q.InactiveDays = days
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(users)
+	if c := params.Get("cursor"); c != "" {
+		cur, err := decodeCursor(c)
+		if err != nil || cur.Sort != sort || cur.Order != order {
+			writeError(w, r, codeInvalidRequest, "invalid cursor")
+			return
+		}
+		value, err := parseUserSortValue(sort, cur.Value)
+		if err != nil {
+			writeError(w, r, codeInvalidRequest, "invalid cursor")
+			return
+		}
+		q.After = &store.UserCursor{Value: value, ID: cur.ID}
+	}
+
+	slog.DebugContext(r.Context(), "GetAllUserStats request", "sort", sort, "order", order, "limit", limit)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	reports, total, err := h.store.Stats.Users(ctx, q)
+	if err != nil {
+		slog.ErrorContext(ctx, "GetAllUserStats query failed", "error", err)
+		writeError(w, r, codeInternal, "Failed to fetch user stats")
+		return
+	}
+
+	p := currentStoragePolicy()
+	page := UserStatsPage{Users: make([]UserStats, 0, len(reports)), Total: total}
+	for _, report := range reports {
+		u := userStats(report)
+		u.applyStoragePolicy(p)
+		page.Users = append(page.Users, u)
+	}
+
+	if len(page.Users) > limit {
+		page.Users = page.Users[:limit]
+		last := page.Users[limit-1]
+		page.NextCursor = encodeCursor(pageCursor{
+			Sort:  sort,
+			Order: order,
+			Value: userSortValue(sort, last),
+			ID:    last.ID,
+		})
+	}
+
+	slog.InfoContext(ctx, "GetAllUserStats success", "returned", len(page.Users), "total", page.Total)
+
+	writeJSON(w, r, http.StatusOK, page)
+}
+
+// userStats is the response form of a store.UserReport, before the storage
+// policy is applied.
+func userStats(r store.UserReport) UserStats {
+	return UserStats{
+		ID:                 r.ID,
+		Email:              r.Email,
+		FilesCount:         r.Files,
+		StorageUsed:        r.Logical,
+		LastActive:         r.LastActive,
+		UploadsThisMonth:   r.UploadsThisMonth,
+		DownloadsThisMonth: r.DownloadsThisMonth,
+		DeduplicationSaved: r.Savings,
+		PhysicalStorage:    r.Physical,
+	}
+}
+
+// userSortValue renders the sort key of u for embedding in a cursor.
+func userSortValue(sort string, u UserStats) string {
+	switch sort {
+	case store.SortByStorage:
+		return strconv.FormatInt(u.StorageUsed, 10)
+	case store.SortByFiles:
+		return strconv.Itoa(u.FilesCount)
+	case store.SortByActivity:
+		return u.LastActive.Format(time.RFC3339Nano)
+	default:
+		return strconv.Itoa(u.ID)
+	}
+}
+
+// parseUserSortValue is the inverse of userSortValue.
+func parseUserSortValue(sort, v string) (interface{}, error) {
+	switch sort {
+	case store.SortByStorage:
+		return strconv.ParseInt(v, 10, 64)
+	case store.SortByFiles, store.SortByID:
+		return strconv.Atoi(v)
+	case store.SortByActivity:
+		return time.Parse(time.RFC3339Nano, v)
+	}
+	return nil, errInvalidCursor
 }
 
-//
 // 🔹 Per-user stats (queried by email)
+func (h *Handlers) GetUserStats(w http.ResponseWriter, r *http.Request) {
+	email := r.URL.Query().Get("email")
+	if email == "" {
+		slog.WarnContext(r.Context(), "GetUserStats failed: missing email param")
+		writeError(w, r, codeInvalidRequest, "email is required")
+		return
+	}
+
+	slog.DebugContext(r.Context(), "GetUserStats request", "email", email)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	report, err := h.store.Stats.User(ctx, email, currentUsageMonth())
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			slog.WarnContext(ctx, "GetUserStats: user not found", "email", email)
+			writeError(w, r, codeNotFound, "User stats not found")
+			return
+		}
+		slog.ErrorContext(ctx, "GetUserStats query failed", "email", email, "error", err)
+		writeError(w, r, codeInternal, "Failed to fetch user stats")
+		return
+	}
+
+	u := userStats(report)
+	u.applyStoragePolicy(currentStoragePolicy())
+
+	slog.InfoContext(ctx, "GetUserStats success", "email", u.Email, "files", u.FilesCount, "storage_bytes", u.StorageUsed)
+
+	writeJSON(w, r, http.StatusOK, u)
+}
+
+// ✅ Matches user_usage_monthly schema
+type MonthlyUsage struct {
+	Month       string `json:"month"`
+	Uploads     int    `json:"uploads"`
+	Downloads   int    `json:"downloads"`
+	UploadBytes int64  `json:"uploadBytes"`
+	EgressBytes int64  `json:"egressBytes"`
+}
+
+type UsageHistory struct {
+	Email    string         `json:"email"`
+	Timezone string         `json:"timezone"`
+	Months   []MonthlyUsage `json:"months"`
+}
+
+// 🔹 Per-user monthly usage history (queried by email)
 //
-func GetUserStats(w http.ResponseWriter, r *http.Request) {
+// Returns one entry per month, oldest first, ending with the current month.
+// Months without activity are reported as zeros so charts stay contiguous.
+func (h *Handlers) GetUserUsageHistory(w http.ResponseWriter, r *http.Request) {
 	email := r.URL.Query().Get("email")
 	if email == "" {
-		log.Println("❌ GetUserStats failed | missing email param")
-		http.Error(w, "email is required", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "GetUserUsageHistory failed: missing email param")
+		writeError(w, r, codeInvalidRequest, "email is required")
 		return
 	}
 
-	log.Printf("📩 GetUserStats request | email=%s", email)
+	months := 12
+	if v := r.URL.Query().Get("months"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 120 {
+			writeError(w, r, codeInvalidRequest, "months must be between 1 and 120")
+			return
+		}
+		months = n
+	}
+
+	slog.DebugContext(r.Context(), "GetUserUsageHistory request", "email", email, "months", months)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
 	defer cancel()
 
-	query := `
-		SELECT u.id, u.email,
-		       us.files_count, us.storage_used, us.last_active,
-		       us.uploads_this_month, us.downloads_this_month, us.deduplication_savings
-		FROM users u
-		JOIN user_stats us ON u.id = us.user_id
-		WHERE u.email = $1
-	`
-
-	var u UserStats
-	err := db.DB.QueryRow(ctx, query, email).Scan(
-		&u.ID,
-		&u.Email,
-		&u.FilesCount,
-		&u.StorageUsed,
-		&u.LastActive,
-		&u.UploadsThisMonth,
-		&u.DownloadsThisMonth,
-		&u.DeduplicationSaved,
-	)
+	current := currentUsageMonth()
+	first := current.AddDate(0, -(months - 1), 0)
+
+	usage, err := h.store.Stats.UsageHistory(ctx, email, first, current)
+	if errors.Is(err, store.ErrNotFound) {
+		slog.WarnContext(ctx, "GetUserUsageHistory: user not found", "email", email)
+		writeError(w, r, codeNotFound, "User not found")
+		return
+	}
 	if err != nil {
-		log.Printf("❌ GetUserStats DB error | email=%s | query failed: %v", email, err)
-		http.Error(w, "User stats not found: "+err.Error(), http.StatusNotFound)
+		slog.ErrorContext(ctx, "GetUserUsageHistory query failed", "email", email, "error", err)
+		writeError(w, r, codeInternal, "Failed to fetch usage history")
 		return
 	}
 
-	log.Printf("✅ GetUserStats success | email=%s | files=%d | storage=%d bytes",
-		u.Email, u.FilesCount, u.StorageUsed)
+	byMonth := map[string]MonthlyUsage{}
+	for _, u := range usage {
+		m := MonthlyUsage{
+			Month:       u.Month.Format("2006-01"),
+			Uploads:     u.Uploads,
+			Downloads:   u.Downloads,
+			UploadBytes: u.UploadBytes,
+			EgressBytes: u.EgressBytes,
+		}
+		byMonth[m.Month] = m
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(u); err != nil {
-		log.Printf("❌ GetUserStats encode error | email=%s | %v", email, err)
+	history := UsageHistory{
+		Email:    email,
+		Timezone: usageLocation().String(),
+		Months:   make([]MonthlyUsage, 0, months),
+	}
+	for m := first; !m.After(current); m = m.AddDate(0, 1, 0) {
+		key := m.Format("2006-01")
+		entry, ok := byMonth[key]
+		if !ok {
+			entry = MonthlyUsage{Month: key}
+		}
+		history.Months = append(history.Months, entry)
 	}
+
+	slog.InfoContext(ctx, "GetUserUsageHistory success", "email", email, "months", len(history.Months))
+
+	writeJSON(w, r, http.StatusOK, history)
+}
+
+// ✅ One file in the admin file details listing
+type FileDetail struct {
+	ID             int       `json:"id"`
+	Name           string    `json:"name"`
+	Size           int64     `json:"size"`
+	Hash           string    `json:"hash"`
+	UploadDate     time.Time `json:"uploadDate"`
+	Uploader       string    `json:"uploader"`
+	RefCount       int       `json:"refCount"`
+	IsDeduplicated bool      `json:"isDeduplicated"`
+	Savings        int64     `json:"savings"`
 }
 
+// GetUserFileDetails returns the files of a user, outside the trash, with
+// blob and dedup info.
+func (h *Handlers) GetUserFileDetails(w http.ResponseWriter, r *http.Request) {
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		slog.WarnContext(r.Context(), "GetUserFileDetails failed: missing username")
+		writeError(w, r, codeInvalidRequest, "username is required")
+		return
+	}
+
+	slog.DebugContext(r.Context(), "fetching all file details", "user", username)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 15*time.Second)
+	defer cancel()
+
+	details, err := h.store.Stats.FileDetails(ctx, username)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to fetch file details", "user", username, "error", err)
+		writeError(w, r, codeInternal, "Unable to fetch file details")
+		return
+	}
+
+	files := make([]FileDetail, 0, len(details))
+	for _, d := range details {
+		files = append(files, FileDetail{
+			ID:             d.FileID,
+			Name:           d.FileName,
+			Size:           d.Size,
+			Hash:           d.Hash,
+			UploadDate:     d.UploadedAt,
+			Uploader:       d.Email,
+			RefCount:       d.RefCount,
+			IsDeduplicated: d.RefCount > 1,
+			Savings:        referenceSavings(d.Size, d.RefCount),
+		})
+	}
 
-// GetUserFileDetails returns all files of a user with blob + dedup info
-func GetUserFileDetails(w http.ResponseWriter, r *http.Request) {
-    username := r.URL.Query().Get("username")
-    if username == "" {
-        log.Println("❌ GetUserFileDetails failed | missing username")
-        http.Error(w, "username is required", http.StatusBadRequest)
-        return
-    }
-
-    log.Printf("📂 Fetching all file details | user=%s", username)
-
-    ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-    defer cancel()
-
-    rows, err := db.DB.Query(ctx, `
-        SELECT 
-            uf.id,
-            uf.filename,
-            fb.size,
-            fb.hash,
-            uf.uploaded_at,
-            u.email,
-            fb.ref_count,
-            CASE WHEN fb.ref_count > 1 THEN true ELSE false END AS is_dedup
-        FROM user_files uf
-        JOIN file_blobs fb ON uf.blob_id = fb.id
-        JOIN users u ON uf.user_id = u.id
-        WHERE u.email = $1
-        ORDER BY uf.uploaded_at DESC
-    `, username)
-    if err != nil {
-        log.Printf("❌ Failed to fetch file details | user=%s | error=%v", username, err)
-        http.Error(w, "Unable to fetch file details", http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-
-    var files []map[string]interface{}
-    for rows.Next() {
-        var (
-            id        int
-            filename  string
-            size      int64
-            hash      string
-            uploaded  time.Time
-            uploader  string
-            refCount  int
-            isDedup   bool
-        )
-        if err := rows.Scan(&id, &filename, &size, &hash, &uploaded, &uploader, &refCount, &isDedup); err == nil {
-            files = append(files, map[string]interface{}{
-                "id":            id,
-                "name":          filename,
-                "size":          size,
-                "hash":          hash,
-                "uploadDate":    uploaded,
-                "uploader":      uploader,
-                "refCount":      refCount,
-                "isDeduplicated": isDedup,
-                "savings":       func() int64 {
-                    if refCount > 1 {
-                        return size
-                    }
-                    return 0
-                }(),
-            })
-        }
-    }
-
-    log.Printf("✅ Returned %d files | user=%s", len(files), username)
-    w.Header().Set("Content-Type", "application/json")
-    _ = json.NewEncoder(w).Encode(files)
+	slog.InfoContext(ctx, "returned file details", "user", username, "files", len(files))
+	writeJSON(w, r, http.StatusOK, files)
 }
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSystemStats(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustUpload(t, "a@example.com", "a.txt", content10)
+	env.mustUpload(t, "b@example.com", "copy.txt", content10)
+	env.mustUpload(t, "a@example.com", "b.txt", other10)
+
+	w := httptest.NewRecorder()
+	env.h.GetSystemStats(w, httptest.NewRequest(http.MethodGet, "/admin/system-stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("system stats: %d %s", w.Code, w.Body)
+	}
+	var s SystemStats
+	decode(t, w, &s)
+	if s.TotalUsers != 2 || s.TotalFiles != 3 {
+		t.Errorf("users=%d files=%d, want 2 3", s.TotalUsers, s.TotalFiles)
+	}
+	if s.LogicalStorage != 30 || s.PhysicalStorage != 20 || s.TotalStorage != 20 {
+		t.Errorf("logical=%d physical=%d total=%d, want 30 20 20", s.LogicalStorage, s.PhysicalStorage, s.TotalStorage)
+	}
+	if s.DeduplicationSavings != 10 || s.BillableStorage != 30 {
+		t.Errorf("savings=%d billable=%d, want 10 30", s.DeduplicationSavings, s.BillableStorage)
+	}
+}
+
+func TestFileDetailsSkipTrash(t *testing.T) {
+	env := newTestEnv(t)
+	kept := env.mustUpload(t, "a@example.com", "a.txt", content10)
+	env.mustUpload(t, "b@example.com", "copy.txt", content10)
+	trashed := env.mustUpload(t, "a@example.com", "b.txt", other10)
+	env.bulk(t, BulkRequest{Username: "a@example.com", Operation: "delete", FileIDs: []int{trashed.ID}})
+
+	w := httptest.NewRecorder()
+	env.h.GetUserFileDetails(w, httptest.NewRequest(http.MethodGet, "/admin/file-details?username=a@example.com", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("file details: %d %s", w.Code, w.Body)
+	}
+	var files []FileDetail
+	decode(t, w, &files)
+	if len(files) != 1 {
+		t.Fatalf("files = %+v, want only %s", files, kept.FileName)
+	}
+	f := files[0]
+	if f.ID != kept.ID || f.RefCount != 2 || !f.IsDeduplicated || f.Savings != 5 {
+		t.Errorf("file = %+v, want id %d shared by 2 saving 5", f, kept.ID)
+	}
+}
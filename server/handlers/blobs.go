@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"server/config"
+	"server/db"
+	"server/store"
+	"server/utils"
+)
+
+// dedupMode returns the storage mode for new blobs (DEDUP_MODE=file|chunk).
+// Existing blobs keep the mode they were written with.
+func dedupMode() string {
+	if config.Get().Uploads.DedupMode == "chunk" {
+		return store.StorageModeChunked
+	}
+	return store.StorageModeFile
+}
+
+//
+// 🔹 Helper: Open bytes [start, end] (inclusive) of a blob's content
+//
+func (h *Handlers) openBlob(ctx context.Context, b store.Blob, start, end int64) (io.ReadCloser, error) {
+	if b.StorageMode != store.StorageModeChunked {
+		if start == 0 && end == b.Size-1 {
+			return h.objects.Open(ctx, b.S3Key)
+		}
+		return h.objects.OpenRange(ctx, b.S3Key, start, end)
+	}
+
+	chunks, err := h.store.Chunks.Overlapping(ctx, b.ID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkedReader{ctx: ctx, objects: h.objects, chunks: chunks, pos: start, end: end}, nil
+}
+
+// chunkedReader reassembles a byte range of a chunked blob, fetching each
+// overlapping chunk only when the previous one is exhausted.
+type chunkedReader struct {
+	ctx     context.Context // parents the storage spans only
+	objects store.Objects
+	chunks  []store.Chunk
+	idx     int
+	pos     int64 // next blob offset to read
+	end     int64 // last blob offset to read (inclusive)
+	cur     io.ReadCloser
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	for {
+		if r.pos > r.end {
+			return 0, io.EOF
+		}
+		if r.cur == nil {
+			if r.idx >= len(r.chunks) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			c := r.chunks[r.idx]
+			r.idx++
+			from := r.pos - c.Offset
+			to := c.Size - 1
+			if c.Offset+to > r.end {
+				to = r.end - c.Offset
+			}
+			key := store.ChunkKey(c.Hash)
+			var err error
+			if from == 0 && to == c.Size-1 {
+				r.cur, err = r.objects.Open(r.ctx, key)
+			} else {
+				r.cur, err = r.objects.OpenRange(r.ctx, key, from, to)
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		if max := r.end - r.pos + 1; int64(len(p)) > max {
+			p = p[:max]
+		}
+		n, err := r.cur.Read(p)
+		r.pos += int64(n)
+		if err == io.EOF {
+			_ = r.cur.Close()
+			r.cur = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r *chunkedReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+// blobManifest is the JSON copy of a chunked blob's manifest stored at the
+// blob's s3_key, so content can be reassembled from S3 alone.
+type blobManifest struct {
+	Hash   string          `json:"hash"`
+	Size   int64           `json:"size"`
+	Chunks []manifestChunk `json:"chunks"`
+}
+
+type manifestChunk struct {
+	Hash   string `json:"hash"`
+	Offset int64  `json:"offset"`
+	Size   int    `json:"size"`
+}
+
+//
+// 🔹 Helper: Store a new blob as content-defined chunks
+//
+// Chunk objects use deterministic keys (store.ChunkKey) so concurrent
+// uploads of the same chunk write the same object. Objects are written
+// before any row refers to them and no transaction is held across storage
+// calls: unreferenced chunks this upload reuses are claimed first, which
+// keeps purge.chunks away from them until Link records the blob with its
+// chunk list. Returns the manifest key and the chunk list.
+//
+func (h *Handlers) storeChunkedBlob(ctx context.Context, hash string, up upload) (string, []store.Chunk, error) {
+	manifest := blobManifest{Hash: hash, Size: up.Size}
+	var chunks []store.Chunk
+	var hashes []string
+	var offset int64
+	err := utils.ChunkReader(up.reader(), func(p []byte) error {
+		sum := sha256.Sum256(p)
+		c := store.Chunk{Hash: hex.EncodeToString(sum[:]), Offset: offset, Size: int64(len(p))}
+		manifest.Chunks = append(manifest.Chunks, manifestChunk{Hash: c.Hash, Offset: c.Offset, Size: len(p)})
+		chunks = append(chunks, c)
+		hashes = append(hashes, c.Hash)
+		offset += c.Size
+		return nil
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("chunking failed: %w", err)
+	}
+
+	stored, err := h.store.Chunks.Claim(ctx, hashes)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, c := range chunks {
+		if stored[c.Hash] {
+			continue
+		}
+		piece := io.NewSectionReader(up.Content, c.Offset, c.Size)
+		if err := h.objects.Put(ctx, store.ChunkKey(c.Hash), piece); err != nil {
+			return "", nil, fmt.Errorf("chunk upload failed: %w", err)
+		}
+		stored[c.Hash] = true
+	}
+
+	manifestKey := fmt.Sprintf("manifests/%s-%s.json", hash, uuid.New().String())
+	manifestJSON, _ := json.Marshal(manifest)
+	if err := h.objects.Put(ctx, manifestKey, bytes.NewReader(manifestJSON)); err != nil {
+		return "", nil, fmt.Errorf("manifest upload failed: %w", err)
+	}
+	return manifestKey, chunks, nil
+}
+
+//
+// 🔹 Helper: Delete one unreferenced chunk
+//
+// The chunk's row stays locked while its object is deleted, so an upload
+// claiming it waits and then finds it gone. Returns false when the chunk
+// was referenced or claimed again in the meantime.
+//
+func purgeChunk(ctx context.Context, id int) (bool, error) {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var key string
+	err = tx.QueryRow(ctx, `
+		SELECT s3_key FROM chunks c
+		WHERE id = $1 AND ref_count <= 0 AND gc_after < NOW()
+		  AND NOT EXISTS (SELECT 1 FROM blob_chunks bc WHERE bc.chunk_id = c.id)
+		FOR UPDATE
+	`, id).Scan(&key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := utils.DeleteFromS3(ctx, key); err != nil {
+		return false, fmt.Errorf("delete %s: %w", key, err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM chunks WHERE id = $1`, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
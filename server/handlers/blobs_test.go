@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"server/config"
+	"server/scanner"
+	"server/store"
+	"server/utils"
+)
+
+// setDedupMode switches DEDUP_MODE for the rest of the test.
+func setDedupMode(t *testing.T, mode string) {
+	t.Helper()
+	old := config.Get()
+	cfg := *old
+	cfg.Uploads.DedupMode = mode
+	config.Set(&cfg)
+	t.Cleanup(func() { config.Set(old) })
+}
+
+// text returns n bytes of lowercase words, the same for the same seed.
+func text(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	b := make([]byte, n)
+	for i := range b {
+		if r.Intn(6) == 0 {
+			b[i] = ' '
+		} else {
+			b[i] = byte('a' + r.Intn(26))
+		}
+	}
+	return b
+}
+
+func TestChunkedUploadDownloadDelete(t *testing.T) {
+	env := newTestEnv(t)
+	setDedupMode(t, "chunk")
+
+	shared := text(1, 6*utils.ChunkAvgSize)
+	a := append(append([]byte(nil), shared...), text(2, utils.ChunkAvgSize)...)
+	b := append(append([]byte(nil), shared...), text(3, utils.ChunkAvgSize)...)
+	first := env.mustUpload(t, "a@example.com", "a.txt", a)
+	second := env.mustUpload(t, "b@example.com", "b.txt", b)
+
+	// The shared prefix is stored once: some chunks have two references
+	chunks := env.mem.Chunks()
+	var sharedChunks int
+	for hash, refs := range chunks {
+		if _, ok := env.objects.Get(store.ChunkKey(hash)); !ok {
+			t.Errorf("chunk %s has no object", hash)
+		}
+		if refs == 2 {
+			sharedChunks++
+		}
+	}
+	if sharedChunks == 0 {
+		t.Fatalf("no chunk shared between the uploads: %v", chunks)
+	}
+	if s := env.mem.SystemStats(); s.TotalStorage >= int64(len(a)+len(b)) {
+		t.Errorf("physical %d, want less than %d", s.TotalStorage, len(a)+len(b))
+	}
+
+	for _, res := range []UploadResponse{first, second} {
+		blob, ok := env.blob(t, res.S3Key)
+		if !ok || blob.StorageMode != store.StorageModeChunked {
+			t.Fatalf("blob = %+v, want chunked", blob)
+		}
+		env.mem.SetScanStatus(blob.ID, scanner.StatusClean)
+	}
+
+	download := func(key, rangeHeader string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/download?key="+key, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		env.h.DownloadFile(w, req)
+		return w
+	}
+	if w := download(first.S3Key, ""); w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), a) {
+		t.Fatalf("download: %d, %d bytes, want %d", w.Code, w.Body.Len(), len(a))
+	}
+	// A range crossing chunk boundaries is reassembled
+	from, to := utils.ChunkAvgSize-10, 3*utils.ChunkAvgSize+10
+	w := download(second.S3Key, fmt.Sprintf("bytes=%d-%d", from, to))
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), b[from:to+1]) {
+		t.Fatalf("range download: %d, %d bytes", w.Code, w.Body.Len())
+	}
+
+	// Deleting one copy keeps every chunk the other still uses
+	if w := env.delete(t, "a@example.com", first.S3Key); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if w := download(second.S3Key, ""); w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), b) {
+		t.Fatalf("download after delete: %d, %d bytes", w.Code, w.Body.Len())
+	}
+	if w := env.delete(t, "b@example.com", second.S3Key); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if chunks := env.mem.Chunks(); len(chunks) != 0 {
+		t.Errorf("chunks left after the last delete: %v", chunks)
+	}
+	wantSystem(t, env, 0, 0, 0)
+}
+
+func hashOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// failingLink is a store.Files whose Link always fails.
+type failingLink struct{ store.Files }
+
+func (failingLink) Link(context.Context, store.Link) (store.Linked, error) {
+	return store.Linked{}, errors.New("link failed")
+}
+
+// A chunked blob is only recorded by a successful Link: a failed one leaves
+// no blob row and no chunk references behind.
+func TestChunkedUploadLinkFailure(t *testing.T) {
+	env := newTestEnv(t)
+	setDedupMode(t, "chunk")
+	content := text(4, 4*utils.ChunkAvgSize)
+
+	files := env.h.store.Files
+	env.h.store.Files = failingLink{files}
+	if w := env.upload(t, "a@example.com", "a.txt", "text/plain", content); w.Code != http.StatusInternalServerError {
+		t.Fatalf("upload with failing link: %d %s", w.Code, w.Body)
+	}
+	if chunks := env.mem.Chunks(); len(chunks) != 0 {
+		t.Errorf("chunk references left by the failed upload: %v", chunks)
+	}
+	if _, err := env.h.store.Blobs.ByHash(context.Background(), hashOf(content)); err != store.ErrNotFound {
+		t.Errorf("blob lookup after failed upload: %v, want ErrNotFound", err)
+	}
+
+	env.h.store.Files = files
+	env.mustUpload(t, "a@example.com", "a.txt", content)
+	for hash, refs := range env.mem.Chunks() {
+		if refs != 1 {
+			t.Errorf("chunk %s has %d references, want 1", hash, refs)
+		}
+	}
+	wantSystem(t, env, 1, int64(len(content)), int64(len(content)))
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"server/logging"
+	"server/store"
+)
+
+// Limits on one bulk request
+const (
+	bulkMaxFiles  = 500
+	bulkMaxTags   = 20
+	maxTagLength  = 50
+	maxFolderPath = 255
+)
+
+// Outcome of each file in a bulk operation
+const (
+	bulkOK     = "ok"
+	bulkFailed = "failed"
+)
+
+// BulkRequest is the body of POST /files/bulk.
+type BulkRequest struct {
+	Username   string   `json:"username"`
+	Operation  string   `json:"operation"` // delete, restore, move, tag or share
+	FileIDs    []int    `json:"fileIds"`
+	Atomic     bool     `json:"atomic,omitempty"`     // all or nothing
+	Permanent  bool     `json:"permanent,omitempty"`  // delete: skip the trash
+	Folder     string   `json:"folder,omitempty"`     // move
+	AddTags    []string `json:"addTags,omitempty"`    // tag
+	RemoveTags []string `json:"removeTags,omitempty"` // tag
+	Public     *bool    `json:"public,omitempty"`     // share
+}
+
+// ✅ Outcome for one file of a bulk operation
+type BulkItemResult struct {
+	FileID int    `json:"fileId"`
+	Status string `json:"status"`           // ok or failed
+	Code   string `json:"code,omitempty"`   // error code, when failed
+	Reason string `json:"reason,omitempty"` // when failed
+}
+
+// ✅ Response to a bulk operation
+type BulkResponse struct {
+	Operation string           `json:"operation"`
+	Committed bool             `json:"committed"` // false when an atomic operation changed nothing
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+//
+// 🔹 BulkFiles: one operation over many of a user's files
+//
+// delete moves files to the trash (or removes them for good with
+// permanent), restore takes them back out, move sets their folder, tag adds
+// and removes tags and share sets whether they are public. Everything runs
+// in one transaction. With atomic, one failing file fails the request with
+// 409 and nothing changes; otherwise each file succeeds or fails alone and
+// the response lists them in request order, with 200 when all succeeded and
+// 207 otherwise.
+//
+func (h *Handlers) BulkFiles(w http.ResponseWriter, r *http.Request) {
+	var req BulkRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, r, codeInvalidRequest, "Invalid JSON body")
+		return
+	}
+	if reason := validateBulkRequest(&req); reason != "" {
+		writeError(w, r, codeInvalidRequest, reason)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Second)
+	defer cancel()
+
+	user, err := h.store.Users.Ensure(ctx, req.Username)
+	if err != nil {
+		slog.ErrorContext(ctx, "bulk operation failed: ensure user", "user", req.Username, "error", err)
+		writeError(w, r, codeInternal, "User creation failed")
+		return
+	}
+	logging.SetUserID(ctx, user.ID)
+
+	op := store.Bulk{
+		Op:         req.Operation,
+		Owner:      user,
+		FileIDs:    req.FileIDs,
+		Atomic:     req.Atomic,
+		Permanent:  req.Permanent,
+		Folder:     req.Folder,
+		AddTags:    req.AddTags,
+		RemoveTags: req.RemoveTags,
+		Public:     req.Public != nil && *req.Public,
+	}
+	res, err := h.store.Files.Bulk(ctx, op)
+	if err != nil {
+		slog.ErrorContext(ctx, "bulk operation failed", "user", req.Username, "operation", req.Operation, "error", err)
+		writeError(w, r, codeInternal, "Bulk operation failed")
+		return
+	}
+
+	resp := BulkResponse{Operation: req.Operation, Committed: res.Committed, Results: make([]BulkItemResult, 0, len(res.Items))}
+	for _, item := range res.Items {
+		if item.Err == nil {
+			resp.Succeeded++
+			resp.Results = append(resp.Results, BulkItemResult{FileID: item.FileID, Status: bulkOK})
+			continue
+		}
+		code, reason := bulkFailure(item.Err)
+		resp.Failed++
+		resp.Results = append(resp.Results, BulkItemResult{FileID: item.FileID, Status: bulkFailed, Code: code, Reason: reason})
+	}
+
+	if !res.Committed {
+		for _, item := range resp.Results {
+			if item.Status == bulkFailed {
+				slog.InfoContext(ctx, "atomic bulk operation rolled back", "user", req.Username, "operation", req.Operation, "file_id", item.FileID)
+				writeError(w, r, codeConflict, fmt.Sprintf("File %d: %s; nothing was changed", item.FileID, item.Reason))
+				return
+			}
+		}
+	}
+
+	// Blobs that lost their last reference go with it, as in DeleteFile
+	var physicalFreed int64
+	for _, blob := range res.Released {
+		physicalFreed += h.releaseBlob(ctx, blob)
+	}
+	if physicalFreed > 0 {
+		if err := h.store.Stats.PhysicalFreed(ctx, physicalFreed); err != nil {
+			slog.WarnContext(ctx, "system stats update failed", "error", err)
+		}
+	}
+	for _, blobID := range res.Blobs {
+		if err := h.store.Stats.SyncAttribution(ctx, blobID, user.ID); err != nil {
+			slog.WarnContext(ctx, "storage attribution sync failed", "blob_id", blobID, "error", err)
+		}
+	}
+
+	slog.InfoContext(ctx, "bulk operation", "user", req.Username, "operation", req.Operation, "permanent", req.Permanent,
+		"succeeded", resp.Succeeded, "failed", resp.Failed, "blobs_released", len(res.Released), "freed_bytes", physicalFreed)
+
+	status := http.StatusOK
+	if resp.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	writeJSON(w, r, status, resp)
+}
+
+// validateBulkRequest normalizes req and returns why it is invalid, or "".
+func validateBulkRequest(req *BulkRequest) string {
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		return "username is required"
+	}
+	switch req.Operation {
+	case store.BulkDelete, store.BulkRestore:
+	case store.BulkMove:
+		if !strings.HasPrefix(req.Folder, "/") {
+			return "folder must be an absolute path, such as /photos"
+		}
+		req.Folder = path.Clean(req.Folder)
+		if len(req.Folder) > maxFolderPath {
+			return fmt.Sprintf("folder may not be longer than %d characters", maxFolderPath)
+		}
+	case store.BulkTag:
+		var reason string
+		if req.AddTags, reason = cleanTags(req.AddTags); reason != "" {
+			return reason
+		}
+		if req.RemoveTags, reason = cleanTags(req.RemoveTags); reason != "" {
+			return reason
+		}
+		if len(req.AddTags) == 0 && len(req.RemoveTags) == 0 {
+			return "addTags or removeTags is required"
+		}
+	case store.BulkShare:
+		if req.Public == nil {
+			return "public is required"
+		}
+	default:
+		return "operation must be one of delete, restore, move, tag, share"
+	}
+	if req.Permanent && req.Operation != store.BulkDelete {
+		return "permanent only applies to delete"
+	}
+
+	if len(req.FileIDs) == 0 {
+		return "fileIds is required"
+	}
+	if len(req.FileIDs) > bulkMaxFiles {
+		return fmt.Sprintf("At most %d files per request", bulkMaxFiles)
+	}
+	seen := make(map[int]bool, len(req.FileIDs))
+	for _, id := range req.FileIDs {
+		if seen[id] {
+			return fmt.Sprintf("fileIds lists %d more than once", id)
+		}
+		seen[id] = true
+	}
+	return ""
+}
+
+// cleanTags trims tags and drops repeats, or returns why they are invalid.
+func cleanTags(tags []string) ([]string, string) {
+	if len(tags) > bulkMaxTags {
+		return nil, fmt.Sprintf("At most %d tags per request", bulkMaxTags)
+	}
+	out := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || len(t) > maxTagLength {
+			return nil, fmt.Sprintf("Tags must be 1 to %d characters", maxTagLength)
+		}
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out, ""
+}
+
+// bulkFailure maps a file's store error to an error code and reason.
+func bulkFailure(err error) (string, string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return codeNotFound, "File not found"
+	case errors.Is(err, store.ErrTrashed):
+		return codeConflict, "File is in the trash"
+	case errors.Is(err, store.ErrNotTrashed):
+		return codeConflict, "File is not in the trash"
+	}
+	return codeInternal, err.Error()
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"server/store"
+)
+
+func (env *testEnv) bulk(t *testing.T, req BulkRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	env.h.BulkFiles(w, httptest.NewRequest(http.MethodPost, "/files/bulk", strings.NewReader(string(body))))
+	return w
+}
+
+func (env *testEnv) list(t *testing.T, username string, trash bool) []FileInfo {
+	t.Helper()
+	q := url.Values{"username": {username}}
+	if trash {
+		q.Set("trash", "true")
+	}
+	w := httptest.NewRecorder()
+	env.h.ListUserFiles(w, httptest.NewRequest(http.MethodGet, "/files?"+q.Encode(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", w.Code, w.Body)
+	}
+	var files []FileInfo
+	decode(t, w, &files)
+	return files
+}
+
+// events returns the webhook events of type written so far.
+func (env *testEnv) events(eventType string) []store.RecordedEvent {
+	var out []store.RecordedEvent
+	for _, e := range env.mem.Events() {
+		if e.Type == eventType {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestBulkTrashAndRestore(t *testing.T) {
+	env := newTestEnv(t)
+	a := env.mustUpload(t, "a@example.com", "a.txt", content10)
+	b := env.mustUpload(t, "a@example.com", "b.txt", other10)
+
+	w := env.bulk(t, BulkRequest{Username: "a@example.com", Operation: "delete", FileIDs: []int{a.ID, 999}})
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	var res BulkResponse
+	decode(t, w, &res)
+	if res.Succeeded != 1 || res.Failed != 1 || res.Results[1].Code != codeNotFound {
+		t.Errorf("delete response = %+v", res)
+	}
+
+	if files := env.list(t, "a@example.com", false); len(files) != 1 || files[0].ID != b.ID {
+		t.Errorf("listing = %+v, want only %d", files, b.ID)
+	}
+	trash := env.list(t, "a@example.com", true)
+	if len(trash) != 1 || trash[0].ID != a.ID || trash[0].TrashedAt == nil {
+		t.Errorf("trash = %+v, want only %d", trash, a.ID)
+	}
+	// The trash keeps its blob and still counts towards storage
+	if blob, ok := env.blob(t, a.S3Key); !ok || blob.RefCount != 1 {
+		t.Errorf("trashed blob = %+v, exists %v", blob, ok)
+	}
+	wantUser(t, env, env.user(t, "a@example.com"), 2, 20, 20)
+	if ev := env.events(store.EventFileTrashed); len(ev) != 1 || ev[0].Data.FileID != a.ID {
+		t.Errorf("file.trashed events = %+v, want one for %d", ev, a.ID)
+	}
+	if ev := env.events(store.EventFileDeleted); len(ev) != 0 {
+		t.Errorf("file.deleted written for a trashed file: %+v", ev)
+	}
+
+	// A trashed file cannot be moved until it is restored
+	w = env.bulk(t, BulkRequest{Username: "a@example.com", Operation: "move", Folder: "/x", FileIDs: []int{a.ID}})
+	decode(t, w, &res)
+	if res.Results[0].Code != codeConflict {
+		t.Errorf("move trashed: %+v", res)
+	}
+
+	w = env.bulk(t, BulkRequest{Username: "a@example.com", Operation: "restore", FileIDs: []int{a.ID}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore: %d %s", w.Code, w.Body)
+	}
+	if files := env.list(t, "a@example.com", false); len(files) != 2 {
+		t.Errorf("listing after restore = %+v", files)
+	}
+	if ev := env.events(store.EventFileRestored); len(ev) != 1 || ev[0].Data.FileID != a.ID {
+		t.Errorf("file.restored events = %+v, want one for %d", ev, a.ID)
+	}
+}
+
+func TestDeleteSkipsTrash(t *testing.T) {
+	env := newTestEnv(t)
+	a := env.mustUpload(t, "a@example.com", "a.txt", content10)
+	env.bulk(t, BulkRequest{Username: "a@example.com", Operation: "delete", FileIDs: []int{a.ID}})
+
+	// The only reference is in the trash, so neither form of delete finds it
+	for _, user := range []string{"a@example.com", ""} {
+		if w := env.delete(t, user, a.S3Key); w.Code != http.StatusNotFound {
+			t.Errorf("delete as %q: %d %s", user, w.Code, w.Body)
+		}
+	}
+	if blob, ok := env.blob(t, a.S3Key); !ok || blob.RefCount != 1 {
+		t.Errorf("blob = %+v, exists %v", blob, ok)
+	}
+	if trash := env.list(t, "a@example.com", true); len(trash) != 1 {
+		t.Errorf("trash = %+v", trash)
+	}
+
+	// With a live copy next to the trashed one, the live copy goes
+	live := env.mustUpload(t, "a@example.com", "again.txt", content10)
+	if w := env.delete(t, "a@example.com", a.S3Key); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if trash := env.list(t, "a@example.com", true); len(trash) != 1 || trash[0].ID != a.ID {
+		t.Errorf("trash = %+v, want only %d", trash, a.ID)
+	}
+	if files := env.list(t, "a@example.com", false); len(files) != 0 {
+		t.Errorf("%d was not deleted: %+v", live.ID, files)
+	}
+}
+
+func TestBulkPermanentDelete(t *testing.T) {
+	env := newTestEnv(t)
+	shared := env.mustUpload(t, "a@example.com", "a.txt", content10)
+	copy1 := env.mustUpload(t, "a@example.com", "a-copy.txt", content10)
+	env.mustUpload(t, "b@example.com", "b.txt", content10)
+	own := env.mustUpload(t, "a@example.com", "own.txt", other10)
+	wantSystem(t, env, 4, 40, 20)
+
+	w := env.bulk(t, BulkRequest{Username: "a@example.com", Operation: "delete", Permanent: true,
+		FileIDs: []int{shared.ID, copy1.ID, own.ID}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("permanent delete: %d %s", w.Code, w.Body)
+	}
+
+	// Two references to the shared blob went in one step; b still holds it
+	if blob, ok := env.blob(t, shared.S3Key); !ok || blob.RefCount != 1 {
+		t.Errorf("shared blob = %+v, exists %v; want ref_count 1", blob, ok)
+	}
+	if _, ok := env.objects.Get(shared.S3Key); !ok {
+		t.Error("shared object deleted")
+	}
+	// a's own blob lost its last reference
+	if _, ok := env.blob(t, own.S3Key); ok {
+		t.Error("unreferenced blob row left behind")
+	}
+	if _, ok := env.objects.Get(own.S3Key); ok {
+		t.Error("unreferenced object left behind")
+	}
+	if len(env.purged) != 1 || env.purged[0] != own.Hash {
+		t.Errorf("purged = %v, want [%s]", env.purged, own.Hash)
+	}
+
+	wantUser(t, env, env.user(t, "a@example.com"), 0, 0, 0)
+	wantUser(t, env, env.user(t, "b@example.com"), 1, 10, 10)
+	wantSystem(t, env, 1, 10, 10)
+
+	if deleted := env.events(store.EventFileDeleted); len(deleted) != 3 {
+		t.Errorf("%d file.deleted events, want 3", len(deleted))
+	}
+	if trashed := env.events(store.EventFileTrashed); len(trashed) != 0 {
+		t.Errorf("file.trashed written for a permanent delete: %+v", trashed)
+	}
+}
+
+func TestBulkAtomic(t *testing.T) {
+	env := newTestEnv(t)
+	a := env.mustUpload(t, "a@example.com", "a.txt", content10)
+	other := env.mustUpload(t, "b@example.com", "b.txt", other10)
+
+	// b's file is not a's to delete, so nothing is deleted
+	w := env.bulk(t, BulkRequest{Username: "a@example.com", Operation: "delete", Permanent: true, Atomic: true,
+		FileIDs: []int{a.ID, other.ID}})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("atomic delete: %d %s", w.Code, w.Body)
+	}
+	if blob, ok := env.blob(t, a.S3Key); !ok || blob.RefCount != 1 {
+		t.Errorf("blob = %+v, exists %v", blob, ok)
+	}
+	wantUser(t, env, env.user(t, "a@example.com"), 1, 10, 10)
+	wantSystem(t, env, 2, 20, 20)
+}
+
+func TestBulkMoveTagShare(t *testing.T) {
+	env := newTestEnv(t)
+	a := env.mustUpload(t, "a@example.com", "a.txt", content10)
+	ids := []int{a.ID}
+
+	for _, req := range []BulkRequest{
+		{Operation: "move", Folder: "/docs/../work/", FileIDs: ids},
+		{Operation: "tag", AddTags: []string{"b", " a ", "c"}, FileIDs: ids},
+		{Operation: "tag", RemoveTags: []string{"c"}, FileIDs: ids},
+		{Operation: "share", Public: new(bool), FileIDs: ids},
+	} {
+		req.Username = "a@example.com"
+		if w := env.bulk(t, req); w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", req.Operation, w.Code, w.Body)
+		}
+	}
+	public := true
+	env.bulk(t, BulkRequest{Username: "a@example.com", Operation: "share", Public: &public, FileIDs: ids})
+
+	f := env.list(t, "a@example.com", false)[0]
+	if f.Folder != "/work" || strings.Join(f.Tags, ",") != "a,b" || !f.IsPublic {
+		t.Errorf("file = %+v", f)
+	}
+
+	// Only sharing is announced: once per share request
+	shared := env.events(store.EventFileShared)
+	if len(shared) != 2 {
+		t.Fatalf("file.shared events = %+v, want 2", shared)
+	}
+	for i, want := range []bool{false, true} {
+		if d := shared[i].Data; d.FileID != a.ID || d.Public == nil || *d.Public != want {
+			t.Errorf("file.shared event %d = %+v, want public=%v", i, d, want)
+		}
+	}
+	if n := len(env.mem.Events()); n != 3 {
+		t.Errorf("%d events, want file.uploaded and two file.shared", n)
+	}
+}
+
+func TestBulkValidation(t *testing.T) {
+	env := newTestEnv(t)
+	for name, req := range map[string]BulkRequest{
+		"no username":     {Operation: "delete", FileIDs: []int{1}},
+		"bad operation":   {Username: "a@example.com", Operation: "copy", FileIDs: []int{1}},
+		"no files":        {Username: "a@example.com", Operation: "delete"},
+		"repeated file":   {Username: "a@example.com", Operation: "delete", FileIDs: []int{1, 1}},
+		"relative folder": {Username: "a@example.com", Operation: "move", Folder: "docs", FileIDs: []int{1}},
+		"no tags":         {Username: "a@example.com", Operation: "tag", FileIDs: []int{1}},
+		"share no public": {Username: "a@example.com", Operation: "share", FileIDs: []int{1}},
+		"permanent move":  {Username: "a@example.com", Operation: "move", Folder: "/", Permanent: true, FileIDs: []int{1}},
+		"too many files":  {Username: "a@example.com", Operation: "delete", FileIDs: make([]int, bulkMaxFiles+1)},
+		"empty tag":       {Username: "a@example.com", Operation: "tag", AddTags: []string{" "}, FileIDs: []int{1}},
+	} {
+		if w := env.bulk(t, req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package handlers
+
+// referenceSavings is the bytes one reference to a blob saves under the
+// equal-share attribution rule: its logical size minus its share of the
+// single physical copy.
+func referenceSavings(size int64, refCount int) int64 {
+	if refCount <= 1 {
+		return 0
+	}
+	n := int64(refCount)
+	return size - (size+n/2)/n
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"server/config"
+)
+
+// inlineSafeTypes are the media types browsers render without executing
+// scripts, so they may be previewed inline. Anything script-capable (HTML,
+// SVG, XML, JavaScript) is always sent as an attachment.
+var inlineSafeTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/avif":      true,
+	"image/bmp":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"text/csv":        true,
+	"audio/mpeg":      true,
+	"audio/ogg":       true,
+	"audio/wav":       true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"video/ogg":       true,
+}
+
+// scriptCapable reports whether a browser rendering mediaType could run
+// scripts from it (HTML, SVG and other XML).
+func scriptCapable(mediaType string) bool {
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/xml", "application/xml":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+xml")
+}
+
+// contentSecurityPolicy returns the CSP for user content. Only the web client
+// and this server may frame it. Script-capable types are also sandboxed; other
+// types are left unsandboxed because browsers refuse to show PDFs and media
+// in a sandboxed document.
+func contentSecurityPolicy(contentType, clientOrigin string) string {
+	csp := "frame-ancestors 'self'"
+	if clientOrigin = strings.TrimSuffix(clientOrigin, "/"); clientOrigin != "" {
+		csp += " " + clientOrigin
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || scriptCapable(mediaType) {
+		csp = "sandbox; default-src 'none'; img-src 'self' data:; media-src 'self'; style-src 'unsafe-inline'; " + csp
+	}
+	return csp
+}
+
+// downloadContentType returns the stored MIME type if it is a well-formed
+// media type, and application/octet-stream otherwise.
+func downloadContentType(stored string) string {
+	mediaType, params, err := mime.ParseMediaType(stored)
+	if err != nil || !strings.Contains(mediaType, "/") {
+		return "application/octet-stream"
+	}
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// isInlineSafe reports whether contentType may be rendered inline.
+func isInlineSafe(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && inlineSafeTypes[mediaType]
+}
+
+// contentDisposition builds an RFC 6266 header value carrying both an ASCII
+// `filename` fallback and the exact name as an RFC 5987 `filename*`.
+func contentDisposition(kind, filename string) string {
+	if filename == "" {
+		return kind
+	}
+	return kind + `; filename="` + asciiFilename(filename) + `"; filename*=UTF-8''` + encodeRFC5987(filename)
+}
+
+// asciiFilename replaces everything that is not safe inside a quoted-string
+// for legacy clients.
+func asciiFilename(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r == '"' || r == '\\' || r == '/' || r < 0x20 || r == 0x7f:
+			b.WriteByte('_')
+		case r > 0x7e:
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// encodeRFC5987 percent-encodes every byte outside RFC 5987 attr-char.
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "_")
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+//
+// 🔹 Helper: Set filename, type and hardening headers for user content
+//
+// Uploaded files are untrusted: nosniff stops browsers guessing a more
+// dangerous type, and the CSP limits who may frame them and sandboxes
+// anything that could run scripts. Inline is only honoured for
+// inlineSafeTypes.
+//
+func setContentHeaders(w http.ResponseWriter, filename, storedType string, wantInline bool) {
+	contentType := downloadContentType(storedType)
+
+	kind := "attachment"
+	if wantInline && isInlineSafe(contentType) {
+		kind = "inline"
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Disposition", contentDisposition(kind, filename))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", contentSecurityPolicy(contentType, config.Get().Server.ClientOrigin))
+	h.Set("Referrer-Policy", "no-referrer")
+}
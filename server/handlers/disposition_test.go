@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentSecurityPolicy(t *testing.T) {
+	tests := []struct {
+		contentType string
+		origin      string
+		sandboxed   bool
+		ancestors   string
+	}{
+		{"application/pdf", "", false, "frame-ancestors 'self'"},
+		{"image/png", "https://app.example.com/", false, "frame-ancestors 'self' https://app.example.com"},
+		{"video/mp4", "https://app.example.com", false, "frame-ancestors 'self' https://app.example.com"},
+		{"text/html; charset=utf-8", "", true, "frame-ancestors 'self'"},
+		{"image/svg+xml", "https://app.example.com", true, "frame-ancestors 'self' https://app.example.com"},
+		{"application/xml", "", true, "frame-ancestors 'self'"},
+		{"not a type", "", true, "frame-ancestors 'self'"},
+	}
+	for _, tt := range tests {
+		csp := contentSecurityPolicy(tt.contentType, tt.origin)
+		if strings.Contains(csp, "sandbox") != tt.sandboxed || !strings.HasSuffix(csp, tt.ancestors) {
+			t.Errorf("%s with origin %q: %q", tt.contentType, tt.origin, csp)
+		}
+	}
+}
+
+func TestSetContentHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	setContentHeaders(w, "report.pdf", "application/pdf", true)
+	h := w.Header()
+	if h.Get("X-Frame-Options") != "" {
+		t.Errorf("X-Frame-Options = %q, want none", h.Get("X-Frame-Options"))
+	}
+	if got := h.Get("Content-Disposition"); !strings.HasPrefix(got, "inline;") {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if csp := h.Get("Content-Security-Policy"); strings.Contains(csp, "sandbox") || !strings.Contains(csp, "frame-ancestors") {
+		t.Errorf("Content-Security-Policy = %q", csp)
+	}
+}
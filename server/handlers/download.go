@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/store"
+)
+
+//
+// 🔹 Helper: Write a blob's content honouring conditional and Range headers
+//
+// Sets ETag (the blob hash) and Last-Modified (file_blobs.created_at), then
+// answers 304, 416, 206 (single range or multipart/byteranges) or 200.
+// Content-Type and Content-Disposition must already be set on w. Returns
+// the body bytes written and whether the response starts at byte 0, i.e.
+// counts as a download rather than a seek or resume.
+//
+func (h *Handlers) serveBlob(w http.ResponseWriter, r *http.Request, b store.Blob) (int64, bool, error) {
+	etag := `"` + b.Hash + `"`
+	lastModified := b.CreatedAt.UTC()
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Cache-Control", "private, no-cache")
+
+	if notModified(r, etag, lastModified) {
+		header.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return 0, false, nil
+	}
+
+	var ranges []httpRange
+	if rangeApplies(r, etag, lastModified) {
+		var err error
+		ranges, err = parseRange(r.Header.Get("Range"), b.Size)
+		if err == errUnsatisfiableRange {
+			header.Set("Content-Range", "bytes */"+strconv.FormatInt(b.Size, 10))
+			header.Del("Content-Disposition")
+			writeError(w, r, codeRangeInvalid, "Requested range not satisfiable")
+			return 0, false, nil
+		}
+	}
+
+	// Reads are bounded by the client: a slow download must not be cut off
+	// by a fixed deadline, but it stops when the client goes away.
+	ctx := r.Context()
+
+	switch len(ranges) {
+	case 0, 1:
+		status := http.StatusOK
+		rg := httpRange{start: 0, length: b.Size}
+		if len(ranges) == 1 {
+			status = http.StatusPartialContent
+			rg = ranges[0]
+			header.Set("Content-Range", rg.contentRange(b.Size))
+		}
+		header.Set("Content-Length", strconv.FormatInt(rg.length, 10))
+		if r.Method == http.MethodHead {
+			w.WriteHeader(status)
+			return 0, false, nil
+		}
+
+		// Open before writing the status so storage errors can still be
+		// reported as a 500.
+		body, cancel, err := h.openBlobRange(ctx, b, rg)
+		if err != nil {
+			header.Del("Content-Length")
+			header.Del("Content-Range")
+			header.Del("Content-Disposition")
+			writeError(w, r, codeInternal, "Download failed")
+			return 0, false, err
+		}
+		defer cancel()
+		defer body.Close()
+
+		w.WriteHeader(status)
+		n, err := io.CopyN(w, body, rg.length)
+		return n, rg.start == 0, err
+
+	default:
+		contentType := header.Get("Content-Type")
+		mw := multipart.NewWriter(w)
+		header.Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method == http.MethodHead {
+			return 0, false, nil
+		}
+
+		var total int64
+		for _, rg := range ranges {
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":  {contentType},
+				"Content-Range": {rg.contentRange(b.Size)},
+			})
+			if err != nil {
+				return total, false, err
+			}
+			n, err := h.copyBlobRange(ctx, part, b, rg)
+			total += n
+			if err != nil {
+				return total, false, err
+			}
+		}
+		return total, ranges[0].start == 0, mw.Close()
+	}
+}
+
+// openBlobRange opens one range of a blob on the storage backend. The
+// returned cancel func must be called once the body is consumed.
+func (h *Handlers) openBlobRange(ctx context.Context, b store.Blob, rg httpRange) (io.ReadCloser, context.CancelFunc, error) {
+	if rg.length == 0 {
+		return io.NopCloser(strings.NewReader("")), func() {}, nil
+	}
+	openCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	body, err := h.openBlob(openCtx, b, rg.start, rg.end())
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("open range %d-%d: %w", rg.start, rg.end(), err)
+	}
+	return body, cancel, nil
+}
+
+// copyBlobRange streams one range of a blob from the storage backend.
+func (h *Handlers) copyBlobRange(ctx context.Context, w io.Writer, b store.Blob, rg httpRange) (int64, error) {
+	body, cancel, err := h.openBlobRange(ctx, b, rg)
+	if err != nil {
+		return 0, err
+	}
+	defer cancel()
+	defer body.Close()
+
+	return io.CopyN(w, body, rg.length)
+}
@@ -1,397 +1,587 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
+	"mime/multipart"
 	"net/http"
-	"path/filepath"
+	"os"
 	"time"
 
 	"github.com/google/uuid"
-	"server/db"
+	"go.opentelemetry.io/otel/attribute"
+	"server/logging"
+	"server/metrics"
+	"server/scanner"
+	"server/store"
+	"server/tracing"
 	"server/utils"
 )
 
-//
-// 🔹 Helper: Ensure user exists and return user_id
-//
-func ensureUser(ctx context.Context, email string) (int, error) {
-    var userID int
-    err := db.DB.QueryRow(ctx,
-        `INSERT INTO users (email) VALUES ($1)
-         ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email
-         RETURNING id`,
-        email,
-    ).Scan(&userID)
-    if err != nil {
-        return 0, fmt.Errorf("failed to ensure user: %w", err)
-    }
-
-    // Ensure user_stats row exists too
-    _, err = db.DB.Exec(ctx, `
-        INSERT INTO user_stats (user_id, files_count, storage_used, uploads_this_month, downloads_this_month, deduplication_savings, last_active)
-        VALUES ($1, 0, 0, 0, 0, 0, NOW())
-        ON CONFLICT (user_id) DO NOTHING
-    `, userID)
-    if err != nil {
-        return 0, fmt.Errorf("failed to ensure user_stats: %w", err)
-    }
-
-    return userID, nil
+// ✅ Response to a successful upload
+type UploadResponse struct {
+	Message    string `json:"message"`
+	ID         int    `json:"id"` // user_files id
+	FileName   string `json:"fileName"`
+	Size       int64  `json:"size"`
+	MimeType   string `json:"mimeType"`
+	S3Key      string `json:"s3Key"`
+	Hash       string `json:"hash"`
+	Duplicate  bool   `json:"duplicate"`
+	ScanStatus string `json:"scanStatus"`
 }
 
+// ✅ One file in a user's listing
+type FileInfo struct {
+	ID              int        `json:"id"`
+	FileName        string     `json:"fileName"`
+	Size            int64      `json:"size"`
+	MimeType        string     `json:"mimeType"`
+	UploadDate      time.Time  `json:"uploadDate"`
+	Hash            string     `json:"hash"`
+	S3Key           string     `json:"s3Key"`
+	RefCount        int        `json:"refCount"`
+	ScanStatus      string     `json:"scanStatus"`
+	ThumbnailStatus string     `json:"thumbnailStatus"`
+	Folder          string     `json:"folder"`
+	Tags            []string   `json:"tags"`
+	IsPublic        bool       `json:"isPublic"`
+	TrashedAt       *time.Time `json:"trashedAt,omitempty"` // only in the trash listing
+}
 
 //
 // 🔹 UploadFile (deduplication + stats)
 //
-func UploadFile(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) UploadFile(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	if username == "" {
-		log.Printf("❌ Upload failed | missing username")
-		http.Error(w, "username is required", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "upload failed: missing username")
+		writeError(w, r, codeInvalidRequest, "username is required")
 		return
 	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
-		log.Printf("❌ Upload failed | user=%s | error reading file: %v", username, err)
-		http.Error(w, "Invalid file", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "upload failed: invalid file", "user", username, "error", err)
+		writeError(w, r, codeInvalidRequest, "Invalid file")
 		return
 	}
 	defer file.Close()
 
-	// Read file bytes (for hashing + S3 upload)
-	fileBytes, err := io.ReadAll(file)
+	// Hash the file; it is read again for the S3 upload
+	up, err := readUpload(r.Context(), file, header.Filename, header.Header.Get("Content-Type"))
 	if err != nil {
-		log.Printf("❌ Upload failed | user=%s | error reading file bytes: %v", username, err)
-		http.Error(w, "File read error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "upload failed: read file", "user", username, "error", err)
+		writeError(w, r, codeInternal, "File read error")
 		return
 	}
+	defer up.Close()
 
-	// Compute SHA256 hash
-	h := sha256.New()
-	h.Write(fileBytes)
-	hash := hex.EncodeToString(h.Sum(nil))
-
-	// Reset reader for S3
-	fileReader := io.NopCloser(bytes.NewReader(fileBytes))
-
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	// Handlers keep the request's trace but not its cancellation, so a
+	// client that hangs up cannot leave the bookkeeping half done.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 15*time.Second)
 	defer cancel()
 
 	// Ensure user exists
-	userID, err := ensureUser(ctx, username)
+	user, err := h.store.Users.Ensure(ctx, username)
 	if err != nil {
-		log.Printf("❌ Upload failed | ensureUser | %v", err)
-		http.Error(w, "User creation failed", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "upload failed: ensure user", "user", username, "error", err)
+		writeError(w, r, codeInternal, "User creation failed")
 		return
 	}
+	logging.SetUserID(ctx, user.ID)
 
-	var blobID int
-	var s3Key string
-	isDuplicate := false
+	res, fail := h.storeUpload(ctx, user, up)
+	if fail != nil {
+		writeError(w, r, fail.code, fail.message)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, res)
+}
 
-	// 🔍 Check if blob already exists
-	err = db.DB.QueryRow(ctx, `SELECT id, s3_key FROM file_blobs WHERE hash=$1`, hash).Scan(&blobID, &s3Key)
-	if err == nil {
-		// Duplicate
-		_, _ = db.DB.Exec(ctx, `UPDATE file_blobs SET ref_count = ref_count + 1 WHERE id=$1`, blobID)
-		isDuplicate = true
-		log.Printf("⚠️ Duplicate upload | user=%s | hash=%s | blob_id=%d", username, hash, blobID)
+// upload is one received file, hashed and held where it can be read again.
+type upload struct {
+	Name        string
+	ClaimedType string      // the client's Content-Type for the file
+	Content     io.ReaderAt // Size bytes
+	Size        int64
+	Hash        string // hex SHA-256 of Content
+	close       func() error
+}
+
+// reader reads the content from the start.
+func (u upload) reader() io.Reader {
+	return io.NewSectionReader(u.Content, 0, u.Size)
+}
+
+// head returns the first bytes of the content, enough to sniff its type.
+func (u upload) head() ([]byte, error) {
+	head := make([]byte, min(u.Size, 512))
+	_, err := u.Content.ReadAt(head, 0)
+	return head, err
+}
+
+// Close releases the spooled content.
+func (u upload) Close() error {
+	if u.close == nil {
+		return nil
+	}
+	return u.close()
+}
+
+// uploadFailure is why an upload was not stored, as sent to the client.
+type uploadFailure struct {
+	code    string
+	message string
+}
+
+// readUpload hashes one file. A multipart.File from a parsed form is
+// already buffered and is read in place; anything else, such as a part
+// streamed from a multi-file upload, is spooled to a temporary file on the
+// way. The caller must Close the upload.
+func readUpload(ctx context.Context, src io.Reader, name, claimedType string) (upload, error) {
+	_, span := tracing.Tracer.Start(ctx, "read and hash upload")
+	up := upload{Name: name, ClaimedType: claimedType}
+	hash := sha256.New()
+	var err error
+	if f, ok := src.(multipart.File); ok {
+		up.Content = f
+		up.Size, err = io.Copy(hash, io.NewSectionReader(f, 0, math.MaxInt64))
 	} else {
-		// New file → upload to S3
-		s3Key = fmt.Sprintf("blobs/%s-%s", hash, uuid.New().String())
-		log.Printf("➡️ Uploading new blob to S3 | user=%s | key=%s", username, s3Key)
+		up, err = spoolUpload(up, src, hash)
+	}
+	if err != nil {
+		tracing.End(span, err)
+		return upload{}, err
+	}
+	up.Hash = hex.EncodeToString(hash.Sum(nil))
+	span.SetAttributes(attribute.Int64("upload.bytes", up.Size))
+	span.End()
+	return up, nil
+}
 
-		if err := utils.UploadToS3(fileReader, s3Key); err != nil {
-			log.Printf("❌ S3 upload failed | user=%s | key=%s | error=%v", username, s3Key, err)
-			http.Error(w, "S3 upload failed: "+err.Error(), http.StatusInternalServerError)
-			return
+// spoolUpload copies src to a temporary file, and to hash, as it arrives.
+func spoolUpload(up upload, src io.Reader, hash io.Writer) (upload, error) {
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return up, err
+	}
+	up.close = func() error {
+		err := tmp.Close()
+		if rmErr := os.Remove(tmp.Name()); rmErr != nil {
+			return rmErr
 		}
-		log.Printf("✅ S3 upload success | user=%s | key=%s", username, s3Key)
-
-		// Insert blob record
-		err = db.DB.QueryRow(ctx,
-			`INSERT INTO file_blobs (hash, s3_key, size, mime_type) 
-			 VALUES ($1, $2, $3, $4) RETURNING id`,
-			hash, s3Key, header.Size, header.Header.Get("Content-Type"),
-		).Scan(&blobID)
+		return err
+	}
+	if up.Size, err = io.Copy(io.MultiWriter(tmp, hash), src); err != nil {
+		_ = up.close()
+		return upload{}, err
+	}
+	up.Content = tmp
+	return up, nil
+}
+
+// storeUpload checks, deduplicates, stores and records one file for user.
+// Failures are logged here; the caller only reports them.
+func (h *Handlers) storeUpload(ctx context.Context, user store.User, up upload) (UploadResponse, *uploadFailure) {
+	username, userID, hash := user.Email, user.ID, up.Hash
+	size := up.Size
+
+	// 🔎 Content type: sniff the bytes, compare with the client's claim and
+	// apply the user's plan policy
+	head, err := up.head()
+	if err != nil {
+		slog.ErrorContext(ctx, "upload failed: read file", "user", username, "error", err)
+		return UploadResponse{}, &uploadFailure{codeInternal, "File read error"}
+	}
+	fileType := resolveType(up.ClaimedType, utils.DetectMIME(head))
+	if reason := uploadTypePolicy(user.Plan).checkType(fileType); reason != "" {
+		slog.WarnContext(ctx, "upload rejected: content type", "user", username, "plan", user.Plan,
+			"claimed", fileType.Claimed, "detected", fileType.Detected, "reason", reason)
+		return UploadResponse{}, &uploadFailure{codeUnsupportedType, reason}
+	}
+
+	// 🔍 Check if blob already exists
+	blob, lookupErr := h.store.Blobs.ByHash(ctx, hash)
+	if lookupErr != nil && !errors.Is(lookupErr, store.ErrNotFound) {
+		slog.ErrorContext(ctx, "upload failed: blob lookup", "user", username, "error", lookupErr)
+		return UploadResponse{}, &uploadFailure{codeInternal, "Blob lookup failed"}
+	}
+	isDuplicate := lookupErr == nil
+	physicalAdded := size
+
+	// ☣️ Known malware is not stored again under a new name
+	if isDuplicate && blob.ScanStatus == scanner.StatusInfected {
+		slog.WarnContext(ctx, "upload rejected: quarantined content", "user", username, "hash", hash, "blob_id", blob.ID)
+		return UploadResponse{}, &uploadFailure{codeQuarantined, "File is quarantined: malware detected"}
+	}
+
+	// 📏 Storage quota
+	ok, err := h.checkQuota(ctx, userID, size, blob.RefCount)
+	if err != nil {
+		slog.ErrorContext(ctx, "upload failed: quota check", "user", username, "error", err)
+		return UploadResponse{}, &uploadFailure{codeInternal, "Quota check failed"}
+	}
+	if !ok {
+		slog.WarnContext(ctx, "upload rejected: quota exceeded", "user", username, "size", size)
+		return UploadResponse{}, &uploadFailure{codeQuotaExceeded, "Storage quota exceeded"}
+	}
+
+	var chunks []store.Chunk
+	if isDuplicate {
+		physicalAdded = 0
+		slog.InfoContext(ctx, "duplicate upload", "user", username, "hash", hash, "blob_id", blob.ID)
+	} else if dedupMode() == store.StorageModeChunked {
+		// New file → split into content-defined chunks
+		blob.StorageMode = store.StorageModeChunked
+		blob.S3Key, chunks, err = h.storeChunkedBlob(ctx, hash, up)
 		if err != nil {
-			log.Printf("❌ DB insert failed (file_blobs) | user=%s | error=%v", username, err)
-			http.Error(w, "DB insert failed: "+err.Error(), http.StatusInternalServerError)
-			return
+			slog.ErrorContext(ctx, "chunked upload failed", "user", username, "error", err)
+			return UploadResponse{}, &uploadFailure{codeInternal, "Chunked upload failed"}
 		}
-		log.Printf("✅ DB insert success (file_blobs) | blob_id=%d | hash=%s", blobID, hash)
+	} else {
+		// New file → upload to S3
+		blob.StorageMode = store.StorageModeFile
+		blob.S3Key = fmt.Sprintf("blobs/%s-%s", hash, uuid.New().String())
+		slog.DebugContext(ctx, "uploading new blob to S3", "user", username, "key", blob.S3Key)
+
+		if err := h.objects.Put(ctx, blob.S3Key, up.reader()); err != nil {
+			slog.ErrorContext(ctx, "S3 upload failed", "user", username, "key", blob.S3Key, "error", err)
+			return UploadResponse{}, &uploadFailure{codeInternal, "Storage upload failed"}
+		}
+		slog.DebugContext(ctx, "S3 upload success", "user", username, "key", blob.S3Key)
+	}
+	newBlob := !isDuplicate
+	if newBlob {
+		blob.Hash = hash
+		blob.Size = size
+		blob.MimeType = fileType.Effective
+		blob.ClaimedMimeType = fileType.Claimed
+		blob.DetectedMimeType = fileType.Detected
 	}
 
-	// Link file to user
-	_, err = db.DB.Exec(ctx,
-		`INSERT INTO user_files (user_id, blob_id, filename) VALUES ($1, $2, $3)`,
-		userID, blobID, header.Filename,
-	)
+	// 🔗 Link file to user. The reference, the blob row (with its chunk
+	// list) or ref_count bump it needs, and the file.uploaded webhook event
+	// commit together.
+	linked, err := h.store.Files.Link(ctx, store.Link{
+		UserID:    userID,
+		Email:     username,
+		FileName:  up.Name,
+		Blob:      blob,
+		NewBlob:   newBlob,
+		Duplicate: isDuplicate,
+		Chunks:    chunks,
+	})
 	if err != nil {
-		log.Printf("❌ DB insert failed (user_files) | user=%s | error=%v", username, err)
-		http.Error(w, "DB insert failed (user_files): "+err.Error(), http.StatusInternalServerError)
-		return
+		slog.ErrorContext(ctx, "DB insert failed (user_files)", "user", username, "error", err)
+		if newBlob {
+			_ = h.objects.Delete(ctx, blob.S3Key)
+		}
+		return UploadResponse{}, &uploadFailure{codeInternal, "Upload could not be recorded"}
+	}
+	blob.ID = linked.BlobID
+	if blob.StorageMode == store.StorageModeChunked && newBlob {
+		physicalAdded = linked.NewChunkBytes
+		slog.InfoContext(ctx, "chunked blob stored", "blob_id", blob.ID, "chunks", len(chunks), "new_bytes", physicalAdded)
+	}
+	slog.InfoContext(ctx, "user file reference created", "user", username, "blob_id", blob.ID, "file_id", linked.FileID, "filename", up.Name)
+
+	// 🛡️ Malware scan runs in the job worker. A duplicate reuses the existing
+	// verdict; only blobs without one (new, or a previous scan errored) are
+	// queued. The file is not downloadable until the scan comes back clean.
+	if !isDuplicate || blob.ScanStatus == scanner.StatusPending || blob.ScanStatus == scanner.StatusError {
+		blob = h.scan(ctx, blob, up.reader())
 	}
-	log.Printf("✅ User file reference created | user=%s | blob_id=%d | filename=%s", username, blobID, header.Filename)
-
-	// 📊 System stats
-	if !isDuplicate {
-		_, _ = db.DB.Exec(ctx, `
-			UPDATE system_stats
-			SET total_files = total_files + 1,
-			    total_storage = total_storage + $1,
-			    total_uploads = total_uploads + 1
-			WHERE snapshot_date = CURRENT_DATE
-		`, header.Size)
-		log.Printf("📊 System stats updated | new file | size=%d", header.Size)
+
+	// 📊 System and user stats (total_storage is physical; logical_storage
+	// and the user's storage_used count every copy, duplicates included)
+	if err := h.store.Stats.FileAdded(ctx, userID, size, physicalAdded); err != nil {
+		slog.WarnContext(ctx, "stats update failed", "user", username, "error", err)
 	} else {
-		_, _ = db.DB.Exec(ctx, `
-			UPDATE system_stats
-			SET total_uploads = total_uploads + 1,
-			    deduplication_savings = deduplication_savings + $1
-			WHERE snapshot_date = CURRENT_DATE
-		`, header.Size)
-		log.Printf("📊 System stats updated | duplicate | savings=%d", header.Size)
-	}
-
-	// 📊 User stats
-	if !isDuplicate {
-		_, _ = db.DB.Exec(ctx, `
-			INSERT INTO user_stats (user_id, files_count, storage_used, uploads_this_month, downloads_this_month, deduplication_savings, last_active)
-			VALUES ($1, 1, $2, 1, 0, 0, NOW())
-			ON CONFLICT (user_id)
-			DO UPDATE SET
-				files_count = user_stats.files_count + 1,
-				storage_used = user_stats.storage_used + EXCLUDED.storage_used,
-				uploads_this_month = user_stats.uploads_this_month + 1,
-				last_active = NOW()
-		`, userID, header.Size)
-		log.Printf("📊 User stats updated | user=%s | +file", username)
+		slog.DebugContext(ctx, "stats updated", "user", username, "duplicate", isDuplicate, "size", size)
+	}
+
+	// ♻️ Attributed storage + dedup savings (shared by every holder of the blob)
+	if err := h.store.Stats.SyncAttribution(ctx, blob.ID); err != nil {
+		slog.WarnContext(ctx, "storage attribution sync failed", "blob_id", blob.ID, "error", err)
+	}
+
+	// 📅 Monthly usage
+	if err := h.recordUsage(ctx, userID, usageDelta{Uploads: 1, UploadBytes: size}); err != nil {
+		slog.WarnContext(ctx, "usage ledger update failed", "user", username, "error", err)
+	}
+
+	// 📈 Metrics
+	metrics.UploadBytes.Add(float64(size))
+	if isDuplicate {
+		metrics.Uploads.WithLabelValues("hit").Inc()
 	} else {
-		_, _ = db.DB.Exec(ctx, `
-			UPDATE user_stats
-			SET uploads_this_month = uploads_this_month + 1,
-			    deduplication_savings = deduplication_savings + $1,
-			    last_active = NOW()
-			WHERE user_id = $2
-		`, header.Size, userID)
-		log.Printf("📊 User stats updated | user=%s | +duplicate", username)
+		metrics.Uploads.WithLabelValues("miss").Inc()
 	}
 
 	// ✅ Response
-	resp := map[string]interface{}{
-		"message":   "File uploaded successfully",
-		"fileName":  header.Filename,
-		"size":      header.Size,
-		"mimeType":  header.Header.Get("Content-Type"),
-		"s3Key":     s3Key,
-		"hash":      hash,
-		"duplicate": isDuplicate,
-	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(resp)
+	return UploadResponse{
+		Message:    "File uploaded successfully",
+		ID:         linked.FileID,
+		FileName:   up.Name,
+		Size:       size,
+		MimeType:   fileType.Effective,
+		S3Key:      blob.S3Key,
+		Hash:       hash,
+		Duplicate:  isDuplicate,
+		ScanStatus: blob.ScanStatus,
+	}, nil
 }
 
 //
 // 🔹 ListUserFiles
 //
-func ListUserFiles(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) ListUserFiles(w http.ResponseWriter, r *http.Request) {
 	username := r.URL.Query().Get("username")
 	if username == "" {
-		log.Println("❌ List files failed | missing username")
-		http.Error(w, "username is required", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "list files failed: missing username")
+		writeError(w, r, codeInvalidRequest, "username is required")
 		return
 	}
 
-	log.Printf("📂 List files | user=%s", username)
+	slog.DebugContext(r.Context(), "list files", "user", username)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
 	defer cancel()
 
-	rows, err := db.DB.Query(ctx, `
-		SELECT uf.id, uf.filename, fb.size, fb.mime_type, uf.uploaded_at, fb.hash, fb.s3_key, fb.ref_count
-		FROM user_files uf
-		JOIN file_blobs fb ON uf.blob_id = fb.id
-		JOIN users u ON uf.user_id = u.id
-		WHERE u.email = $1
-		ORDER BY uf.uploaded_at DESC
-	`, username)
+	// ?trash=true lists the trash instead
+	listFiles := h.store.Files.List
+	if r.URL.Query().Get("trash") == "true" {
+		listFiles = h.store.Files.Trash
+	}
+	list, err := listFiles(ctx, username)
 	if err != nil {
-		log.Printf("❌ Failed to list files | user=%s | error=%v", username, err)
-		http.Error(w, "Unable to list files", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "failed to list files", "user", username, "error", err)
+		writeError(w, r, codeInternal, "Unable to list files")
 		return
 	}
-	defer rows.Close()
-
-	var files []map[string]interface{}
-	for rows.Next() {
-		var (
-			id         int
-			filename   string
-			size       int64
-			mimeType   string
-			uploadedAt time.Time
-			hash       string
-			s3Key      string
-			refCount   int
-		)
-		if err := rows.Scan(&id, &filename, &size, &mimeType, &uploadedAt, &hash, &s3Key, &refCount); err == nil {
-			files = append(files, map[string]interface{}{
-				"id":         id,
-				"fileName":   filename,
-				"size":       size,
-				"mimeType":   mimeType,
-				"uploadDate": uploadedAt,
-				"hash":       hash,
-				"s3Key":      s3Key,
-				"refCount":   refCount,
-			})
-		}
+
+	files := make([]FileInfo, 0, len(list))
+	for _, f := range list {
+		files = append(files, FileInfo{
+			ID:              f.ID,
+			FileName:        f.FileName,
+			Size:            f.Blob.Size,
+			MimeType:        f.Blob.MimeType,
+			UploadDate:      f.UploadedAt,
+			Hash:            f.Blob.Hash,
+			S3Key:           f.Blob.S3Key,
+			RefCount:        f.Blob.RefCount,
+			ScanStatus:      f.Blob.ScanStatus,
+			ThumbnailStatus: f.Blob.ThumbnailStatus,
+			Folder:          f.Folder,
+			Tags:            f.Tags,
+			IsPublic:        f.Public,
+			TrashedAt:       f.TrashedAt,
+		})
 	}
-	log.Printf("✅ Listed %d files | user=%s", len(files), username)
+	slog.InfoContext(ctx, "listed files", "user", username, "files", len(files))
 
-	_ = json.NewEncoder(w).Encode(files)
+	writeJSON(w, r, http.StatusOK, files)
 }
 
 //
 // 🔹 DownloadFile
 //
-func DownloadFile(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) DownloadFile(w http.ResponseWriter, r *http.Request) {
 	key := r.URL.Query().Get("key")
 	if key == "" {
-		log.Println("❌ Download failed | missing file key")
-		http.Error(w, "file key is required", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "download failed: missing file key")
+		writeError(w, r, codeInvalidRequest, "file key is required")
 		return
 	}
 
-	log.Printf("⬇️ Download request | key=%s", key)
+	slog.DebugContext(r.Context(), "download request", "key", key)
+
+	lookupCtx, lookupCancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+	defer lookupCancel()
 
-	file, err := utils.DownloadFromS3(key)
+	blob, err := h.store.Blobs.ByKey(lookupCtx, key)
+	if errors.Is(err, store.ErrNotFound) {
+		slog.WarnContext(lookupCtx, "download failed: blob not found", "key", key)
+		writeError(w, r, codeNotFound, "File not found")
+		return
+	}
 	if err != nil {
-		log.Printf("❌ Download failed | key=%s | error=%v", key, err)
-		http.Error(w, "Download failed: "+err.Error(), http.StatusInternalServerError)
+		slog.ErrorContext(lookupCtx, "download failed: blob lookup", "key", key, "error", err)
+		writeError(w, r, codeInternal, "File lookup failed")
+		return
+	}
+
+	// 🛡️ Only blobs scanned clean are served. Pending blobs are waiting for
+	// the worker's scan job; errored ones are being retried.
+	switch blob.ScanStatus {
+	case scanner.StatusClean:
+	case scanner.StatusInfected:
+		slog.WarnContext(lookupCtx, "download blocked: blob quarantined", "key", key)
+		writeError(w, r, codeQuarantined, "File is quarantined: malware detected")
+		return
+	default:
+		slog.InfoContext(lookupCtx, "download blocked: scan pending", "key", key, "scan_status", blob.ScanStatus)
+		w.Header().Set("Retry-After", "60")
+		writeError(w, r, codeNotReady, "File has not passed malware scanning yet")
 		return
 	}
-	defer file.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// The caller's own copy decides the filename (and who the download is
+	// attributed to). Without a username, fall back to the newest copy.
+	username := r.URL.Query().Get("username")
+	holder, err := h.store.Files.Holder(lookupCtx, blob.ID, username)
+	if errors.Is(err, store.ErrNotFound) && username != "" {
+		slog.WarnContext(lookupCtx, "download failed: no such file for user", "key", key, "user", username)
+		writeError(w, r, codeNotFound, "File not found")
+		return
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		slog.ErrorContext(lookupCtx, "download failed: holder lookup", "key", key, "error", err)
+		writeError(w, r, codeInternal, "File lookup failed")
+		return
+	}
+	userID := holder.UserID
+	if userID != 0 {
+		logging.SetUserID(lookupCtx, userID)
+	}
+
+	inline := r.URL.Query().Get("disposition") == "inline"
+	setContentHeaders(w, holder.FileName, blob.MimeType, inline)
+
+	n, fullDownload, err := h.serveBlob(w, r, blob)
+	metrics.DownloadBytes.Add(float64(n))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "download failed", "key", key, "sent_bytes", n, "error", err)
+	}
+	if n == 0 && !fullDownload {
+		// 304, 416, HEAD or failed before any bytes: nothing transferred
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
 	defer cancel()
 
-	// system stats
-	_, _ = db.DB.Exec(ctx, `
-		UPDATE system_stats
-		SET total_downloads = total_downloads + 1
-		WHERE snapshot_date = CURRENT_DATE
-	`)
-	log.Printf("📊 System stats updated | +download")
+	// system stats (range requests for later parts of a file, e.g. video
+	// seeking or resumed downloads, only count towards egress)
+	downloads := 0
+	if fullDownload {
+		downloads = 1
+		if err := h.store.Stats.Downloaded(ctx); err != nil {
+			slog.WarnContext(ctx, "system stats update failed", "error", err)
+		} else {
+			slog.DebugContext(ctx, "system stats updated", "downloads", 1)
+		}
+	}
 
 	// user stats
-	var userID int
-	_ = db.DB.QueryRow(ctx, `
-		SELECT u.id
-		FROM user_files uf 
-		JOIN users u ON uf.user_id = u.id 
-		JOIN file_blobs fb ON uf.blob_id = fb.id
-		WHERE fb.s3_key=$1 LIMIT 1
-	`, key).Scan(&userID)
-
 	if userID != 0 {
-		_, _ = db.DB.Exec(ctx, `
-			UPDATE user_stats
-			SET downloads_this_month = downloads_this_month + 1,
-			    last_active = NOW()
-			WHERE user_id = $1
-		`, userID)
-		log.Printf("📊 User stats updated | user_id=%d | +download", userID)
-	}
-
-	w.Header().Set("Content-Disposition", "attachment; filename="+filepath.Base(key))
-	w.Header().Set("Content-Type", "application/octet-stream")
-	_, _ = io.Copy(w, file)
-	log.Printf("✅ Download complete | key=%s", key)
+		if err := h.recordUsage(ctx, userID, usageDelta{Downloads: downloads, EgressBytes: n}); err != nil {
+			slog.WarnContext(ctx, "usage ledger update failed", "error", err)
+		} else {
+			slog.DebugContext(ctx, "user stats updated", "downloads", downloads, "egress_bytes", n)
+		}
+	}
+
+	slog.InfoContext(ctx, "download complete", "key", key, "bytes", n)
 }
 
 //
 // 🔹 DeleteFile
 //
-func DeleteFile(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) DeleteFile(w http.ResponseWriter, r *http.Request) {
 	key := r.URL.Query().Get("key")
 	if key == "" {
-		log.Println("❌ Delete failed | missing key")
-		http.Error(w, "file key is required", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "delete failed: missing key")
+		writeError(w, r, codeInvalidRequest, "file key is required")
 		return
 	}
 
-	log.Printf("🗑️ Delete request | key=%s", key)
+	slog.DebugContext(r.Context(), "delete request", "key", key)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
 	defer cancel()
 
-	var blobID int
-	var size int64
-	var userID int
-
-	err := db.DB.QueryRow(ctx, `
-		SELECT fb.id, fb.size, COALESCE(u.id, 0) 
-		FROM file_blobs fb
-		LEFT JOIN user_files uf ON uf.blob_id = fb.id
-		LEFT JOIN users u ON uf.user_id = u.id
-		WHERE fb.s3_key=$1
-		LIMIT 1
-	`, key).Scan(&blobID, &size, &userID)
+	// Pick exactly one reference to drop: the caller's newest copy when a
+	// username is given, otherwise the newest reference to the blob.
+	username := r.URL.Query().Get("username")
+	ref, err := h.store.Files.ByKey(ctx, key, username)
+	if errors.Is(err, store.ErrNotFound) {
+		slog.WarnContext(ctx, "delete failed: file not found", "key", key)
+		writeError(w, r, codeNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "delete failed: file lookup", "key", key, "error", err)
+		writeError(w, r, codeInternal, "File lookup failed")
+		return
+	}
+	if ref.UserID != 0 {
+		logging.SetUserID(ctx, ref.UserID)
+	}
+	blobID, size := ref.Blob.ID, ref.Blob.Size
 
+	// Drop the reference, decrement ref_count and write the file.deleted
+	// webhook event in one transaction
+	refCount, err := h.store.Files.Unlink(ctx, ref)
 	if err != nil {
-		log.Printf("❌ Delete failed | key=%s | error=%v", key, err)
-		http.Error(w, "File not found", http.StatusNotFound)
+		slog.ErrorContext(ctx, "delete failed", "key", key, "error", err)
+		writeError(w, r, codeInternal, "Delete failed")
 		return
 	}
+	slog.InfoContext(ctx, "deleted user reference", "blob_id", blobID, "file_id", ref.FileID)
 
-	// remove user reference
-	_, _ = db.DB.Exec(ctx, `DELETE FROM user_files WHERE blob_id=$1 AND user_id=$2`, blobID, userID)
-	log.Printf("✅ Deleted user reference | user_id=%d | blob_id=%d", userID, blobID)
+	var physicalFreed int64
+	if refCount <= 0 {
+		physicalFreed = h.releaseBlob(ctx, ref.Blob)
+	}
 
-	// decrement ref_count
-	var refCount int
-	_ = db.DB.QueryRow(ctx,
-		`UPDATE file_blobs SET ref_count=ref_count-1 WHERE id=$1 RETURNING ref_count`,
-		blobID,
-	).Scan(&refCount)
+	// ♻️ Remaining holders' share of the blob changed
+	if err := h.store.Stats.SyncAttribution(ctx, blobID, ref.UserID); err != nil {
+		slog.WarnContext(ctx, "storage attribution sync failed", "blob_id", blobID, "error", err)
+	}
 
-	if refCount <= 0 {
-		log.Printf("⚠️ No more references | blob_id=%d | deleting blob", blobID)
-		_ = utils.DeleteFromS3(key)
-		_, _ = db.DB.Exec(ctx, `DELETE FROM file_blobs WHERE id=$1`, blobID)
-		log.Printf("✅ Blob deleted | blob_id=%d", blobID)
-	}
-
-	// 📊 stats update
-	_, _ = db.DB.Exec(ctx, `
-		UPDATE system_stats
-		SET total_files = GREATEST(total_files - 1, 0),
-		    total_storage = GREATEST(total_storage - $1, 0)
-		WHERE snapshot_date = CURRENT_DATE
-	`, size)
-	log.Printf("📊 System stats updated | -file | -%d bytes", size)
-
-	_, _ = db.DB.Exec(ctx, `
-		UPDATE user_stats
-		SET files_count = GREATEST(files_count - 1, 0),
-		    storage_used = GREATEST(storage_used - $1, 0),
-		    last_active = NOW()
-		WHERE user_id = $2
-	`, size, userID)
-	log.Printf("📊 User stats updated | user_id=%d | -file | -%d bytes", userID, size)
-
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"message": "File deleted successfully",
-	})
-	log.Printf("✅ Delete complete | key=%s | user_id=%d", key, userID)
+	// 📊 stats update (physical bytes only go away with the last reference)
+	if err := h.store.Stats.FileRemoved(ctx, ref.UserID, size, physicalFreed); err != nil {
+		slog.WarnContext(ctx, "stats update failed", "error", err)
+	} else {
+		slog.DebugContext(ctx, "stats updated", "files", -1, "logical_bytes", -size, "physical_bytes", -physicalFreed)
+	}
+
+	writeJSON(w, r, http.StatusOK, MessageResponse{Message: "File deleted successfully"})
+	slog.InfoContext(ctx, "delete complete", "key", key)
+}
+
+//
+// 🔹 Helper: remove a blob whose last reference is gone
+//
+// Deletes its content (the object, or the chunks no other blob uses), its
+// row and anything derived from it. Failures are only logged: the reference
+// is already gone. Returns the physical bytes freed.
+//
+func (h *Handlers) releaseBlob(ctx context.Context, b store.Blob) int64 {
+	slog.InfoContext(ctx, "no more references, deleting blob", "blob_id", b.ID)
+	freed := b.Size
+	if b.StorageMode == store.StorageModeChunked {
+		var err error
+		if freed, err = h.store.Chunks.Release(ctx, b.ID); err != nil {
+			slog.WarnContext(ctx, "chunk release failed", "blob_id", b.ID, "error", err)
+		} else {
+			slog.InfoContext(ctx, "chunks released", "blob_id", b.ID, "freed_bytes", freed)
+		}
+	}
+	_ = h.objects.Delete(ctx, b.S3Key)
+	if err := h.store.Blobs.Delete(ctx, b.ID); err != nil {
+		slog.WarnContext(ctx, "blob row delete failed", "blob_id", b.ID, "error", err)
+	}
+	h.purgeDerived(ctx, b.Hash)
+	slog.InfoContext(ctx, "blob deleted", "blob_id", b.ID)
+	return freed
 }
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"server/scanner"
+	"server/store"
+	"server/utils"
+)
+
+var (
+	content10 = []byte("0123456789")
+	other10   = []byte("abcdefghij")
+)
+
+// wantUser compares a user's books with the expected logical bytes,
+// attributed (physical) bytes and file count.
+func wantUser(t *testing.T, env *testEnv, userID int, files int, logical, physical int64) {
+	t.Helper()
+	s := env.mem.UserStats(userID)
+	if s.FilesCount != files || s.StorageUsed != logical || s.AttributedStorage != physical {
+		t.Errorf("user %d: files=%d logical=%d physical=%d, want %d %d %d",
+			userID, s.FilesCount, s.StorageUsed, s.AttributedStorage, files, logical, physical)
+	}
+	if want := logical - physical; s.DeduplicationSavings != want {
+		t.Errorf("user %d: dedup savings %d, want %d", userID, s.DeduplicationSavings, want)
+	}
+}
+
+// wantSystem compares the system totals.
+func wantSystem(t *testing.T, env *testEnv, files int, logical, physical int64) {
+	t.Helper()
+	s := env.mem.SystemStats()
+	if s.TotalFiles != files || s.LogicalStorage != logical || s.TotalStorage != physical {
+		t.Errorf("system: files=%d logical=%d physical=%d, want %d %d %d",
+			s.TotalFiles, s.LogicalStorage, s.TotalStorage, files, logical, physical)
+	}
+}
+
+func TestUploadFirstCopy(t *testing.T) {
+	env := newTestEnv(t)
+	res := env.mustUpload(t, "a@example.com", "a.txt", content10)
+	if res.Duplicate || res.Size != 10 || res.FileName != "a.txt" {
+		t.Errorf("response = %+v", res)
+	}
+
+	b, ok := env.blob(t, res.S3Key)
+	if !ok || b.RefCount != 1 || b.Size != 10 || b.StorageMode != store.StorageModeFile {
+		t.Errorf("blob = %+v, exists %v", b, ok)
+	}
+	if data, ok := env.objects.Get(res.S3Key); !ok || !bytes.Equal(data, content10) {
+		t.Errorf("object %q = %q, exists %v", res.S3Key, data, ok)
+	}
+	wantUser(t, env, env.user(t, "a@example.com"), 1, 10, 10)
+	wantSystem(t, env, 1, 10, 10)
+
+	events := env.mem.Events()
+	if len(events) != 1 || events[0].Type != store.EventFileUploaded || events[0].Data.FileID != res.ID {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestUploadDuplicate(t *testing.T) {
+	env := newTestEnv(t)
+	first := env.mustUpload(t, "a@example.com", "a.txt", content10)
+	second := env.mustUpload(t, "b@example.com", "copy.txt", content10)
+
+	if !second.Duplicate || second.S3Key != first.S3Key {
+		t.Errorf("second upload = %+v, want a duplicate of %s", second, first.S3Key)
+	}
+	if b, _ := env.blob(t, first.S3Key); b.RefCount != 2 {
+		t.Errorf("ref_count = %d, want 2", b.RefCount)
+	}
+	// Each holder is charged half the blob
+	wantUser(t, env, env.user(t, "a@example.com"), 1, 10, 5)
+	wantUser(t, env, env.user(t, "b@example.com"), 1, 10, 5)
+	wantSystem(t, env, 2, 20, 10)
+
+	// The same user uploading the same content again is a duplicate too
+	third := env.mustUpload(t, "a@example.com", "again.txt", content10)
+	if !third.Duplicate {
+		t.Error("third upload is not a duplicate")
+	}
+	wantSystem(t, env, 3, 30, 10)
+}
+
+func TestDeleteSharedBlob(t *testing.T) {
+	env := newTestEnv(t)
+	first := env.mustUpload(t, "a@example.com", "a.txt", content10)
+	env.mustUpload(t, "b@example.com", "copy.txt", content10)
+
+	if w := env.delete(t, "b@example.com", first.S3Key); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+
+	// The blob stays for the remaining holder, who is now charged all of it
+	b, ok := env.blob(t, first.S3Key)
+	if !ok || b.RefCount != 1 {
+		t.Fatalf("blob = %+v, exists %v; want ref_count 1", b, ok)
+	}
+	if _, ok := env.objects.Get(first.S3Key); !ok {
+		t.Error("object deleted while still referenced")
+	}
+	if len(env.purged) != 0 {
+		t.Errorf("derived content purged for a live blob: %v", env.purged)
+	}
+	wantUser(t, env, env.user(t, "a@example.com"), 1, 10, 10)
+	wantUser(t, env, env.user(t, "b@example.com"), 0, 0, 0)
+	wantSystem(t, env, 1, 10, 10)
+
+	events := env.mem.Events()
+	if last := events[len(events)-1]; last.Type != store.EventFileDeleted || last.Data.Email != "b@example.com" {
+		t.Errorf("last event = %+v", last)
+	}
+}
+
+func TestDeleteLastReference(t *testing.T) {
+	env := newTestEnv(t)
+	res := env.mustUpload(t, "a@example.com", "a.txt", content10)
+
+	if w := env.delete(t, "a@example.com", res.S3Key); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if _, ok := env.blob(t, res.S3Key); ok {
+		t.Error("blob row left behind")
+	}
+	if _, ok := env.objects.Get(res.S3Key); ok {
+		t.Error("object left behind")
+	}
+	if len(env.purged) != 1 || env.purged[0] != res.Hash {
+		t.Errorf("purged = %v, want [%s]", env.purged, res.Hash)
+	}
+	wantUser(t, env, env.user(t, "a@example.com"), 0, 0, 0)
+	wantSystem(t, env, 0, 0, 0)
+
+	if w := env.delete(t, "a@example.com", res.S3Key); w.Code != http.StatusNotFound {
+		t.Errorf("second delete: %d, want 404", w.Code)
+	}
+}
+
+func TestUploadQuota(t *testing.T) {
+	env := newTestEnv(t)
+	setStoragePolicy(t, storagePolicy{QuotaBasis: storageLogical, BillingBasis: storageLogical, QuotaBytes: 15})
+
+	env.mustUpload(t, "a@example.com", "a.txt", content10)
+	w := env.upload(t, "a@example.com", "b.txt", "text/plain", other10)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("over quota: %d %s", w.Code, w.Body)
+	}
+	var e ErrorResponse
+	decode(t, w, &e)
+	if e.Error.Code != codeQuotaExceeded {
+		t.Errorf("code = %q, want %q", e.Error.Code, codeQuotaExceeded)
+	}
+	// Nothing of the rejected file was kept
+	wantUser(t, env, env.user(t, "a@example.com"), 1, 10, 10)
+	wantSystem(t, env, 1, 10, 10)
+}
+
+func TestUploadQuotaPhysical(t *testing.T) {
+	env := newTestEnv(t)
+	setStoragePolicy(t, storagePolicy{QuotaBasis: storagePhysical, BillingBasis: storagePhysical, QuotaBytes: 15})
+
+	env.mustUpload(t, "b@example.com", "shared.txt", other10)
+	env.mustUpload(t, "a@example.com", "a.txt", content10)
+	// A second copy of shared content only costs a's share of it (5 bytes)
+	env.mustUpload(t, "a@example.com", "shared.txt", other10)
+	wantUser(t, env, env.user(t, "a@example.com"), 2, 20, 15)
+
+	if w := env.upload(t, "a@example.com", "c.txt", "text/plain", []byte("0")); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("over physical quota: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestUploadInfectedDuplicate(t *testing.T) {
+	env := newTestEnv(t)
+	setStoragePolicy(t, storagePolicy{QuotaBasis: storageLogical, BillingBasis: storageLogical, QuotaBytes: 15})
+	first := env.mustUpload(t, "a@example.com", "a.txt", content10)
+	blob, _ := env.blob(t, first.S3Key)
+	env.mem.SetScanStatus(blob.ID, scanner.StatusInfected)
+
+	// Rejected as quarantined even though a is also over quota
+	for _, user := range []string{"a@example.com", "b@example.com"} {
+		w := env.upload(t, user, "renamed.txt", "text/plain", content10)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("%s: %d %s", user, w.Code, w.Body)
+		}
+		var e ErrorResponse
+		decode(t, w, &e)
+		if e.Error.Code != codeQuarantined {
+			t.Errorf("%s: code = %q, want %q", user, e.Error.Code, codeQuarantined)
+		}
+	}
+	if b, _ := env.blob(t, first.S3Key); b.RefCount != 1 {
+		t.Errorf("ref_count = %d, want 1", b.RefCount)
+	}
+	wantSystem(t, env, 1, 10, 10)
+
+	w := httptest.NewRecorder()
+	env.h.UploadFiles(w, multiUpload(t, "b@example.com", map[string]string{"x.txt": string(content10), "y.txt": "y"}))
+	var res MultiUploadResponse
+	decode(t, w, &res)
+	if w.Code != http.StatusMultiStatus || res.Rejected != 1 {
+		t.Fatalf("multi-upload: %d %s", w.Code, w.Body)
+	}
+	for _, r := range res.Results {
+		if r.FileName == "x.txt" && r.Code != codeQuarantined {
+			t.Errorf("x.txt: %+v", r)
+		}
+	}
+}
+
+// Multi-upload parts are spooled to temporary files, which are gone once
+// the request is answered, and stored intact in either dedup mode.
+func TestUploadFilesSpoolsParts(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	for _, mode := range []string{"file", "chunk"} {
+		env := newTestEnv(t)
+		setDedupMode(t, mode)
+		big := text(5, 3*utils.ChunkMaxSize)
+
+		w := httptest.NewRecorder()
+		env.h.UploadFiles(w, multiUpload(t, "a@example.com", map[string]string{"big.txt": string(big), "small.txt": "small"}))
+		var res MultiUploadResponse
+		decode(t, w, &res)
+		if w.Code != http.StatusOK || res.Stored != 2 {
+			t.Fatalf("%s: multi-upload: %d %s", mode, w.Code, w.Body)
+		}
+		if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+			t.Errorf("%s: %d temporary files left behind", mode, len(entries))
+		}
+
+		for _, r := range res.Results {
+			if r.FileName != "big.txt" {
+				continue
+			}
+			if r.File.Size != int64(len(big)) || r.File.Hash != hashOf(big) {
+				t.Errorf("%s: big.txt stored as %+v", mode, r.File)
+			}
+			blob, _ := env.blob(t, r.File.S3Key)
+			env.mem.SetScanStatus(blob.ID, scanner.StatusClean)
+			dw := httptest.NewRecorder()
+			env.h.DownloadFile(dw, httptest.NewRequest(http.MethodGet, "/download?key="+r.File.S3Key, nil))
+			if !bytes.Equal(dw.Body.Bytes(), big) {
+				t.Errorf("%s: big.txt downloads as %d bytes, want %d", mode, dw.Body.Len(), len(big))
+			}
+		}
+	}
+}
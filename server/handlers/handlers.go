@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"io"
+
+	"server/jobs"
+	"server/store"
+)
+
+//
+// 🔹 Handlers: the file routes and the jobs behind them
+//
+// Users, files, blobs, chunks, storage accounting and the admin reports go
+// through the injected store, and blob content through objects, so the
+// upload/download/delete logic can run against store.NewMemory and
+// store.MemoryObjects (see the _test.go files). Not everything goes through
+// it yet: scan verdicts, thumbnails, search, webhooks, jobs and health
+// checks still use the db package directly.
+//
+type Handlers struct {
+	store   *store.Store
+	objects store.Objects
+
+	// scan queues (or records) a new blob's malware scan; purgeDerived
+	// removes what was generated from a deleted blob's content. Both touch
+	// Postgres directly, so tests on the memory store replace them.
+	scan         func(ctx context.Context, b store.Blob, content io.Reader) store.Blob
+	purgeDerived func(ctx context.Context, hash string)
+}
+
+func New(s *store.Store, objects store.Objects) *Handlers {
+	h := &Handlers{
+		store:        s,
+		objects:      objects,
+		purgeDerived: deleteThumbnails,
+	}
+	h.scan = h.queueScan
+	return h
+}
+
+// WriteEvent is the store.Outbox for webhook events: see emitEvent.
+func WriteEvent(ctx context.Context, q jobs.Querier, eventType string, userID int, data interface{}) error {
+	return emitEvent(ctx, q, eventType, userID, data)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"server/store"
+)
+
+// testEnv is a Handlers on the memory store, with the hooks that reach
+// Postgres replaced.
+type testEnv struct {
+	h       *Handlers
+	mem     *store.Memory
+	objects *store.MemoryObjects
+	purged  []string // hashes passed to purgeDerived
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	s, mem := store.NewMemory()
+	env := &testEnv{mem: mem, objects: &store.MemoryObjects{}}
+	env.h = New(s, env.objects)
+	env.h.scan = func(_ context.Context, b store.Blob, _ io.Reader) store.Blob { return b }
+	env.h.purgeDerived = func(_ context.Context, hash string) { env.purged = append(env.purged, hash) }
+	setStoragePolicy(t, storagePolicy{QuotaBasis: storageLogical, BillingBasis: storageLogical})
+	return env
+}
+
+// setStoragePolicy replaces the quota policy for the rest of the test.
+func setStoragePolicy(t *testing.T, p storagePolicy) {
+	t.Helper()
+	storagePolicyOnce.Do(func() {})
+	old := policy
+	policy = p
+	t.Cleanup(func() { policy = old })
+}
+
+// upload sends one file to UploadFile.
+func (env *testEnv) upload(t *testing.T, username, name, contentType string, content []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	env.h.UploadFile(w, uploadRequest(t, username, name, contentType, content))
+	return w
+}
+
+// uploadRequest builds a POST /upload request carrying one file.
+func uploadRequest(t *testing.T, username, name, contentType string, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("username", username)
+	part, err := mw.CreatePart(map[string][]string{
+		"Content-Disposition": {`form-data; name="file"; filename="` + name + `"`},
+		"Content-Type":        {contentType},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// mustUpload uploads a file and decodes the 200 response.
+func (env *testEnv) mustUpload(t *testing.T, username, name string, content []byte) UploadResponse {
+	t.Helper()
+	w := env.upload(t, username, name, "text/plain", content)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload %s for %s: %d %s", name, username, w.Code, w.Body)
+	}
+	var res UploadResponse
+	decode(t, w, &res)
+	return res
+}
+
+// delete sends DELETE /delete for username's copy of key.
+func (env *testEnv) delete(t *testing.T, username, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	q := url.Values{"key": {key}, "username": {username}}
+	w := httptest.NewRecorder()
+	env.h.DeleteFile(w, httptest.NewRequest(http.MethodDelete, "/delete?"+q.Encode(), nil))
+	return w
+}
+
+// user returns username's id, creating the user if needed.
+func (env *testEnv) user(t *testing.T, username string) int {
+	t.Helper()
+	u, err := env.h.store.Users.Ensure(context.Background(), username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.ID
+}
+
+// blob returns the blob stored under key, or ok=false once it is gone.
+func (env *testEnv) blob(t *testing.T, key string) (store.Blob, bool) {
+	t.Helper()
+	b, err := env.h.store.Blobs.ByKey(context.Background(), key)
+	if err == store.ErrNotFound {
+		return b, false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, true
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", w.Body, err)
+	}
+}
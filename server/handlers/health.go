@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"server/config"
+	"server/db"
+	"server/utils"
+)
+
+// Overall readiness
+const (
+	readyOK          = "ok"
+	readyDegraded    = "degraded"    // a non-critical check failed; still serving
+	readyUnavailable = "unavailable" // a critical check failed; take out of rotation
+)
+
+// Per-check status
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+var processStart = time.Now()
+
+// ✅ /healthz response
+type Liveness struct {
+	Status        string `json:"status"`
+	UptimeSeconds int64  `json:"uptimeSeconds"`
+}
+
+// ✅ Result of one dependency check
+type CheckResult struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latencyMs"`
+	Detail    string  `json:"detail,omitempty"`
+	Error     string  `json:"error,omitempty"` // unreachable, timeout or a check-specific summary
+}
+
+// ✅ /readyz response
+type ReadinessReport struct {
+	Status    string                 `json:"status"`
+	CheckedAt time.Time              `json:"checkedAt"`
+	Checks    map[string]CheckResult `json:"checks"`
+}
+
+// readinessChecks run concurrently on every /readyz. A failing critical
+// check makes the service unavailable (503); a failing non-critical one
+// only marks it degraded, since restarting or draining the API would not
+// help.
+var readinessChecks = []struct {
+	name     string
+	critical bool
+	run      func(ctx context.Context) (detail string, err error)
+}{
+	{"postgres", true, checkPostgres},
+	{"postgresReplica", true, checkReplica},
+	{"storage", true, checkStorage},
+	{"migrations", true, checkMigrations},
+	{"jobQueue", false, checkJobQueue},
+}
+
+// checkFailure is a check error that is safe to show in the /readyz body.
+// Any other error is logged and reported as unreachable or timeout, since
+// driver and SDK errors name hosts, users and buckets.
+type checkFailure string
+
+func (e checkFailure) Error() string { return string(e) }
+
+// publicError is the text /readyz shows for a check that failed with err
+// under ctx.
+func publicError(ctx context.Context, err error) string {
+	var f checkFailure
+	switch {
+	case errors.As(err, &f):
+		return string(f)
+	case errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded:
+		return "timeout"
+	default:
+		return "unreachable"
+	}
+}
+
+//
+// 🔹 Healthz: GET /healthz
+//
+// Liveness only: answers as long as the process can serve HTTP, without
+// touching any dependency.
+//
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, r, http.StatusOK, Liveness{
+		Status:        readyOK,
+		UptimeSeconds: int64(time.Since(processStart).Seconds()),
+	})
+}
+
+//
+// 🔹 Readyz: GET /readyz
+//
+// Checks every dependency the API needs and reports each one's status and
+// latency. 200 when ready (ok or degraded), 503 when unavailable.
+//
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	report := checkReadiness(r.Context())
+	code := http.StatusOK
+	if report.Status == readyUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+	writeHealth(w, r, code, report)
+}
+
+func checkReadiness(ctx context.Context) ReadinessReport {
+	report := ReadinessReport{
+		Status:    readyOK,
+		CheckedAt: time.Now().UTC(),
+		Checks:    make(map[string]CheckResult, len(readinessChecks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range readinessChecks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := c.run(checkCtx)
+			res := CheckResult{
+				Status:    checkOK,
+				Critical:  c.critical,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Detail:    detail,
+			}
+			if err != nil {
+				res.Status = checkFail
+				res.Error = publicError(checkCtx, err)
+				slog.WarnContext(ctx, "readiness check failed", "check", c.name, "critical", c.critical, "error", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = res
+			switch {
+			case err == nil:
+			case c.critical:
+				report.Status = readyUnavailable
+			case report.Status == readyOK:
+				report.Status = readyDegraded
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func writeHealth(w http.ResponseWriter, r *http.Request, code int, body interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, code, body)
+}
+
+func checkPostgres(ctx context.Context) (string, error) {
+	return pingPool(ctx, db.DB)
+}
+
+// checkReplica is skipped (reported ok) without DB_REPLICA_URL; with one,
+// analytics and listings depend on it as much as writes on the primary.
+func checkReplica(ctx context.Context) (string, error) {
+	if db.Replica == nil {
+		return "not configured; reads use the primary", nil
+	}
+	return pingPool(ctx, db.Replica)
+}
+
+func pingPool(ctx context.Context, pool *pgxpool.Pool) (string, error) {
+	if err := pool.Ping(ctx); err != nil {
+		return "", err
+	}
+	s := pool.Stat()
+	return fmt.Sprintf("%d/%d connections in use", s.AcquiredConns(), s.MaxConns()), nil
+}
+
+func checkStorage(ctx context.Context) (string, error) {
+	return "", utils.PingS3(ctx)
+}
+
+// checkMigrations fails when the database is behind this binary, i.e.
+// migrations have not been applied. A database ahead of it (a newer release
+// rolling out) is fine: migrations only add.
+func checkMigrations(ctx context.Context) (string, error) {
+	applied, latest, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	detail := fmt.Sprintf("schema version %d, binary expects %d", applied, latest)
+	if applied < latest {
+		return detail, checkFailure("database is behind: " + detail)
+	}
+	return detail, nil
+}
+
+// checkJobQueue reports how long the oldest due job has been waiting for a
+// worker. Lag above READY_MAX_QUEUE_LAG (default 15m) means workers are
+// down or overloaded.
+func checkJobQueue(ctx context.Context) (string, error) {
+	maxLag := config.Get().Server.ReadyMaxQueueLag
+
+	var queued int64
+	var lagSeconds float64
+	err := db.DB.QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(run_at)), 0)::float8
+		FROM jobs WHERE status = 'queued' AND run_at <= NOW()
+	`).Scan(&queued, &lagSeconds)
+	if err != nil {
+		return "", err
+	}
+	lag := time.Duration(lagSeconds * float64(time.Second)).Round(time.Second)
+	detail := fmt.Sprintf("%d due jobs, oldest waiting %s", queued, lag)
+	if lag > maxLag {
+		return detail, checkFailure(fmt.Sprintf("queue lag %s exceeds %s", lag, maxLag))
+	}
+	return detail, nil
+}
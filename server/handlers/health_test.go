@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadyzHidesErrors(t *testing.T) {
+	old := readinessChecks
+	t.Cleanup(func() { readinessChecks = old })
+	readinessChecks = []struct {
+		name     string
+		critical bool
+		run      func(ctx context.Context) (detail string, err error)
+	}{
+		{"postgres", true, func(context.Context) (string, error) {
+			return "", errors.New(`failed to connect to user=skyvault database=prod host=10.0.3.7: password authentication failed`)
+		}},
+		{"storage", true, func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", errors.New("operation error S3: HeadBucket, bucket skyvault-prod: " + ctx.Err().Error())
+		}},
+		{"jobQueue", false, func(context.Context) (string, error) {
+			return "3 due jobs", checkFailure("queue lag 20m0s exceeds 15m0s")
+		}},
+	}
+
+	w := httptest.NewRecorder()
+	Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d", w.Code)
+	}
+	for _, leak := range []string{"10.0.3.7", "skyvault", "password"} {
+		if strings.Contains(w.Body.String(), leak) {
+			t.Errorf("body leaks %q: %s", leak, w.Body)
+		}
+	}
+
+	var report ReadinessReport
+	decode(t, w, &report)
+	for name, want := range map[string]string{
+		"postgres": "unreachable",
+		"storage":  "timeout",
+		"jobQueue": "queue lag 20m0s exceeds 15m0s",
+	} {
+		if got := report.Checks[name].Error; got != want {
+			t.Errorf("%s error = %q, want %q", name, got, want)
+		}
+	}
+	if err := APIDocument().ValidateResponse(http.MethodGet, "/readyz", w.Code, w.Body.Bytes()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"server/config"
+	"server/db"
+	"server/jobs"
+	"server/scanner"
+	"server/store"
+)
+
+// Job types handled by the worker
+const (
+	jobScanBlob     = "scan.blob"
+	jobPurgeJobs    = "purge.jobs"
+	jobPurgeOrphans = "purge.orphan_blobs"
+	jobPurgeChunks  = "purge.chunks"
+)
+
+type scanBlobPayload struct {
+	BlobID int `json:"blob_id"`
+}
+
+type purgeJobsPayload struct {
+	SucceededDays int `json:"succeeded_days"`
+	DeadDays      int `json:"dead_days"`
+}
+
+type purgeOrphansPayload struct {
+	// Only blobs older than this are touched, so an upload that has stored
+	// its blob but not yet linked it to a user is never purged.
+	MinAgeMinutes int `json:"min_age_minutes"`
+}
+
+type purgeChunksPayload struct {
+	Limit int `json:"limit"`
+}
+
+//
+// 🔹 Register job handlers and cron schedules
+//
+// Called by both run modes: the API process only enqueues, but registering
+// everywhere keeps a single list of job types.
+//
+func (h *Handlers) RegisterJobs() error {
+	jobs.RegisterTyped(jobScanBlob, 30*time.Minute, h.runScanBlob)
+	jobs.RegisterTyped(jobPurgeJobs, 0, runPurgeJobs)
+	jobs.RegisterTyped(jobPurgeOrphans, 30*time.Minute, h.runPurgeOrphans)
+	jobs.RegisterTyped(jobPurgeChunks, 30*time.Minute, runPurgeChunks)
+	jobs.RegisterTyped(jobThumbnailBlob, 10*time.Minute, h.runThumbnailBlob)
+	jobs.RegisterTyped(jobExtractText, 10*time.Minute, h.runExtractText)
+
+	if err := registerWebhookJobs(); err != nil {
+		return err
+	}
+	if err := jobs.Schedule("purge-jobs", "15 3 * * *", jobPurgeJobs, purgeJobsPayload{
+		SucceededDays: config.Get().Jobs.RetentionDays,
+		DeadDays:      config.Get().Jobs.DeadRetentionDays,
+	}); err != nil {
+		return err
+	}
+	if err := jobs.Schedule("purge-orphan-blobs", "45 3 * * *", jobPurgeOrphans, purgeOrphansPayload{MinAgeMinutes: 60}); err != nil {
+		return err
+	}
+	return jobs.Schedule("purge-chunks", "20 * * * *", jobPurgeChunks, purgeChunksPayload{Limit: 10000})
+}
+
+//
+// 🔹 Helper: Queue a malware scan for a blob
+//
+// With scanning disabled the verdict is immediate, so it is recorded inline
+// rather than round-tripping through the queue. If the job cannot be queued
+// the blob is scanned inline from content instead of being left pending.
+//
+func (h *Handlers) queueScan(ctx context.Context, b store.Blob, content io.Reader) store.Blob {
+	if _, disabled := scanner.Default.(scanner.Noop); disabled {
+		b = recordScan(ctx, b, scanner.StatusClean, "")
+		queueDerivedWork(ctx, b)
+		return b
+	}
+	_, err := jobs.Enqueue(ctx, db.DB, jobScanBlob, scanBlobPayload{BlobID: b.ID}, jobs.Options{
+		UniqueKey: fmt.Sprintf("%s:%d", jobScanBlob, b.ID),
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "scan job not queued, scanning inline", "blob_id", b.ID, "error", err)
+		return h.scanBlob(ctx, b, content)
+	}
+	slog.DebugContext(ctx, "scan queued", "blob_id", b.ID)
+	b.ScanStatus = scanner.StatusPending
+	return b
+}
+
+func (h *Handlers) runScanBlob(ctx context.Context, p scanBlobPayload) error {
+	b, err := h.store.Blobs.ByID(ctx, p.BlobID)
+	if errors.Is(err, store.ErrNotFound) {
+		slog.WarnContext(ctx, "scan skipped, blob deleted", "blob_id", p.BlobID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if b.ScanStatus == scanner.StatusClean || b.ScanStatus == scanner.StatusInfected {
+		return nil
+	}
+	if b = h.scanBlob(ctx, b, nil); b.ScanStatus == scanner.StatusError {
+		return fmt.Errorf("scan of blob %d produced no verdict", b.ID)
+	}
+	return nil
+}
+
+func runPurgeJobs(ctx context.Context, p purgeJobsPayload) error {
+	tag, err := db.DB.Exec(ctx, `
+		DELETE FROM jobs
+		WHERE (status = 'succeeded' AND finished_at < NOW() - make_interval(days => $1))
+		   OR (status = 'dead' AND finished_at < NOW() - make_interval(days => $2))
+	`, p.SucceededDays, p.DeadDays)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "purged finished jobs", "count", tag.RowsAffected())
+	return nil
+}
+
+//
+// 🔹 Purge blobs no user references
+//
+// Deletes normally drop a blob with its last reference; this catches the
+// ones left behind when a request failed half way.
+//
+func (h *Handlers) runPurgeOrphans(ctx context.Context, p purgeOrphansPayload) error {
+	rows, err := db.DB.Query(ctx, `
+		SELECT fb.id, fb.hash, fb.s3_key, fb.size, fb.storage_mode
+		FROM file_blobs fb
+		WHERE fb.created_at < NOW() - make_interval(mins => $1)
+		  AND fb.ref_count <= 0
+		  AND NOT EXISTS (SELECT 1 FROM user_files uf WHERE uf.blob_id = fb.id)
+		ORDER BY fb.id
+		LIMIT 1000
+	`, p.MinAgeMinutes)
+	if err != nil {
+		return err
+	}
+	var orphans []store.Blob
+	for rows.Next() {
+		var b store.Blob
+		if err := rows.Scan(&b.ID, &b.Hash, &b.S3Key, &b.Size, &b.StorageMode); err != nil {
+			rows.Close()
+			return err
+		}
+		orphans = append(orphans, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var freed int64
+	purged := 0
+	for _, b := range orphans {
+		physical, ok, err := h.store.Blobs.DeleteOrphan(ctx, b)
+		if err != nil {
+			return fmt.Errorf("purge blob %d: %w", b.ID, err)
+		}
+		if !ok {
+			slog.InfoContext(ctx, "orphan blob referenced again, kept", "blob_id", b.ID)
+			continue
+		}
+		if err := h.objects.Delete(ctx, b.S3Key); err != nil {
+			slog.WarnContext(ctx, "orphan object delete failed", "key", b.S3Key, "error", err)
+		}
+		h.purgeDerived(ctx, b.Hash)
+		freed += physical
+		purged++
+		slog.InfoContext(ctx, "orphan blob purged", "blob_id", b.ID, "key", b.S3Key)
+	}
+
+	if purged > 0 {
+		if err := h.store.Stats.PhysicalFreed(ctx, freed); err != nil {
+			slog.WarnContext(ctx, "system stats update failed", "error", err)
+		}
+		if err := h.store.Stats.SyncAttribution(ctx, orphans[0].ID); err != nil {
+			slog.WarnContext(ctx, "storage attribution sync failed", "error", err)
+		}
+	}
+	slog.InfoContext(ctx, "orphan purge done", "candidates", len(orphans), "blobs", purged, "freed_bytes", freed)
+	return nil
+}
+
+//
+// 🔹 Purge chunks no blob references
+//
+// Each candidate is checked again under its row lock before its object is
+// deleted; see purgeChunk. Freed bytes were already counted on release.
+//
+func runPurgeChunks(ctx context.Context, p purgeChunksPayload) error {
+	rows, err := db.DB.Query(ctx, `
+		SELECT id FROM chunks
+		WHERE ref_count <= 0 AND gc_after < NOW()
+		ORDER BY gc_after
+		LIMIT $1
+	`, p.Limit)
+	if err != nil {
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		ok, err := purgeChunk(ctx, id)
+		if err != nil {
+			return fmt.Errorf("purge chunk %d: %w", id, err)
+		}
+		if ok {
+			purged++
+		}
+	}
+	slog.InfoContext(ctx, "chunk purge done", "candidates", len(ids), "purged", purged)
+	return nil
+}
+
+// ✅ A jobs row as shown to admins
+type JobInfo struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	LastError   *string         `json:"lastError"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	FinishedAt  *time.Time      `json:"finishedAt"`
+}
+
+//
+// 🔹 List jobs (newest first), e.g. ?status=dead for the dead-letter set
+//
+func ListJobs(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			writeError(w, r, codeInvalidRequest, "limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+
+	rows, err := db.DB.Query(ctx, `
+		SELECT id, type, payload, status, attempts, max_attempts, run_at, last_error, created_at, finished_at
+		FROM jobs
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`, r.URL.Query().Get("status"), r.URL.Query().Get("type"), limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "job list failed", "error", err)
+		writeError(w, r, codeInternal, "Failed to fetch jobs")
+		return
+	}
+	defer rows.Close()
+
+	list := []JobInfo{}
+	for rows.Next() {
+		var j JobInfo
+		if err := rows.Scan(&j.ID, &j.Type, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts,
+			&j.RunAt, &j.LastError, &j.CreatedAt, &j.FinishedAt); err != nil {
+			slog.ErrorContext(ctx, "job list scan failed", "error", err)
+			writeError(w, r, codeInternal, "Failed to fetch jobs")
+			return
+		}
+		list = append(list, j)
+	}
+
+	writeJSON(w, r, http.StatusOK, list)
+}
+
+//
+// 🔹 Requeue a dead job (?id=) with a fresh set of attempts
+//
+func RetryJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, codeInvalidRequest, "job id is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	tag, err := db.DB.Exec(ctx, `
+		UPDATE jobs
+		SET status = 'queued', attempts = 0, run_at = NOW(), finished_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'dead'
+	`, id)
+	if err != nil {
+		// A live job with the same unique_key is already queued.
+		slog.ErrorContext(ctx, "job retry failed", "job_id", id, "error", err)
+		writeError(w, r, codeConflict, "Job could not be requeued")
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		writeError(w, r, codeNotFound, "No dead job with that id")
+		return
+	}
+
+	slog.InfoContext(ctx, "job requeued by admin", "job_id", id)
+	writeJSON(w, r, http.StatusOK, MessageResponse{Message: "Job requeued"})
+}
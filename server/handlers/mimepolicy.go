@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"mime"
+	"strings"
+
+	"server/config"
+)
+
+// containerFamilies groups media types that share a container format, so
+// content sniffed as one member backs up a claim of another (an .m4a file
+// sniffs as video/mp4, a .mkv as video/webm).
+var containerFamilies = map[string]string{
+	"video/mp4": "isobmff", "audio/mp4": "isobmff", "audio/x-m4a": "isobmff", "audio/m4a": "isobmff",
+	"video/x-m4v": "isobmff", "video/quicktime": "isobmff", "video/3gpp": "isobmff",
+	"video/3gpp2": "isobmff", "audio/3gpp": "isobmff", "image/heic": "isobmff",
+	"image/heif": "isobmff", "image/heic-sequence": "isobmff", "image/heif-sequence": "isobmff",
+	"image/avif": "isobmff",
+
+	"video/webm": "matroska", "audio/webm": "matroska", "video/x-matroska": "matroska",
+	"audio/x-matroska": "matroska",
+
+	"audio/wave": "wave", "audio/wav": "wave", "audio/x-wav": "wave", "audio/vnd.wave": "wave",
+
+	"application/ogg": "ogg", "audio/ogg": "ogg", "video/ogg": "ogg", "audio/opus": "ogg",
+
+	"audio/mpeg": "mpeg-audio", "audio/mp3": "mpeg-audio", "audio/x-mpeg": "mpeg-audio",
+	"audio/mpeg3": "mpeg-audio",
+
+	"video/avi": "avi", "video/x-msvideo": "avi", "video/msvideo": "avi",
+}
+
+// zipContainerTypes are formats whose content sniffs as application/zip.
+var zipContainerTypes = map[string]bool{
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	"application/vnd.oasis.opendocument.text":                                   true,
+	"application/vnd.oasis.opendocument.spreadsheet":                            true,
+	"application/vnd.oasis.opendocument.presentation":                           true,
+	"application/epub+zip":                    true,
+	"application/java-archive":                true,
+	"application/vnd.android.package-archive": true,
+	"application/x-zip-compressed":            true,
+}
+
+// oleContainerTypes are legacy Office formats (OLE compound files).
+var oleContainerTypes = map[string]bool{
+	"application/msword":            true,
+	"application/vnd.ms-excel":      true,
+	"application/vnd.ms-powerpoint": true,
+	"application/vnd.ms-outlook":    true,
+}
+
+// textualClaims are non-text/* types whose content is plain text.
+var textualClaims = map[string]bool{
+	"application/json": true, "application/xml": true, "application/javascript": true,
+	"application/x-javascript": true, "application/x-sh": true, "application/sql": true,
+	"application/x-yaml": true, "application/yaml": true, "application/toml": true,
+	"application/x-ndjson": true, "image/svg+xml": true,
+	// Windows browsers label .csv files as Excel.
+	"application/vnd.ms-excel": true,
+}
+
+// resolvedType is the outcome of comparing a client's claim to the content.
+type resolvedType struct {
+	Claimed   string // bare media type from the multipart header, "" if none
+	Detected  string // from utils.DetectMIME
+	Effective string // stored as file_blobs.mime_type
+	Mismatch  bool
+}
+
+// resolveType reconciles the claimed and detected types. The detected type
+// wins when it is specific; a generic sniff (plain text or unknown binary)
+// or one from the same container family keeps the claim since it is more
+// precise (e.g. text/csv, audio/mp4). Unknown binary never counts as a
+// mismatch: many valid formats have no signature the sniffer knows.
+func resolveType(claimedHeader, detected string) resolvedType {
+	claimed, _, err := mime.ParseMediaType(claimedHeader)
+	if err != nil {
+		claimed = ""
+	}
+	claimed = strings.ToLower(claimed)
+	rt := resolvedType{Claimed: claimed, Detected: detected, Effective: detected}
+
+	if claimed == "" || claimed == "application/octet-stream" || claimed == detected {
+		return rt
+	}
+
+	switch {
+	case detected == "application/zip" && zipContainerTypes[claimed]:
+		rt.Effective = claimed
+	case detected == "application/x-ole-storage" && oleContainerTypes[claimed]:
+		rt.Effective = claimed
+	case detected == "text/xml" && (claimed == "application/xml" || strings.HasSuffix(claimed, "+xml")):
+		rt.Effective = claimed
+	case strings.HasPrefix(detected, "text/plain") && (strings.HasPrefix(claimed, "text/") || textualClaims[claimed]):
+		rt.Effective = claimed
+	case detected == "application/octet-stream":
+		// Unknown binary: we cannot prove the claim wrong, but binary
+		// content is not served under a textual type.
+		if !strings.HasPrefix(claimed, "text/") && !textualClaims[claimed] {
+			rt.Effective = claimed
+		}
+	case containerFamilies[detected] != "" && containerFamilies[detected] == containerFamilies[claimed]:
+		rt.Effective = claimed
+	default:
+		rt.Mismatch = true
+	}
+	return rt
+}
+
+// typePolicy is the allow/deny list for one plan. Patterns are exact media
+// types or "major/*". An empty allow list allows everything not denied.
+type typePolicy struct {
+	Allow          []string
+	Deny           []string
+	RejectMismatch bool
+}
+
+// uploadTypePolicy is the policy for plan: its UPLOAD_TYPES_<PLAN>_ALLOW /
+// _DENY lists, falling back to UPLOAD_TYPES_DEFAULT_*.
+// UPLOAD_REJECT_MISMATCH=false turns mismatch rejection off.
+func uploadTypePolicy(plan string) typePolicy {
+	u := config.Get().Uploads
+	lists := u.TypeLists(plan)
+	return typePolicy{Allow: lists.Allow, Deny: lists.Deny, RejectMismatch: u.RejectMismatch}
+}
+
+func matchesType(patterns []string, mediaType string) bool {
+	for _, p := range patterns {
+		if p == mediaType || p == "*/*" {
+			return true
+		}
+		if major, ok := strings.CutSuffix(p, "/*"); ok && strings.HasPrefix(mediaType, major+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkType applies the policy to a resolved upload. It returns a reason
+// when the upload must be rejected, or "" to accept it. Both the detected
+// and the effective type must pass, so a claim cannot smuggle in content
+// the sniff identifies as denied.
+func (p typePolicy) checkType(rt resolvedType) string {
+	if rt.Mismatch && p.RejectMismatch {
+		return "content does not match declared type " + rt.Claimed + " (detected " + rt.Detected + ")"
+	}
+	for _, t := range []string{rt.Detected, rt.Effective} {
+		if matchesType(p.Deny, t) {
+			return "file type " + t + " is not allowed"
+		}
+	}
+	if len(p.Allow) == 0 {
+		return ""
+	}
+	if !matchesType(p.Allow, rt.Effective) {
+		return "file type " + rt.Effective + " is not allowed"
+	}
+	if !genericType(rt.Detected) && !matchesType(p.Allow, rt.Detected) {
+		return "file type " + rt.Detected + " is not allowed"
+	}
+	return ""
+}
+
+// genericType reports whether t is a sniff result too vague to check
+// against an allow list on its own; only the effective type is checked then.
+func genericType(t string) bool {
+	return t == "application/octet-stream" || t == "text/plain" || t == "application/zip" ||
+		t == "application/x-ole-storage" || t == "text/xml"
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"testing"
+
+	"server/utils"
+)
+
+// ftyp builds an ISO BMFF file type box with a major brand and compatible
+// brands, followed by filler.
+func ftyp(major string, compatible ...string) []byte {
+	brands := major + "\x00\x00\x00\x00"
+	for _, b := range compatible {
+		brands += b
+	}
+	size := 8 + len(brands)
+	box := append([]byte{0, 0, 0, byte(size)}, "ftyp"+brands...)
+	return append(box, bytes.Repeat([]byte{0}, 64)...)
+}
+
+func TestResolveType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	mkv := append([]byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\xf7\x81\x01\x42\xf2\x81\x04\x42\xf3\x81\x08\x42\x82\x88"), "matroska"...)
+	wav := append([]byte("RIFF\x24\x00\x00\x00WAVEfmt "), bytes.Repeat([]byte{0}, 32)...)
+	mp3 := append([]byte{0xff, 0xfb, 0x90, 0x64}, bytes.Repeat([]byte{0x00, 0x55}, 32)...)
+	binary := []byte{0x00, 0x01, 0x02, 0x03, 0xfe, 0xff}
+
+	tests := []struct {
+		name      string
+		claimed   string
+		content   []byte
+		effective string
+		mismatch  bool
+	}{
+		{"matching claim", "image/png", png, "image/png", false},
+		{"no claim", "", png, "image/png", false},
+		{"m4a as audio/mp4", "audio/mp4", ftyp("M4A ", "M4A ", "mp42", "isom"), "audio/mp4", false},
+		{"m4a as audio/x-m4a", "audio/x-m4a", ftyp("M4A ", "M4A ", "mp42", "isom"), "audio/x-m4a", false},
+		{"mkv as video/x-matroska", "video/x-matroska", mkv, "video/x-matroska", false},
+		{"heic with mif1 brand", "image/heic", ftyp("mif1", "mif1", "heic"), "image/heic", false},
+		{"mp3 without ID3", "audio/mpeg", mp3, "audio/mpeg", false},
+		{"wav as audio/x-wav", "audio/x-wav", wav, "audio/x-wav", false},
+		{"wav as audio/wav", "audio/wav", wav, "audio/wav", false},
+		{"docx sniffs as zip", "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+			[]byte("PK\x03\x04"), "application/vnd.openxmlformats-officedocument.wordprocessingml.document", false},
+		{"csv as text", "text/csv", []byte("a,b\n1,2\n"), "text/csv", false},
+		{"binary claimed as text", "text/plain", binary, "application/octet-stream", false},
+		{"binary claimed as html", "text/html", binary, "application/octet-stream", false},
+		{"text claimed as png", "image/png", []byte("not a png"), "text/plain", true},
+		{"png claimed as mp4", "video/mp4", png, "image/png", true},
+		{"exe claimed as pdf", "application/pdf", []byte("MZ\x90\x00"), "application/x-msdownload", true},
+		{"mp4 claimed as webm", "video/webm", ftyp("isom", "isom", "mp41"), "video/mp4", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := resolveType(tt.claimed, utils.DetectMIME(tt.content))
+			if rt.Effective != tt.effective || rt.Mismatch != tt.mismatch {
+				t.Errorf("detected %s: effective %q mismatch %v, want %q %v",
+					rt.Detected, rt.Effective, rt.Mismatch, tt.effective, tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestCheckType(t *testing.T) {
+	p := typePolicy{Allow: []string{"image/*", "audio/*"}, Deny: []string{"application/x-msdownload"}, RejectMismatch: true}
+	tests := []struct {
+		name   string
+		rt     resolvedType
+		reject bool
+	}{
+		{"allowed", resolvedType{Detected: "image/png", Effective: "image/png"}, false},
+		{"allowed claim over unknown binary", resolvedType{Claimed: "audio/mpeg", Detected: "application/octet-stream", Effective: "audio/mpeg"}, false},
+		{"mismatch", resolvedType{Claimed: "image/png", Detected: "text/plain", Effective: "text/plain", Mismatch: true}, true},
+		{"denied detection", resolvedType{Claimed: "image/png", Detected: "application/x-msdownload", Effective: "image/png"}, true},
+		{"not allowed", resolvedType{Detected: "application/pdf", Effective: "application/pdf"}, true},
+	}
+	for _, tt := range tests {
+		if reason := p.checkType(tt.rt); (reason != "") != tt.reject {
+			t.Errorf("%s: reason %q, want rejected %v", tt.name, reason, tt.reject)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/config"
+	"server/logging"
+	"server/store"
+)
+
+// Outcome of each file in a multi-file upload
+const (
+	uploadStored    = "stored"
+	uploadDuplicate = "duplicate" // stored as a reference to existing content
+	uploadRejected  = "rejected"
+)
+
+// multipartOverhead is allowed on top of UPLOAD_MAX_REQUEST_MB for part
+// headers, boundaries and the username field.
+const multipartOverhead = 1 << 20
+
+// ✅ Result for one file of a multi-file upload
+type UploadResult struct {
+	FileName string          `json:"fileName"`
+	Status   string          `json:"status"`           // stored, duplicate or rejected
+	Code     string          `json:"code,omitempty"`   // error code, when rejected
+	Reason   string          `json:"reason,omitempty"` // when rejected
+	File     *UploadResponse `json:"file,omitempty"`   // when stored or duplicate
+}
+
+// ✅ Response to a multi-file upload
+type MultiUploadResponse struct {
+	Stored     int            `json:"stored"`
+	Duplicates int            `json:"duplicates"`
+	Rejected   int            `json:"rejected"`
+	Complete   bool           `json:"complete"` // false when the size cap stopped reading the request
+	Results    []UploadResult `json:"results"`
+}
+
+//
+// 🔹 UploadFiles: many files in one multipart request
+//
+// Parts are read one at a time as they arrive and spooled to a temporary
+// file while they are hashed, so no file is held in memory. Each file goes
+// through the same checks, deduplication and bookkeeping as UploadFile, and
+// is committed on its own: a rejected file does not undo the ones before
+// it. The response lists every file in request order, with 200 when none
+// was rejected and 207 otherwise.
+//
+// username must come before the first file: as ?username= or as the first
+// form field. Files may use any field name.
+//
+func (h *Handlers) UploadFiles(w http.ResponseWriter, r *http.Request) {
+	limits := config.Get().Uploads
+	maxBytes := limits.MaxRequestMB << 20
+	if r.ContentLength > maxBytes+multipartOverhead {
+		writeError(w, r, codeTooLarge, fmt.Sprintf("Request exceeds the %d MB upload limit", limits.MaxRequestMB))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+
+	parts, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, r, codeInvalidRequest, "Expected a multipart/form-data body")
+		return
+	}
+
+	username := r.URL.Query().Get("username")
+	var user store.User
+	resp := MultiUploadResponse{Complete: true, Results: []UploadResult{}}
+	var total int64
+
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if len(resp.Results) == 0 {
+				writeError(w, r, codeInvalidRequest, "Malformed multipart body")
+				return
+			}
+			slog.WarnContext(r.Context(), "multi-file upload: body ended early", "error", err)
+			resp.Complete = false
+			break
+		}
+
+		name := part.FileName()
+		if name == "" {
+			// A plain form field: only username is used
+			if part.FormName() == "username" && username == "" {
+				value, _ := io.ReadAll(io.LimitReader(part, 320))
+				username = strings.TrimSpace(string(value))
+			}
+			part.Close()
+			continue
+		}
+
+		if user.ID == 0 {
+			if username == "" {
+				part.Close()
+				writeError(w, r, codeInvalidRequest, "username is required before the first file")
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 15*time.Second)
+			user, err = h.store.Users.Ensure(ctx, username)
+			cancel()
+			if err != nil {
+				part.Close()
+				slog.ErrorContext(r.Context(), "multi-file upload failed: ensure user", "user", username, "error", err)
+				writeError(w, r, codeInternal, "User creation failed")
+				return
+			}
+			logging.SetUserID(r.Context(), user.ID)
+		}
+
+		if len(resp.Results) >= limits.MaxFiles {
+			part.Close()
+			resp.add(UploadResult{FileName: name, Status: uploadRejected, Code: codeTooLarge,
+				Reason: fmt.Sprintf("Only %d files are accepted per request", limits.MaxFiles)})
+			continue
+		}
+
+		// Read one byte past what the cap still allows, to notice a file
+		// that crosses it
+		remaining := maxBytes - total
+		up, err := readUpload(r.Context(), io.LimitReader(part, remaining+1), name, part.Header.Get("Content-Type"))
+		part.Close()
+		var tooBig *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooBig) || (err == nil && up.Size > remaining):
+			resp.add(UploadResult{FileName: name, Status: uploadRejected, Code: codeTooLarge,
+				Reason: fmt.Sprintf("Request exceeds the %d MB upload limit; later files were not read", limits.MaxRequestMB)})
+			resp.Complete = false
+		case err != nil:
+			slog.WarnContext(r.Context(), "multi-file upload: read file", "user", username, "file", name, "error", err)
+			resp.add(UploadResult{FileName: name, Status: uploadRejected, Code: codeInvalidRequest, Reason: "File could not be read"})
+			resp.Complete = false
+		}
+		if !resp.Complete {
+			up.Close()
+			break
+		}
+		total += up.Size
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 15*time.Second)
+		res, fail := h.storeUpload(ctx, user, up)
+		cancel()
+		up.Close()
+		switch {
+		case fail != nil:
+			resp.add(UploadResult{FileName: name, Status: uploadRejected, Code: fail.code, Reason: fail.message})
+		case res.Duplicate:
+			resp.add(UploadResult{FileName: name, Status: uploadDuplicate, File: &res})
+		default:
+			resp.add(UploadResult{FileName: name, Status: uploadStored, File: &res})
+		}
+	}
+
+	if len(resp.Results) == 0 {
+		msg := "No files in request"
+		if username == "" {
+			msg = "username is required"
+		}
+		writeError(w, r, codeInvalidRequest, msg)
+		return
+	}
+	slog.InfoContext(r.Context(), "multi-file upload", "user", username, "stored", resp.Stored,
+		"duplicates", resp.Duplicates, "rejected", resp.Rejected, "bytes", total, "complete", resp.Complete)
+
+	status := http.StatusOK
+	if resp.Rejected > 0 || !resp.Complete {
+		status = http.StatusMultiStatus
+	}
+	writeJSON(w, r, status, resp)
+}
+
+func (m *MultiUploadResponse) add(res UploadResult) {
+	switch res.Status {
+	case uploadStored:
+		m.Stored++
+	case uploadDuplicate:
+		m.Duplicates++
+	case uploadRejected:
+		m.Rejected++
+	}
+	m.Results = append(m.Results, res)
+}
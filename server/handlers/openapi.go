@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+
+	"server/config"
+	"server/openapi"
+)
+
+//
+// 🔹 OpenAPI document for every route
+//
+// Bodies are the same types the handlers encode, so the schemas follow the
+// code. API routes are listed once, without their version prefix. main.go
+// checks the document against the router at startup; a route added there
+// without an entry here is logged.
+//
+
+// errorResponses lists the error envelopes an operation can send.
+func errorResponses(statuses ...int) []openapi.Response {
+	list := make([]openapi.Response, 0, len(statuses))
+	for _, status := range statuses {
+		list = append(list, openapi.Response{Status: status, Body: ErrorResponse{}})
+	}
+	return list
+}
+
+// okResponses is a 200 with body followed by errorResponses(errs).
+func okResponses(body interface{}, errs ...int) []openapi.Response {
+	return append([]openapi.Response{{Status: http.StatusOK, Body: body}}, errorResponses(errs...)...)
+}
+
+func limitParam(max string) openapi.Param {
+	return openapi.Param{Name: "limit", Type: 0, Description: "Page size, at most " + max}
+}
+
+var (
+	apiDocOnce sync.Once
+	apiDoc     *openapi.Document
+)
+
+// APIDocument returns the OpenAPI document describing the HTTP API.
+func APIDocument() *openapi.Document {
+	apiDocOnce.Do(func() {
+		apiDoc = buildAPIDocument()
+	})
+	return apiDoc
+}
+
+// OpenAPI serves the document at /openapi.json.
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, r, http.StatusOK, APIDocument())
+}
+
+func buildAPIDocument() *openapi.Document {
+	d := openapi.New(openapi.Info{
+		Title:       "AWS-SkyVault API",
+		Version:     "1.0.0",
+		Description: "Deduplicated file storage on S3. Every error response uses the ErrorResponse envelope.",
+	})
+
+	username := openapi.Param{Name: "username", Required: true, Description: "Owner's email"}
+	email := openapi.Param{Name: "email", Required: true, Description: "User's email"}
+	webhookID := openapi.Param{Name: "id", Required: true, Type: 0, Description: "Subscription id"}
+	deliveryParams := []openapi.Param{
+		{Name: "subscription_id", Type: 0, Description: "Only deliveries for this subscription"},
+		{Name: "status", Description: "Only deliveries in this state", Enum: []string{"pending", "succeeded", "failed"}},
+		limitParam("500"),
+	}
+	conditional := map[string]string{"ETag": "Entity tag for If-None-Match", "Last-Modified": "For If-Modified-Since"}
+
+	ops := []openapi.Operation{
+		// Operations
+		{
+			Method: "GET", Path: "/metrics", ID: "getMetrics", Tags: []string{"operations"},
+			Summary:   "Prometheus metrics",
+			Responses: []openapi.Response{{Status: http.StatusOK, Binary: true, ContentType: "text/plain"}},
+		},
+		{
+			Method: "GET", Path: "/healthz", ID: "getLiveness", Tags: []string{"operations"},
+			Summary:   "Liveness probe",
+			Responses: okResponses(Liveness{}),
+		},
+		{
+			Method: "GET", Path: "/readyz", ID: "getReadiness", Tags: []string{"operations"},
+			Summary: "Readiness probe with dependency checks",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Body: ReadinessReport{}, Description: "Ready or degraded"},
+				{Status: http.StatusServiceUnavailable, Body: ReadinessReport{}, Description: "A critical dependency is down"},
+			},
+		},
+		{
+			Method: "GET", Path: "/openapi.json", ID: "getOpenAPI", Tags: []string{"operations"},
+			Summary:   "This document",
+			Responses: []openapi.Response{{Status: http.StatusOK, Description: "OpenAPI 3.1 document", Body: map[string]interface{}{}}},
+		},
+	}
+	for _, op := range ops {
+		d.Add(op)
+	}
+
+	// v1 is served under /v1 and, unless LEGACY_ROUTES is off, at the
+	// unversioned paths too, where it is deprecated.
+	legacy := config.Get().Server.LegacyRoutes
+	v1 := []openapi.Operation{
+		// Files
+		{
+			Method: "POST", Path: "/upload", ID: "uploadFile", Tags: []string{"files"},
+			Summary: "Upload a file",
+			Description: "Content already stored (same SHA-256) is not uploaded again; the response " +
+				"then has duplicate set. New content starts with scanStatus pending. Content whose " +
+				"scan found malware is rejected with 403.",
+			Form: []openapi.Param{
+				username,
+				{Name: "file", Required: true, Binary: true},
+			},
+			Responses: okResponses(UploadResponse{}, 400, 403, 413, 415, 500),
+		},
+		{
+			Method: "POST", Path: "/uploads", ID: "uploadFiles", Tags: []string{"files"},
+			Summary: "Upload many files in one request",
+			Description: "Each file is checked, deduplicated and stored on its own, and one file's " +
+				"rejection does not undo the others. username must precede the first file, as a " +
+				"query parameter or the first form field. The files together may not exceed " +
+				"UPLOAD_MAX_REQUEST_MB; reading stops at the file that crosses it.",
+			Params: []openapi.Param{{Name: "username", Description: "Owner's email, unless sent as a form field"}},
+			Form: []openapi.Param{
+				{Name: "username", Description: "Owner's email, unless given in the query"},
+				{Name: "file", Required: true, Binary: true, Description: "Repeat for every file; any field name works"},
+			},
+			Responses: append([]openapi.Response{
+				{Status: http.StatusOK, Body: MultiUploadResponse{}, Description: "Every file was stored"},
+				{Status: http.StatusMultiStatus, Body: MultiUploadResponse{}, Description: "Some files were rejected, or the size cap stopped the upload"},
+			}, errorResponses(400, 413, 500)...),
+		},
+		{
+			Method: "GET", Path: "/files", ID: "listFiles", Tags: []string{"files"},
+			Summary: "List a user's files",
+			Params: []openapi.Param{
+				username,
+				{Name: "trash", Type: false, Description: "List the trash instead, most recently trashed first"},
+			},
+			Responses: okResponses([]FileInfo{}, 400, 500),
+		},
+		{
+			Method: "POST", Path: "/files/bulk", ID: "bulkFiles", Tags: []string{"files"},
+			Summary: "Apply one operation to many files",
+			Description: "operation is delete (to the trash, or for good with permanent), restore, " +
+				"move (to folder), tag (addTags, then removeTags) or share (public). With atomic, " +
+				"one failing file fails the request with 409 and nothing changes; otherwise each " +
+				"file succeeds or fails on its own.",
+			Body: BulkRequest{},
+			Responses: append([]openapi.Response{
+				{Status: http.StatusOK, Body: BulkResponse{}, Description: "Every file succeeded"},
+				{Status: http.StatusMultiStatus, Body: BulkResponse{}, Description: "Some files failed; the others were changed"},
+			}, errorResponses(400, 409, 500)...),
+		},
+		{
+			Method: "GET", Path: "/files/{id}/thumbnail", ID: "getThumbnail", Tags: []string{"files"},
+			Summary: "Download a file's thumbnail",
+			Params: []openapi.Param{
+				{In: "path", Name: "id", Type: 0, Description: "File id from the listing"},
+				{Name: "size", Enum: []string{"small", "medium", "large"}, Description: "Default medium"},
+				{Name: "username", Description: "Only match the file if this user owns it"},
+			},
+			Responses: append([]openapi.Response{
+				{Status: http.StatusOK, Binary: true, ContentType: "image/*", Headers: conditional},
+				{Status: http.StatusNotModified},
+				{Status: http.StatusServiceUnavailable, Body: ErrorResponse{}, Headers: map[string]string{"Retry-After": "Seconds until the thumbnail is worth asking for again"}},
+			}, errorResponses(400, 403, 404, 502)...),
+		},
+		{
+			Method: "GET", Path: "/download", ID: "downloadFile", Tags: []string{"files"},
+			Summary:     "Download a file",
+			Description: "Supports Range, If-Range, If-None-Match and If-Modified-Since.",
+			Params: []openapi.Param{
+				{Name: "key", Required: true, Description: "s3Key from the listing"},
+				{Name: "username", Description: "Names the download after this user's file name"},
+				{Name: "disposition", Enum: []string{"attachment", "inline"}, Description: "Default attachment"},
+			},
+			Responses: append([]openapi.Response{
+				{Status: http.StatusOK, Binary: true, Headers: conditional},
+				{Status: http.StatusPartialContent, Binary: true, Headers: map[string]string{"Content-Range": "Bytes sent"}},
+				{Status: http.StatusNotModified},
+				{Status: http.StatusServiceUnavailable, Body: ErrorResponse{}, Headers: map[string]string{"Retry-After": "Seconds until the malware scan is expected to finish"}},
+			}, errorResponses(400, 403, 404, 416, 500)...),
+		},
+		{
+			Method: "DELETE", Path: "/delete", ID: "deleteFile", Tags: []string{"files"},
+			Summary: "Delete a user's file",
+			Params: []openapi.Param{
+				{Name: "key", Required: true, Description: "s3Key from the listing"},
+				username,
+			},
+			Responses: okResponses(MessageResponse{}, 400, 404, 500),
+		},
+		{
+			Method: "GET", Path: "/search", ID: "searchFiles", Tags: []string{"files"},
+			Summary: "Full-text search over a user's files",
+			Params: []openapi.Param{
+				username,
+				{Name: "q", Required: true, Description: "Search terms"},
+				limitParam("100"),
+				{Name: "offset", Type: 0},
+			},
+			Responses: okResponses([]SearchResult{}, 400, 500),
+		},
+
+		// Webhooks
+		{
+			Method: "GET", Path: "/webhooks", ID: "listWebhooks", Tags: []string{"webhooks"},
+			Summary:   "List a user's webhook subscriptions",
+			Params:    []openapi.Param{username},
+			Responses: okResponses([]WebhookSubscription{}, 400, 404, 500),
+		},
+		{
+			Method: "POST", Path: "/webhooks", ID: "createWebhook", Tags: []string{"webhooks"},
+			Summary:   "Subscribe a user to events",
+			Body:      WebhookRequest{},
+			Responses: append([]openapi.Response{{Status: http.StatusCreated, Body: WebhookSubscription{}, Description: "Created; secret is only returned here"}}, errorResponses(400, 500)...),
+		},
+		{
+			Method: "DELETE", Path: "/webhooks", ID: "deleteWebhook", Tags: []string{"webhooks"},
+			Summary:   "Delete a user's webhook subscription",
+			Params:    []openapi.Param{username, webhookID},
+			Responses: okResponses(MessageResponse{}, 400, 404, 500),
+		},
+		{
+			Method: "GET", Path: "/webhooks/deliveries", ID: "listWebhookDeliveries", Tags: []string{"webhooks"},
+			Summary:   "List deliveries to a user's subscriptions",
+			Params:    append([]openapi.Param{username}, deliveryParams...),
+			Responses: okResponses([]WebhookDelivery{}, 400, 404, 500),
+		},
+
+		// Admin
+		{
+			Method: "GET", Path: "/admin/system-stats", ID: "getSystemStats", Tags: []string{"admin"},
+			Summary:   "System-wide storage and deduplication stats",
+			Responses: okResponses(SystemStats{}, 500),
+		},
+		{
+			Method: "GET", Path: "/admin/users", ID: "listUserStats", Tags: []string{"admin"},
+			Summary: "Page through every user's stats",
+			Params: []openapi.Param{
+				limitParam("200"),
+				{Name: "cursor", Description: "nextCursor from the previous page"},
+				{Name: "sort", Enum: []string{"id", "storage", "files", "activity"}},
+				{Name: "order", Enum: []string{"asc", "desc"}},
+				{Name: "q", Description: "Case-insensitive email substring"},
+				{Name: "inactive_days", Type: 0, Description: "Only users with no activity in the last N days"},
+			},
+			Responses: okResponses(UserStatsPage{}, 400, 500),
+		},
+		{
+			Method: "GET", Path: "/admin/user-stats", ID: "getUserStats", Tags: []string{"admin"},
+			Summary:   "One user's stats",
+			Params:    []openapi.Param{email},
+			Responses: okResponses(UserStats{}, 400, 404, 500),
+		},
+		{
+			Method: "GET", Path: "/admin/file-details", ID: "listFileDetails", Tags: []string{"admin"},
+			Summary:   "A user's files with blob details",
+			Params:    []openapi.Param{username},
+			Responses: okResponses([]FileDetail{}, 400, 500),
+		},
+		{
+			Method: "GET", Path: "/admin/user-usage", ID: "getUserUsage", Tags: []string{"admin"},
+			Summary: "A user's monthly usage history",
+			Params: []openapi.Param{
+				email,
+				{Name: "months", Type: 0, Description: "How many months back, at most 120"},
+			},
+			Responses: okResponses(UsageHistory{}, 400, 404, 500),
+		},
+		{
+			Method: "GET", Path: "/admin/jobs", ID: "listJobs", Tags: []string{"admin"},
+			Summary: "List background jobs",
+			Params: []openapi.Param{
+				{Name: "status", Description: "Only jobs in this state"},
+				{Name: "type", Description: "Only jobs of this type"},
+				limitParam("500"),
+			},
+			Responses: okResponses([]JobInfo{}, 400, 500),
+		},
+		{
+			Method: "POST", Path: "/admin/jobs/retry", ID: "retryJob", Tags: []string{"admin"},
+			Summary:   "Requeue a dead job",
+			Params:    []openapi.Param{{Name: "id", Required: true, Type: int64(0)}},
+			Responses: okResponses(MessageResponse{}, 400, 404, 409),
+		},
+		{
+			Method: "GET", Path: "/admin/webhooks", ID: "listAllWebhooks", Tags: []string{"admin"},
+			Summary:   "List every webhook subscription",
+			Responses: okResponses([]WebhookSubscription{}, 500),
+		},
+		{
+			Method: "POST", Path: "/admin/webhooks", ID: "createSystemWebhook", Tags: []string{"admin"},
+			Summary:   "Subscribe to every user's events",
+			Body:      WebhookRequest{},
+			Responses: append([]openapi.Response{{Status: http.StatusCreated, Body: WebhookSubscription{}, Description: "Created; secret is only returned here"}}, errorResponses(400, 500)...),
+		},
+		{
+			Method: "DELETE", Path: "/admin/webhooks", ID: "deleteAnyWebhook", Tags: []string{"admin"},
+			Summary:   "Delete any webhook subscription",
+			Params:    []openapi.Param{webhookID},
+			Responses: okResponses(MessageResponse{}, 400, 404, 500),
+		},
+		{
+			Method: "GET", Path: "/admin/webhooks/deliveries", ID: "listAllWebhookDeliveries", Tags: []string{"admin"},
+			Summary:   "List deliveries to every subscription",
+			Params:    deliveryParams,
+			Responses: okResponses([]WebhookDelivery{}, 400, 500),
+		},
+	}
+	for _, op := range v1 {
+		alias := op
+		op.Path = "/v1" + op.Path
+		d.Add(op)
+		if legacy {
+			alias.ID += "Legacy"
+			alias.Deprecated = true
+			alias.Description = "Deprecated alias of " + op.Path + ". Responses carry Deprecation, Sunset and Link headers."
+			d.Add(alias)
+		}
+	}
+	return d
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// multiUpload builds a POST /uploads body with one part per file name,
+// all declared as text/plain unless the name says otherwise.
+func multiUpload(t *testing.T, username string, files map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("username", username)
+	for name, content := range files {
+		contentType := "text/plain"
+		if strings.HasSuffix(name, ".png") {
+			contentType = "image/png"
+		}
+		part, err := mw.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="file"; filename="` + name + `"`},
+			"Content-Type":        {contentType},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/uploads", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// Every JSON response the handlers send must match the OpenAPI document
+// for its operation and status.
+func TestResponsesMatchOpenAPI(t *testing.T) {
+	env := newTestEnv(t)
+	doc := APIDocument()
+	user := "a@example.com"
+	stored := env.mustUpload(t, user, "stored.txt", content10)
+	trashed := env.mustUpload(t, user, "trashed.txt", other10)
+	env.bulk(t, BulkRequest{Username: user, Operation: "delete", FileIDs: []int{trashed.ID}})
+
+	bulk := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/files/bulk", strings.NewReader(body))
+	}
+	get := func(target string) *http.Request { return httptest.NewRequest(http.MethodGet, target, nil) }
+	id := strconv.Itoa(stored.ID)
+
+	cases := []struct {
+		name    string
+		path    string // as documented, without the version prefix
+		handler http.HandlerFunc
+		req     *http.Request
+		status  int
+	}{
+		{"upload", "/upload", env.h.UploadFile,
+			uploadRequest(t, user, "new.txt", "text/plain", []byte("fresh content")), http.StatusOK},
+		{"upload without username", "/upload", env.h.UploadFile,
+			httptest.NewRequest(http.MethodPost, "/upload", nil), http.StatusBadRequest},
+		{"multi-upload", "/uploads", env.h.UploadFiles,
+			multiUpload(t, user, map[string]string{"x.txt": "x", "y.txt": "y"}), http.StatusOK},
+		{"multi-upload with a rejection", "/uploads", env.h.UploadFiles,
+			multiUpload(t, user, map[string]string{"ok.txt": "ok", "fake.png": "not a png"}), http.StatusMultiStatus},
+		{"multi-upload without files", "/uploads", env.h.UploadFiles,
+			multiUpload(t, user, nil), http.StatusBadRequest},
+		{"list", "/files", env.h.ListUserFiles, get("/files?username=" + user), http.StatusOK},
+		{"list trash", "/files", env.h.ListUserFiles, get("/files?trash=true&username=" + user), http.StatusOK},
+		{"list without username", "/files", env.h.ListUserFiles, get("/files"), http.StatusBadRequest},
+		{"bulk", "/files/bulk", env.h.BulkFiles,
+			bulk(`{"username":"` + user + `","operation":"tag","addTags":["x"],"fileIds":[` + id + `]}`), http.StatusOK},
+		{"bulk partial", "/files/bulk", env.h.BulkFiles,
+			bulk(`{"username":"` + user + `","operation":"move","folder":"/a","fileIds":[` + id + `,999]}`), http.StatusMultiStatus},
+		{"bulk atomic", "/files/bulk", env.h.BulkFiles,
+			bulk(`{"username":"` + user + `","operation":"move","folder":"/a","atomic":true,"fileIds":[` + id + `,999]}`), http.StatusConflict},
+		{"bulk invalid", "/files/bulk", env.h.BulkFiles, bulk(`{}`), http.StatusBadRequest},
+		{"download without key", "/download", env.h.DownloadFile, get("/download"), http.StatusBadRequest},
+		{"download unknown key", "/download", env.h.DownloadFile, get("/download?key=nope"), http.StatusNotFound},
+		{"download before scan", "/download", env.h.DownloadFile, get("/download?key=" + stored.S3Key), http.StatusServiceUnavailable},
+		{"delete without key", "/delete", env.h.DeleteFile,
+			httptest.NewRequest(http.MethodDelete, "/delete", nil), http.StatusBadRequest},
+		{"delete", "/delete", env.h.DeleteFile,
+			httptest.NewRequest(http.MethodDelete, "/delete?username="+user+"&key="+stored.S3Key, nil), http.StatusOK},
+		{"delete unknown key", "/delete", env.h.DeleteFile,
+			httptest.NewRequest(http.MethodDelete, "/delete?key=nope", nil), http.StatusNotFound},
+		{"search without query", "/search", SearchFiles, get("/search?username=" + user), http.StatusBadRequest},
+		{"webhooks without username", "/webhooks", ListWebhooks, get("/webhooks"), http.StatusBadRequest},
+		{"create webhook with bad body", "/webhooks", env.h.CreateWebhook,
+			httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader("{")), http.StatusBadRequest},
+		{"user stats without email", "/admin/user-stats", env.h.GetUserStats, get("/admin/user-stats"), http.StatusBadRequest},
+		{"user stats", "/admin/user-stats", env.h.GetUserStats, get("/admin/user-stats?email=" + user), http.StatusOK},
+		{"user stats for unknown user", "/admin/user-stats", env.h.GetUserStats,
+			get("/admin/user-stats?email=nobody@example.com"), http.StatusNotFound},
+		{"users", "/admin/users", env.h.GetAllUserStats, get("/admin/users?sort=storage"), http.StatusOK},
+		{"users with bad sort", "/admin/users", env.h.GetAllUserStats, get("/admin/users?sort=name"), http.StatusBadRequest},
+		{"system stats", "/admin/system-stats", env.h.GetSystemStats, get("/admin/system-stats"), http.StatusOK},
+		{"file details", "/admin/file-details", env.h.GetUserFileDetails, get("/admin/file-details?username=" + user), http.StatusOK},
+		{"usage history", "/admin/user-usage", env.h.GetUserUsageHistory, get("/admin/user-usage?email=" + user), http.StatusOK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c.handler(w, c.req)
+			if w.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, c.status, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Fatalf("Content-Type %q, want JSON", ct)
+			}
+			if err := doc.ValidateResponse(c.req.Method, "/v1"+c.path, w.Code, w.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	for _, path := range []string{"/healthz", "/openapi.json"} {
+		w := httptest.NewRecorder()
+		handler := map[string]http.HandlerFunc{"/healthz": Healthz, "/openapi.json": OpenAPI}[path]
+		handler(w, get(path))
+		if err := doc.ValidateResponse(http.MethodGet, path, w.Code, w.Body.Bytes()); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
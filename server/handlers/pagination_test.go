@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := pageCursor{Sort: "activity", Order: "desc", Value: "2026-01-31T23:59:59.123456Z", ID: 42}
+	got, err := decodeCursor(encodeCursor(c))
+	if err != nil || got != c {
+		t.Errorf("decode(encode(%+v)) = %+v, %v", c, got, err)
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	valid := encodeCursor(pageCursor{Sort: "id", Order: "asc", Value: "7", ID: 7})
+	for name, s := range map[string]string{
+		"not base64":      "%%%",
+		"padded base64":   base64.URLEncoding.EncodeToString([]byte(`{"s":"id"}`)),
+		"not JSON":        base64.RawURLEncoding.EncodeToString([]byte("id=7")),
+		"wrong JSON type": base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","id":"7"}`)),
+		"truncated":       valid[:len(valid)-3],
+	} {
+		if _, err := decodeCursor(s); err != errInvalidCursor {
+			t.Errorf("%s: err = %v, want errInvalidCursor", name, err)
+		}
+	}
+
+	// Well-formed cursors whose value does not parse for their sort
+	for sort, v := range map[string]string{"id": "x", "files": "1.5", "storage": "", "activity": "yesterday", "name": "a"} {
+		if _, err := parseUserSortValue(sort, v); err == nil {
+			t.Errorf("sort %s accepted value %q", sort, v)
+		}
+	}
+}
+
+func TestSortValueRoundTrip(t *testing.T) {
+	u := UserStats{ID: 3, FilesCount: 12, StorageUsed: 1 << 40, LastActive: time.Date(2026, 3, 1, 10, 0, 0, 123456000, time.UTC)}
+	for _, s := range []string{"id", "files", "storage", "activity"} {
+		v, err := parseUserSortValue(s, userSortValue(s, u))
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if tm, ok := v.(time.Time); ok {
+			if !tm.Equal(u.LastActive) {
+				t.Errorf("activity lost precision: %s", tm)
+			}
+		}
+	}
+}
+
+// Paging by activity with every timestamp tied must still visit each user
+// exactly once, in id order: the cursor carries the id tie-breaker that the
+// store compares as (value, id).
+func TestCursorPagingWithTies(t *testing.T) {
+	env := newTestEnv(t)
+	tied := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	env.mem.SetNow(func() time.Time { return tied })
+	for i := 1; i <= 7; i++ {
+		env.mustUpload(t, fmt.Sprintf("u%d@example.com", i), "a.txt", []byte(fmt.Sprint("content ", i)))
+	}
+	env.mem.SetNow(func() time.Time { return tied.Add(time.Hour) })
+	env.mustUpload(t, "u4@example.com", "b.txt", []byte("later"))
+
+	for _, order := range []string{"asc", "desc"} {
+		var seen []int
+		cursor := ""
+		for pages := 0; pages < 10; pages++ {
+			q := url.Values{"sort": {"activity"}, "order": {order}, "limit": {"2"}}
+			if cursor != "" {
+				q.Set("cursor", cursor)
+			}
+			w := httptest.NewRecorder()
+			env.h.GetAllUserStats(w, httptest.NewRequest(http.MethodGet, "/admin/users?"+q.Encode(), nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: %d %s", order, w.Code, w.Body)
+			}
+			var page UserStatsPage
+			decode(t, w, &page)
+			if page.Total != 7 {
+				t.Errorf("%s: total %d, want 7", order, page.Total)
+			}
+			for _, u := range page.Users {
+				seen = append(seen, u.ID)
+			}
+			if cursor = page.NextCursor; cursor == "" {
+				break
+			}
+		}
+
+		want := []int{1, 2, 3, 5, 6, 7, 4}
+		if order == "desc" {
+			want = []int{4, 7, 6, 5, 3, 2, 1}
+		}
+		if !reflect.DeepEqual(seen, want) {
+			t.Errorf("%s: visited %v, want %v", order, seen, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"server/config"
+)
+
+// Storage bases a quota or bill can be computed on.
+const (
+	// storageLogical is every byte the user sees in their listing,
+	// duplicates included.
+	storageLogical = "logical"
+	// storagePhysical is the user's attributed share of the bytes actually
+	// stored (see user_storage_attribution).
+	storagePhysical = "physical"
+)
+
+// storagePolicy decides which storage figure quotas and billing use.
+type storagePolicy struct {
+	QuotaBasis   string
+	BillingBasis string
+	QuotaBytes   int64 // 0 = unlimited
+}
+
+var (
+	storagePolicyOnce sync.Once
+	policy            storagePolicy
+)
+
+// currentStoragePolicy loads the policy from MAX_STORAGE_MB, QUOTA_BASIS and
+// BILLING_BASIS (both bases default to logical).
+func currentStoragePolicy() storagePolicy {
+	storagePolicyOnce.Do(func() {
+		c := config.Get().Uploads
+		policy = storagePolicy{
+			QuotaBasis:   storageBasis(c.QuotaBasis),
+			BillingBasis: storageBasis(c.BillingBasis),
+			QuotaBytes:   c.MaxStorageMB * 1024 * 1024,
+		}
+	})
+	return policy
+}
+
+func storageBasis(v string) string {
+	if v == storagePhysical {
+		return storagePhysical
+	}
+	return storageLogical
+}
+
+// basisBytes picks the figure for basis from a logical/physical pair.
+func basisBytes(basis string, logical, physical int64) int64 {
+	if basis == storagePhysical {
+		return physical
+	}
+	return logical
+}
+
+//
+// 🔹 Helper: Check whether adding a file of `size` bytes keeps the user in quota
+//
+// For the physical basis a duplicate only costs the user their share of the
+// existing blob once they join its holders (size / (ref_count + 1)); blobs
+// already shared with others get cheaper for everyone, which is ignored here.
+//
+func (h *Handlers) checkQuota(ctx context.Context, userID int, size int64, existingRefCount int) (bool, error) {
+	p := currentStoragePolicy()
+	if p.QuotaBytes == 0 {
+		return true, nil
+	}
+
+	logical, physical, err := h.store.Stats.UserStorage(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	added := size
+	if p.QuotaBasis == storagePhysical && existingRefCount > 0 {
+		added = size / int64(existingRefCount+1)
+	}
+
+	return basisBytes(p.QuotaBasis, logical, physical)+added <= p.QuotaBytes, nil
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRanges caps the ranges served from one request; more than this and the
+// Range header is ignored and the full object is sent (RFC 9110 §14.2).
+const maxRanges = 16
+
+// httpRange is bytes [start, start+length) of an object.
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) end() int64 { return r.start + r.length - 1 }
+
+func (r httpRange) contentRange(size int64) string {
+	return "bytes " + strconv.FormatInt(r.start, 10) + "-" + strconv.FormatInt(r.end(), 10) +
+		"/" + strconv.FormatInt(size, 10)
+}
+
+var errUnsatisfiableRange = errors.New("unsatisfiable range")
+
+// parseRange parses a "bytes=" Range header against an object of `size`
+// bytes. It returns nil ranges when the header should be ignored (absent,
+// malformed, a different unit, too many ranges, or covering the whole
+// object) and errUnsatisfiableRange when no range overlaps the object.
+func parseRange(header string, size int64) ([]httpRange, error) {
+	if header == "" {
+		return nil, nil
+	}
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+
+	var ranges []httpRange
+	var total int64
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, nil
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r httpRange
+		if first == "" {
+			// Suffix range: the last N bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = httpRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			if start >= size {
+				continue
+			}
+			end := size - 1
+			if last != "" {
+				e, err := strconv.ParseInt(last, 10, 64)
+				if err != nil || e < start {
+					return nil, nil
+				}
+				if e < end {
+					end = e
+				}
+			}
+			r = httpRange{start: start, length: end - start + 1}
+		}
+		if r.length == 0 {
+			continue
+		}
+		ranges = append(ranges, r)
+		total += r.length
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	if len(ranges) > maxRanges || total > size {
+		return nil, nil
+	}
+	if len(ranges) == 1 && ranges[0].start == 0 && ranges[0].length == size {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// etagMatches reports whether an If-None-Match / If-Range style list of
+// entity tags contains etag, using weak comparison.
+func etagMatches(list, etag string) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since
+// when no entity tags were sent (RFC 9110 §13.2.2).
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// rangeApplies evaluates If-Range: a Range request is only honoured when
+// the validator still matches the current representation. Only strong
+// entity tags or dates can be used.
+func rangeApplies(r *http.Request, etag string, lastModified time.Time) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) {
+		return ir == etag
+	}
+	t, err := http.ParseTime(ir)
+	if err != nil {
+		return false
+	}
+	return lastModified.Truncate(time.Second).Equal(t)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	const size = 1000
+	tests := []struct {
+		name   string
+		header string
+		want   []httpRange
+		err    error
+	}{
+		{"absent", "", nil, nil},
+		{"other unit", "items=0-5", nil, nil},
+		{"malformed", "bytes=abc", nil, nil},
+		{"reversed", "bytes=50-10", nil, nil},
+		{"closed", "bytes=0-99", []httpRange{{0, 100}}, nil},
+		{"end past size", "bytes=900-5000", []httpRange{{900, 100}}, nil},
+		{"open-ended", "bytes=990-", []httpRange{{990, 10}}, nil},
+		{"suffix", "bytes=-10", []httpRange{{990, 10}}, nil},
+		{"suffix larger than object", "bytes=-5000", nil, nil},
+		{"whole object", "bytes=0-", nil, nil},
+		{"multi", "bytes=0-9, 20-29,-5", []httpRange{{0, 10}, {20, 10}, {995, 5}}, nil},
+		{"multi skips unsatisfiable part", "bytes=0-9,2000-2010", []httpRange{{0, 10}}, nil},
+		{"overlapping exceeds size", "bytes=0-599,400-999", nil, nil},
+		{"start past end", "bytes=1000-", nil, errUnsatisfiableRange},
+		{"zero suffix", "bytes=-0", nil, errUnsatisfiableRange},
+		{"all unsatisfiable", "bytes=1000-1001,2000-", nil, errUnsatisfiableRange},
+		{"too many", "bytes=0-0,2-2,4-4,6-6,8-8,10-10,12-12,14-14,16-16,18-18,20-20,22-22,24-24,26-26,28-28,30-30,32-32", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRange(tt.header, size)
+			if err != tt.err || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRange(%q) = %v, %v; want %v, %v", tt.header, got, err, tt.want, tt.err)
+			}
+		})
+	}
+
+	if got := (httpRange{990, 10}).contentRange(size); got != "bytes 990-999/1000" {
+		t.Errorf("contentRange = %q", got)
+	}
+}
+
+func TestConditionalHeaders(t *testing.T) {
+	const etag = `"abc123"`
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+	at := func(d time.Duration) string { return modified.Add(d).Format(http.TimeFormat) }
+
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		notModified bool
+		rangeOK     bool
+	}{
+		{"no validators", nil, false, true},
+		{"etag match", map[string]string{"If-None-Match": etag}, true, true},
+		{"weak etag match", map[string]string{"If-None-Match": `W/"abc123"`}, true, true},
+		{"etag in list", map[string]string{"If-None-Match": `"x", "abc123"`}, true, true},
+		{"star", map[string]string{"If-None-Match": "*"}, true, true},
+		{"etag mismatch", map[string]string{"If-None-Match": `"other"`}, false, true},
+		{"etag wins over date", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": at(time.Hour)}, false, true},
+		{"not modified since", map[string]string{"If-Modified-Since": at(0)}, true, true},
+		{"modified since", map[string]string{"If-Modified-Since": at(-time.Hour)}, false, true},
+		{"bad date", map[string]string{"If-Modified-Since": "yesterday"}, false, true},
+		{"if-range current etag", map[string]string{"If-Range": etag}, false, true},
+		{"if-range stale etag", map[string]string{"If-Range": `"old"`}, false, false},
+		{"if-range weak etag", map[string]string{"If-Range": `W/"abc123"`}, false, false},
+		{"if-range current date", map[string]string{"If-Range": at(0)}, false, true},
+		{"if-range stale date", map[string]string{"If-Range": at(-time.Hour)}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := notModified(r, etag, modified); got != tt.notModified {
+				t.Errorf("notModified = %v, want %v", got, tt.notModified)
+			}
+			if got := rangeApplies(r, etag, modified); got != tt.rangeOK {
+				t.Errorf("rangeApplies = %v, want %v", got, tt.rangeOK)
+			}
+		})
+	}
+}
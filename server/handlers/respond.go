@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"server/logging"
+)
+
+//
+// 🔹 Error envelope
+//
+// Every error response has the same JSON body:
+//
+//	{"error": {"code": "not_found", "message": "File not found", "requestId": "..."}}
+//
+// code is stable and meant for programs; message is for people and may
+// change. Messages are always fixed strings: the underlying error is logged
+// by the handler (with the request ID) and never sent to the client.
+//
+const (
+	codeInvalidRequest   = "invalid_request"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeConflict         = "conflict"
+	codeQuarantined      = "quarantined"
+	codeQuotaExceeded    = "quota_exceeded"
+	codeTooLarge         = "request_too_large"
+	codeUnsupportedType  = "unsupported_media_type"
+	codeRangeInvalid     = "range_not_satisfiable"
+	codeRateLimited      = "rate_limited"
+	codeNotReady         = "not_ready" // pending scan or thumbnail; see Retry-After
+	codeUpstream         = "upstream_error"
+	codeInternal         = "internal"
+)
+
+// errorStatus is the HTTP status sent with each code.
+var errorStatus = map[string]int{
+	codeInvalidRequest:   http.StatusBadRequest,
+	codeNotFound:         http.StatusNotFound,
+	codeMethodNotAllowed: http.StatusMethodNotAllowed,
+	codeConflict:         http.StatusConflict,
+	codeQuarantined:      http.StatusForbidden,
+	codeQuotaExceeded:    http.StatusRequestEntityTooLarge,
+	codeTooLarge:         http.StatusRequestEntityTooLarge,
+	codeUnsupportedType:  http.StatusUnsupportedMediaType,
+	codeRangeInvalid:     http.StatusRequestedRangeNotSatisfiable,
+	codeRateLimited:      http.StatusTooManyRequests,
+	codeNotReady:         http.StatusServiceUnavailable,
+	codeUpstream:         http.StatusBadGateway,
+	codeInternal:         http.StatusInternalServerError,
+}
+
+// ✅ Body of every error response
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// ✅ Body of responses that only confirm an action
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// writeError sends the error envelope with the status for code.
+func writeError(w http.ResponseWriter, r *http.Request, code, message string) {
+	status, ok := errorStatus[code]
+	if !ok {
+		code, status = codeInternal, http.StatusInternalServerError
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Del("Content-Disposition")
+	h.Set("X-Content-Type-Options", "nosniff")
+	writeJSON(w, r, status, ErrorResponse{Error: APIError{
+		Code:      code,
+		Message:   message,
+		RequestID: logging.RequestID(r.Context()),
+	}})
+}
+
+// writeJSON sends v as the JSON body with status. HEAD requests get the
+// headers only.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+//
+// 🔹 Router fallbacks, so unknown routes get the envelope too
+//
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, codeNotFound, "No such endpoint")
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, codeMethodNotAllowed, "Method not allowed")
+}
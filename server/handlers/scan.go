@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"server/db"
+	"server/scanner"
+	"server/store"
+	"server/utils"
+)
+
+// quarantinePrefix is where infected blobs are moved so they can never be
+// served from their original key.
+const quarantinePrefix = "quarantine/"
+
+//
+// 🔹 Helper: Scan a blob's content and record the verdict
+//
+// content may be nil, in which case the blob is read back from storage.
+// Infected blobs are moved under quarantinePrefix. Returns the blob with its
+// updated status and key.
+//
+func (h *Handlers) scanBlob(ctx context.Context, b store.Blob, content io.Reader) store.Blob {
+	if content == nil {
+		body, err := h.openBlob(ctx, b, 0, b.Size-1)
+		if err != nil {
+			slog.ErrorContext(ctx, "scan failed: open blob", "blob_id", b.ID, "error", err)
+			return recordScan(ctx, b, scanner.StatusError, "")
+		}
+		defer body.Close()
+		content = body
+	}
+
+	res, err := scanner.Default.Scan(ctx, content)
+	if err != nil {
+		slog.ErrorContext(ctx, "scan failed", "blob_id", b.ID, "engine", scanner.Default.Name(), "error", err)
+		return recordScan(ctx, b, scanner.StatusError, "")
+	}
+
+	if res.Status == scanner.StatusInfected {
+		slog.WarnContext(ctx, "malware detected", "blob_id", b.ID, "hash", b.Hash, "signature", res.Signature)
+		b = quarantineBlob(ctx, b)
+		return recordScan(ctx, b, res.Status, res.Signature)
+	}
+
+	slog.InfoContext(ctx, "scan clean", "blob_id", b.ID, "engine", scanner.Default.Name())
+	b = recordScan(ctx, b, res.Status, res.Signature)
+	queueDerivedWork(ctx, b)
+	return b
+}
+
+// queueDerivedWork queues the jobs that read a blob's content, which only
+// run once it has been scanned clean.
+func queueDerivedWork(ctx context.Context, b store.Blob) {
+	queueThumbnails(ctx, b)
+	queueTextExtraction(ctx, b)
+}
+
+func recordScan(ctx context.Context, b store.Blob, status, signature string) store.Blob {
+	if err := saveScanVerdict(ctx, b, status, signature); err != nil {
+		slog.ErrorContext(ctx, "scan verdict not saved", "blob_id", b.ID, "error", err)
+	}
+	b.ScanStatus = status
+	return b
+}
+
+// saveScanVerdict stores the verdict and, when a blob first turns out to be
+// infected, writes a file.quarantined event for every file that holds it in
+// the same transaction.
+func saveScanVerdict(ctx context.Context, b store.Blob, status, signature string) error {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	_, err = tx.Exec(ctx, `
+		UPDATE file_blobs
+		SET scan_status = $2, scan_signature = NULLIF($3, ''), scan_engine = $4, scanned_at = NOW()
+		WHERE id = $1
+	`, b.ID, status, signature, scanner.Default.Name())
+	if err != nil {
+		return err
+	}
+
+	if status == scanner.StatusInfected && b.ScanStatus != scanner.StatusInfected {
+		rows, err := tx.Query(ctx, `
+			SELECT uf.id, uf.user_id, COALESCE(u.email, ''), uf.filename
+			FROM user_files uf
+			JOIN users u ON u.id = uf.user_id
+			WHERE uf.blob_id = $1
+		`, b.ID)
+		if err != nil {
+			return err
+		}
+		var holders []store.FileEvent
+		for rows.Next() {
+			var e store.FileEvent
+			if err := rows.Scan(&e.FileID, &e.UserID, &e.Email, &e.FileName); err != nil {
+				rows.Close()
+				return err
+			}
+			holders = append(holders, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, e := range holders {
+			e.Size, e.MimeType, e.Hash, e.S3Key, e.Signature = b.Size, b.MimeType, b.Hash, b.S3Key, signature
+			if err := emitEvent(ctx, tx, eventFileQuarantined, e.UserID, e); err != nil {
+				return fmt.Errorf("webhook outbox: %w", err)
+			}
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+//
+// 🔹 Helper: Move an infected blob's object under the quarantine prefix
+//
+// For chunked blobs only the manifest moves: chunks are content-addressed
+// and may be shared with clean files, and the blob cannot be reassembled
+// for download once its status is infected anyway.
+//
+func quarantineBlob(ctx context.Context, b store.Blob) store.Blob {
+	if strings.HasPrefix(b.S3Key, quarantinePrefix) {
+		return b
+	}
+	newKey := quarantinePrefix + b.S3Key
+	if err := utils.MoveInS3(ctx, b.S3Key, newKey); err != nil {
+		slog.ErrorContext(ctx, "quarantine move failed", "blob_id", b.ID, "key", b.S3Key, "error", err)
+		return b
+	}
+	if _, err := db.DB.Exec(ctx, `UPDATE file_blobs SET s3_key = $2 WHERE id = $1`, b.ID, newKey); err != nil {
+		slog.ErrorContext(ctx, "quarantine key not saved", "blob_id", b.ID, "key", newKey, "error", err)
+		return b
+	}
+	slog.WarnContext(ctx, "blob quarantined", "blob_id", b.ID, "key", newKey)
+	b.S3Key = newKey
+	return b
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/db"
+	"server/jobs"
+	"server/scanner"
+	"server/store"
+	"server/utils"
+)
+
+const jobExtractText = "extract.text"
+
+// file_blobs.content_status values
+const (
+	contentNone    = "none"
+	contentPending = "pending"
+	contentIndexed = "indexed"
+	contentFailed  = "failed"
+)
+
+// maxIndexedText caps the text kept per blob. Postgres tsvectors are limited
+// to 1 MiB, and the start of a document is what search needs most.
+const maxIndexedText = 512 << 10
+
+// Snippet highlight markers: private-use code points that cannot clash with
+// document text, swapped for <mark> after the snippet is HTML-escaped.
+const (
+	markStart = "\ue000"
+	markStop  = "\ue001"
+)
+
+type extractTextPayload struct {
+	BlobID int `json:"blob_id"`
+}
+
+//
+// 🔹 Helper: Queue text extraction for a clean document blob
+//
+func queueTextExtraction(ctx context.Context, b store.Blob) {
+	if !utils.CanExtractText(b.MimeType) {
+		return
+	}
+	_, err := db.DB.Exec(ctx, `
+		UPDATE file_blobs SET content_status = $2
+		WHERE id = $1 AND content_status <> $3
+	`, b.ID, contentPending, contentIndexed)
+	if err != nil {
+		slog.WarnContext(ctx, "content status not saved", "blob_id", b.ID, "error", err)
+		return
+	}
+	_, err = jobs.Enqueue(ctx, db.DB, jobExtractText, extractTextPayload{BlobID: b.ID}, jobs.Options{
+		UniqueKey: fmt.Sprintf("%s:%d", jobExtractText, b.ID),
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "text extraction not queued", "blob_id", b.ID, "error", err)
+		return
+	}
+	slog.DebugContext(ctx, "text extraction queued", "blob_id", b.ID)
+}
+
+func (h *Handlers) runExtractText(ctx context.Context, p extractTextPayload) error {
+	b, err := h.store.Blobs.ByID(ctx, p.BlobID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if b.ScanStatus != scanner.StatusClean || !utils.CanExtractText(b.MimeType) {
+		return nil
+	}
+
+	body, err := h.openBlob(ctx, b, 0, b.Size-1)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+
+	text, err := utils.ExtractText(data, b.MimeType, maxIndexedText)
+	if err != nil {
+		setContentStatus(ctx, b.ID, contentFailed)
+		return jobs.Permanent(fmt.Errorf("extract blob %d: %w", b.ID, err))
+	}
+
+	_, err = db.DB.Exec(ctx, `
+		UPDATE file_blobs SET content_text = $2, content_status = $3 WHERE id = $1
+	`, b.ID, text, contentIndexed)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "text indexed", "blob_id", b.ID, "bytes", len(text))
+	return nil
+}
+
+func setContentStatus(ctx context.Context, blobID int, status string) {
+	if _, err := db.DB.Exec(ctx, `UPDATE file_blobs SET content_status = $2 WHERE id = $1`, blobID, status); err != nil {
+		slog.WarnContext(ctx, "content status not saved", "blob_id", blobID, "error", err)
+	}
+}
+
+// ✅ One search hit
+type SearchResult struct {
+	ID         int       `json:"id"`
+	FileName   string    `json:"fileName"`
+	Size       int64     `json:"size"`
+	MimeType   string    `json:"mimeType"`
+	UploadDate time.Time `json:"uploadDate"`
+	S3Key      string    `json:"s3Key"`
+	Rank       float32   `json:"rank"`
+	// Snippet is HTML-escaped document text with matches wrapped in <mark>;
+	// empty when only the filename matched.
+	Snippet string `json:"snippet"`
+}
+
+//
+// 🔹 SearchFiles: GET /search?username=<email>&q=<query>&limit=20&offset=0
+//
+// q uses web search syntax ("quoted phrases", -excluded, OR) against the
+// extracted text of the caller's files; filenames containing q match too.
+// Content matches rank first.
+//
+func SearchFiles(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	username := params.Get("username")
+	q := strings.TrimSpace(params.Get("q"))
+	if username == "" || q == "" {
+		writeError(w, r, codeInvalidRequest, "username and q are required")
+		return
+	}
+
+	limit := 20
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, r, codeInvalidRequest, "limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if v := params.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, codeInvalidRequest, "offset must be a non-negative integer")
+			return
+		}
+		offset = n
+	}
+
+	slog.DebugContext(r.Context(), "search", "user", username, "query", q)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+	defer cancel()
+
+	// Snippets are only built for the page of hits returned, since
+	// ts_headline re-parses the whole document.
+	rows, err := db.Reader().Query(ctx, `
+		WITH q AS (SELECT websearch_to_tsquery('english', $2) AS query),
+		hits AS (
+			SELECT uf.id, uf.filename, fb.size, fb.mime_type, uf.uploaded_at, fb.s3_key, fb.id AS blob_id,
+			       fb.content_tsv @@ q.query AS content_match,
+			       ts_rank(fb.content_tsv, q.query) AS rank
+			FROM user_files uf
+			JOIN file_blobs fb ON fb.id = uf.blob_id
+			JOIN users u ON u.id = uf.user_id
+			CROSS JOIN q
+			WHERE u.email = $1 AND uf.trashed_at IS NULL
+			  AND (fb.content_tsv @@ q.query OR uf.filename ILIKE $3)
+			ORDER BY content_match DESC, rank DESC, uf.uploaded_at DESC, uf.id DESC
+			LIMIT $4 OFFSET $5
+		)
+		SELECT h.id, h.filename, h.size, COALESCE(h.mime_type, ''), h.uploaded_at, h.s3_key, h.rank,
+		       CASE WHEN h.content_match
+		            THEN ts_headline('english', fb.content_text, q.query,
+		                 'StartSel="`+markStart+`", StopSel="`+markStop+`", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "')
+		            ELSE '' END
+		FROM hits h
+		JOIN file_blobs fb ON fb.id = h.blob_id
+		CROSS JOIN q
+		ORDER BY h.content_match DESC, h.rank DESC, h.uploaded_at DESC, h.id DESC
+	`, username, q, "%"+escapeLike(q)+"%", limit, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "search failed", "user", username, "error", err)
+		writeError(w, r, codeInternal, "Search failed")
+		return
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var res SearchResult
+		if err := rows.Scan(&res.ID, &res.FileName, &res.Size, &res.MimeType, &res.UploadDate, &res.S3Key,
+			&res.Rank, &res.Snippet); err != nil {
+			slog.ErrorContext(ctx, "search scan failed", "user", username, "error", err)
+			writeError(w, r, codeInternal, "Search failed")
+			return
+		}
+		res.Snippet = highlightSnippet(res.Snippet)
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "search failed", "user", username, "error", err)
+		writeError(w, r, codeInternal, "Search failed")
+		return
+	}
+	slog.InfoContext(ctx, "search", "user", username, "hits", len(results))
+
+	writeJSON(w, r, http.StatusOK, results)
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// highlightSnippet escapes a ts_headline fragment for HTML and turns the
+// match markers into <mark> tags.
+func highlightSnippet(s string) string {
+	s = html.EscapeString(strings.Join(strings.Fields(s), " "))
+	s = strings.ReplaceAll(s, markStart, "<mark>")
+	return strings.ReplaceAll(s, markStop, "</mark>")
+}
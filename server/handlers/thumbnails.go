@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"server/db"
+	"server/jobs"
+	"server/scanner"
+	"server/store"
+	"server/utils"
+)
+
+const jobThumbnailBlob = "thumbnail.blob"
+
+// file_blobs.thumbnail_status values
+const (
+	thumbnailNone    = "none"
+	thumbnailPending = "pending"
+	thumbnailReady   = "ready"
+	thumbnailFailed  = "failed"
+)
+
+// thumbnailSizes are generated for every image, largest first so each
+// smaller size is scaled from the previous one rather than the original.
+var thumbnailSizes = []struct {
+	Name   string
+	MaxDim int
+}{
+	{"large", 512},
+	{"medium", 256},
+	{"small", 128},
+}
+
+// thumbnailTypes are the stored MIME types we render thumbnails for.
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+type thumbnailPayload struct {
+	BlobID int `json:"blob_id"`
+}
+
+// thumbnailSize resolves ?size= (a name, or a pixel size such as 256).
+func thumbnailSize(v string) (string, bool) {
+	if v == "" {
+		return "medium", true
+	}
+	for _, s := range thumbnailSizes {
+		if v == s.Name || v == strconv.Itoa(s.MaxDim) {
+			return s.Name, true
+		}
+	}
+	return "", false
+}
+
+//
+// 🔹 Helper: Queue thumbnail generation for a clean image blob
+//
+func queueThumbnails(ctx context.Context, b store.Blob) {
+	if !thumbnailTypes[b.MimeType] {
+		return
+	}
+	_, err := db.DB.Exec(ctx, `
+		UPDATE file_blobs SET thumbnail_status = $2
+		WHERE id = $1 AND thumbnail_status <> $3
+	`, b.ID, thumbnailPending, thumbnailReady)
+	if err != nil {
+		slog.WarnContext(ctx, "thumbnail status not saved", "blob_id", b.ID, "error", err)
+		return
+	}
+	_, err = jobs.Enqueue(ctx, db.DB, jobThumbnailBlob, thumbnailPayload{BlobID: b.ID}, jobs.Options{
+		UniqueKey: fmt.Sprintf("%s:%d", jobThumbnailBlob, b.ID),
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "thumbnail job not queued", "blob_id", b.ID, "error", err)
+		return
+	}
+	slog.DebugContext(ctx, "thumbnails queued", "blob_id", b.ID)
+}
+
+func (h *Handlers) runThumbnailBlob(ctx context.Context, p thumbnailPayload) error {
+	b, err := h.store.Blobs.ByID(ctx, p.BlobID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Only content that passed the malware scan is decoded.
+	if b.ScanStatus != scanner.StatusClean || !thumbnailTypes[b.MimeType] {
+		return nil
+	}
+
+	body, err := h.openBlob(ctx, b, 0, b.Size-1)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+
+	img, format, err := utils.DecodeImage(data)
+	if err != nil {
+		setThumbnailStatus(ctx, b.ID, thumbnailFailed)
+		return jobs.Permanent(fmt.Errorf("decode blob %d: %w", b.ID, err))
+	}
+
+	for _, size := range thumbnailSizes {
+		img = utils.ResizeToFit(img, size.MaxDim)
+		out, mimeType, ext, err := utils.EncodeThumbnail(img, format)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("thumbnails/%s/%s.%s", b.Hash, size.Name, ext)
+		if err := utils.UploadToS3(ctx, bytes.NewReader(out), key); err != nil {
+			return err
+		}
+		bounds := img.Bounds()
+		_, err = db.DB.Exec(ctx, `
+			INSERT INTO blob_thumbnails (hash, size, s3_key, mime_type, width, height, bytes)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (hash, size) DO UPDATE SET
+				s3_key = EXCLUDED.s3_key, mime_type = EXCLUDED.mime_type,
+				width = EXCLUDED.width, height = EXCLUDED.height,
+				bytes = EXCLUDED.bytes, created_at = NOW()
+		`, b.Hash, size.Name, key, mimeType, bounds.Dx(), bounds.Dy(), len(out))
+		if err != nil {
+			return err
+		}
+	}
+
+	setThumbnailStatus(ctx, b.ID, thumbnailReady)
+	slog.InfoContext(ctx, "thumbnails ready", "blob_id", b.ID, "hash", b.Hash)
+	return nil
+}
+
+func setThumbnailStatus(ctx context.Context, blobID int, status string) {
+	if _, err := db.DB.Exec(ctx, `UPDATE file_blobs SET thumbnail_status = $2 WHERE id = $1`, blobID, status); err != nil {
+		slog.WarnContext(ctx, "thumbnail status not saved", "blob_id", blobID, "error", err)
+	}
+}
+
+//
+// 🔹 Helper: Delete a blob's thumbnails (when its last reference goes)
+//
+func deleteThumbnails(ctx context.Context, hash string) {
+	rows, err := db.DB.Query(ctx, `DELETE FROM blob_thumbnails WHERE hash = $1 RETURNING s3_key`, hash)
+	if err != nil {
+		slog.WarnContext(ctx, "thumbnail delete failed", "hash", hash, "error", err)
+		return
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		slog.WarnContext(ctx, "thumbnail delete failed", "hash", hash, "error", err)
+		return
+	}
+	for _, k := range keys {
+		if err := utils.DeleteFromS3(ctx, k); err != nil {
+			slog.WarnContext(ctx, "thumbnail object delete failed", "key", k, "error", err)
+		}
+	}
+}
+
+//
+// 🔹 GetThumbnail: GET /files/{id}/thumbnail?size=small|medium|large
+//
+// {id} is the user_files id from /files. Thumbnails never change for a
+// given file, so they are cacheable for a long time.
+//
+func GetThumbnail(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, codeInvalidRequest, "invalid file id")
+		return
+	}
+	size, ok := thumbnailSize(r.URL.Query().Get("size"))
+	if !ok {
+		writeError(w, r, codeInvalidRequest, "size must be small, medium or large")
+		return
+	}
+	username := r.URL.Query().Get("username")
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+	defer cancel()
+
+	var (
+		hash, scanStatus, thumbStatus string
+		key, mimeType                 *string
+		length                        *int64
+		createdAt                     *time.Time
+	)
+	err = db.DB.QueryRow(ctx, `
+		SELECT fb.hash, fb.scan_status, fb.thumbnail_status, bt.s3_key, bt.mime_type, bt.bytes, bt.created_at
+		FROM user_files uf
+		JOIN file_blobs fb ON fb.id = uf.blob_id
+		JOIN users u ON u.id = uf.user_id
+		LEFT JOIN blob_thumbnails bt ON bt.hash = fb.hash AND bt.size = $2
+		WHERE uf.id = $1 AND ($3 = '' OR u.email = $3)
+	`, fileID, size, username).Scan(&hash, &scanStatus, &thumbStatus, &key, &mimeType, &length, &createdAt)
+	if err != nil {
+		writeError(w, r, codeNotFound, "File not found")
+		return
+	}
+
+	switch {
+	case scanStatus == scanner.StatusInfected:
+		writeError(w, r, codeQuarantined, "File is quarantined: malware detected")
+		return
+	case thumbStatus == thumbnailNone:
+		writeError(w, r, codeNotFound, "No thumbnail for this file type")
+		return
+	case thumbStatus == thumbnailFailed:
+		writeError(w, r, codeNotFound, "Thumbnail could not be generated")
+		return
+	case key == nil:
+		// Waiting for the scan and thumbnail jobs.
+		w.Header().Set("Retry-After", "30")
+		writeError(w, r, codeNotReady, "Thumbnail is not ready yet")
+		return
+	}
+
+	etag := `"` + hash + "-" + size + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", createdAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if notModified(r, etag, *createdAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", *mimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(*length, 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	body, err := utils.DownloadFromS3(ctx, *key)
+	if err != nil {
+		slog.ErrorContext(ctx, "thumbnail fetch failed", "key", *key, "error", err)
+		w.Header().Del("Content-Length")
+		writeError(w, r, codeUpstream, "Thumbnail fetch failed")
+		return
+	}
+	defer body.Close()
+	if _, err := io.Copy(w, body); err != nil {
+		slog.WarnContext(ctx, "thumbnail stream interrupted", "key", *key, "error", err)
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"server/config"
+	"server/store"
+)
+
+var (
+	usageLocOnce sync.Once
+	usageLoc     *time.Location
+)
+
+// usageLocation returns the timezone whose calendar months bound the usage
+// ledger (USAGE_TIMEZONE, default UTC).
+func usageLocation() *time.Location {
+	usageLocOnce.Do(func() {
+		usageLoc = time.UTC
+		name := config.Get().Uploads.UsageTimezone
+		if name == "" {
+			return
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			slog.Warn("invalid USAGE_TIMEZONE, falling back to UTC", "value", name, "error", err)
+			return
+		}
+		usageLoc = loc
+	})
+	return usageLoc
+}
+
+// usageMonth returns the first day of the usage month containing t, as a
+// date-only value suitable for the `month` columns.
+func usageMonth(t time.Time) time.Time {
+	local := t.In(usageLocation())
+	return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// currentUsageMonth returns the usage month for now.
+func currentUsageMonth() time.Time {
+	return usageMonth(time.Now())
+}
+
+// usageDelta is a single increment to a user's monthly usage.
+type usageDelta struct {
+	Uploads     int
+	Downloads   int
+	UploadBytes int64
+	EgressBytes int64
+}
+
+//
+// 🔹 Helper: Record usage in the monthly ledger and roll over user_stats
+//
+func (h *Handlers) recordUsage(ctx context.Context, userID int, d usageDelta) error {
+	return h.store.Stats.RecordUsage(ctx, userID, store.Usage{
+		Month:       currentUsageMonth(),
+		Uploads:     d.Uploads,
+		Downloads:   d.Downloads,
+		UploadBytes: d.UploadBytes,
+		EgressBytes: d.EgressBytes,
+	})
+}
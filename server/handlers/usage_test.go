@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"server/store"
+)
+
+// setUsageLocation replaces the ledger timezone for the rest of the test.
+func setUsageLocation(t *testing.T, name string) {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s unavailable: %v", name, err)
+	}
+	usageLocOnce.Do(func() {})
+	old := usageLoc
+	usageLoc = loc
+	t.Cleanup(func() { usageLoc = old })
+}
+
+func TestUsageMonth(t *testing.T) {
+	date := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	month := func(y int, m time.Month) time.Time { return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		zone string
+		at   string
+		want time.Time
+	}{
+		{"UTC", "2026-01-31T23:59:59Z", month(2026, time.January)},
+		{"UTC", "2026-02-01T00:00:00Z", month(2026, time.February)},
+		{"UTC", "2026-12-31T23:59:59Z", month(2026, time.December)},
+		{"UTC", "2027-01-01T00:00:00Z", month(2027, time.January)},
+		{"UTC", "2028-02-29T12:00:00Z", month(2028, time.February)},
+		// Still January in New York, already February in Tokyo
+		{"America/New_York", "2026-02-01T03:00:00Z", month(2026, time.January)},
+		{"America/New_York", "2026-02-01T05:00:00Z", month(2026, time.February)},
+		{"Asia/Tokyo", "2026-01-31T14:59:59Z", month(2026, time.January)},
+		{"Asia/Tokyo", "2026-01-31T15:00:00Z", month(2026, time.February)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone+" "+tt.at, func(t *testing.T) {
+			setUsageLocation(t, tt.zone)
+			if got := usageMonth(date(tt.at)); !got.Equal(tt.want) {
+				t.Errorf("usageMonth = %s, want %s", got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+			}
+		})
+	}
+}
+
+// An upload in the last second of a month and one in the first second of
+// the next land in different ledger rows, and the second resets the
+// this-month counters.
+func TestUsageRollover(t *testing.T) {
+	setUsageLocation(t, "Asia/Tokyo")
+	env := newTestEnv(t)
+	userID := env.user(t, "a@example.com")
+	ctx := context.Background()
+
+	lastSecond := time.Date(2026, 1, 31, 23, 59, 59, 0, usageLoc)
+	for _, at := range []time.Time{lastSecond, lastSecond, lastSecond.Add(time.Second)} {
+		if err := env.h.store.Stats.RecordUsage(ctx, userID, store.Usage{Month: usageMonth(at), Uploads: 1, UploadBytes: 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jan := env.mem.Usage(userID, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	feb := env.mem.Usage(userID, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+	if jan.Uploads != 2 || jan.UploadBytes != 20 || feb.Uploads != 1 || feb.UploadBytes != 10 {
+		t.Errorf("ledger: January %+v, February %+v", jan, feb)
+	}
+	if s := env.mem.UserStats(userID); s.UploadsThisMonth != 1 || !s.StatsMonth.Equal(feb.Month) {
+		t.Errorf("user_stats: %d uploads this month, month %s", s.UploadsThisMonth, s.StatsMonth)
+	}
+}
@@ -0,0 +1,662 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"server/config"
+	"server/db"
+	"server/jobs"
+	"server/logging"
+	"server/store"
+)
+
+// Webhook event types
+const (
+	eventFileUploaded    = store.EventFileUploaded
+	eventFileDeleted     = store.EventFileDeleted
+	eventFileTrashed     = store.EventFileTrashed
+	eventFileRestored    = store.EventFileRestored
+	eventFileShared      = store.EventFileShared
+	eventFileQuarantined = "file.quarantined"
+)
+
+var webhookEventTypes = map[string]bool{
+	eventFileUploaded:    true,
+	eventFileDeleted:     true,
+	eventFileTrashed:     true,
+	eventFileRestored:    true,
+	eventFileShared:      true,
+	eventFileQuarantined: true,
+}
+
+const (
+	jobWebhookDispatch    = "webhook.dispatch"
+	jobWebhookDeliver     = "webhook.deliver"
+	jobPurgeWebhookEvents = "purge.webhook_events"
+
+	// webhookMaxAttempts spans about four hours with the queue's backoff.
+	webhookMaxAttempts = 12
+	// webhookResponseLimit is how much of a receiver's response is logged.
+	webhookResponseLimit = 1024
+)
+
+type webhookDispatchPayload struct {
+	EventID int64 `json:"event_id"`
+}
+
+type webhookDeliverPayload struct {
+	DeliveryID int64 `json:"delivery_id"`
+}
+
+type purgeWebhookEventsPayload struct {
+	Days int `json:"days"`
+}
+
+// webhookEnvelope is the JSON body POSTed to subscribers.
+type webhookEnvelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func registerWebhookJobs() error {
+	jobs.RegisterTyped(jobWebhookDispatch, 0, runWebhookDispatch)
+	jobs.Register(jobWebhookDeliver, time.Minute, runWebhookDeliver)
+	jobs.RegisterTyped(jobPurgeWebhookEvents, 0, runPurgeWebhookEvents)
+	return jobs.Schedule("purge-webhook-events", "30 3 * * *", jobPurgeWebhookEvents, purgeWebhookEventsPayload{
+		Days: config.Get().Webhooks.RetentionDays,
+	})
+}
+
+//
+// 🔹 Helper: Record a webhook event in the outbox
+//
+// q must be the transaction of the change the event describes: the event
+// and the job that delivers it commit or roll back with it. Events nobody
+// subscribes to are not stored.
+//
+func emitEvent(ctx context.Context, q jobs.Querier, eventType string, userID int, data interface{}) error {
+	var subscribed bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM webhook_subscriptions
+			WHERE active
+			  AND (user_id IS NULL OR user_id = $1)
+			  AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+		)
+	`, userID, eventType).Scan(&subscribed)
+	if err != nil || !subscribed {
+		return err
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encode %s event: %w", eventType, err)
+	}
+	var eventID int64
+	err = q.QueryRow(ctx, `
+		INSERT INTO webhook_events (event_type, user_id, payload)
+		VALUES ($1, NULLIF($2, 0), $3)
+		RETURNING id
+	`, eventType, userID, body).Scan(&eventID)
+	if err != nil {
+		return err
+	}
+	_, err = jobs.Enqueue(ctx, q, jobWebhookDispatch, webhookDispatchPayload{EventID: eventID}, jobs.Options{})
+	return err
+}
+
+// runWebhookDispatch fans an event out into one delivery (and delivery job)
+// per matching subscription. Re-running it is harmless.
+func runWebhookDispatch(ctx context.Context, p webhookDispatchPayload) error {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx, `
+		INSERT INTO webhook_deliveries (subscription_id, event_id)
+		SELECT s.id, e.id
+		FROM webhook_events e
+		JOIN webhook_subscriptions s
+		  ON s.active
+		 AND (s.user_id IS NULL OR s.user_id = e.user_id)
+		 AND (cardinality(s.event_types) = 0 OR e.event_type = ANY(s.event_types))
+		WHERE e.id = $1
+		ON CONFLICT (subscription_id, event_id) DO NOTHING
+		RETURNING id
+	`, p.EventID)
+	if err != nil {
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err := jobs.Enqueue(ctx, tx, jobWebhookDeliver, webhookDeliverPayload{DeliveryID: id}, jobs.Options{
+			MaxAttempts: webhookMaxAttempts,
+			UniqueKey:   fmt.Sprintf("%s:%d", jobWebhookDeliver, id),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "webhook event dispatched", "event_id", p.EventID, "deliveries", len(ids))
+	return nil
+}
+
+// runWebhookDeliver makes one delivery attempt. It takes the raw job so the
+// delivery is marked failed on the queue's final attempt.
+func runWebhookDeliver(ctx context.Context, job *jobs.Job) error {
+	var p webhookDeliverPayload
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	var (
+		subID                     int
+		target, secret, eventType string
+		active                    bool
+		eventID                   int64
+		data                      json.RawMessage
+		createdAt                 time.Time
+		status                    string
+	)
+	err := db.DB.QueryRow(ctx, `
+		SELECT s.id, s.url, s.secret, s.active, e.id, e.event_type, e.payload, e.created_at, d.status
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		JOIN webhook_events e ON e.id = d.event_id
+		WHERE d.id = $1
+	`, p.DeliveryID).Scan(&subID, &target, &secret, &active, &eventID, &eventType, &data, &createdAt, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Subscription deleted since.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if status != "pending" {
+		return nil
+	}
+	if !active {
+		recordDelivery(ctx, p.DeliveryID, "failed", 0, "", "subscription disabled", 0)
+		return nil
+	}
+
+	body, err := json.Marshal(webhookEnvelope{ID: eventID, Type: eventType, CreatedAt: createdAt, Data: data})
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	code, respBody, took, sendErr := sendWebhook(ctx, target, secret, eventType, p.DeliveryID, body)
+	if sendErr == nil && (code < 200 || code > 299) {
+		sendErr = fmt.Errorf("receiver returned %d", code)
+	}
+
+	switch {
+	case sendErr == nil:
+		recordDelivery(ctx, p.DeliveryID, "succeeded", code, respBody, "", took)
+		slog.InfoContext(ctx, "webhook delivered", "delivery_id", p.DeliveryID, "subscription_id", subID, "status", code)
+		return nil
+
+	case code == http.StatusGone:
+		// The receiver asked us to stop.
+		recordDelivery(ctx, p.DeliveryID, "failed", code, respBody, sendErr.Error(), took)
+		_, _ = db.DB.Exec(ctx, `UPDATE webhook_subscriptions SET active = false, updated_at = NOW() WHERE id = $1`, subID)
+		slog.WarnContext(ctx, "webhook subscription disabled (410 Gone)", "subscription_id", subID)
+		return jobs.Permanent(sendErr)
+
+	default:
+		status := "pending"
+		if job.Attempts >= job.MaxAttempts {
+			status = "failed"
+		}
+		recordDelivery(ctx, p.DeliveryID, status, code, respBody, sendErr.Error(), took)
+		return sendErr
+	}
+}
+
+func recordDelivery(ctx context.Context, id int64, status string, code int, respBody, lastErr string, took time.Duration) {
+	_, err := db.DB.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1,
+		    response_status = NULLIF($3, 0), response_body = NULLIF($4, ''), last_error = NULLIF($5, ''),
+		    duration_ms = $6, updated_at = NOW(),
+		    delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() END
+		WHERE id = $1
+	`, id, status, code, respBody, lastErr, took.Milliseconds())
+	if err != nil {
+		slog.ErrorContext(ctx, "webhook delivery not recorded", "delivery_id", id, "error", err)
+	}
+}
+
+// webhookClient does not follow redirects and, unless
+// WEBHOOK_ALLOW_PRIVATE=true, refuses to connect to loopback, private, CGNAT
+// and link-local addresses. The check runs on the resolved address at dial
+// time, so DNS tricks cannot point a subscription at internal services.
+var webhookClient = func() *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: webhookDialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   15 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}()
+
+// cgnatRange is the carrier-grade NAT shared space (RFC 6598), which
+// net.IP.IsPrivate does not cover but is just as internal.
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	if config.Get().Webhooks.AllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || cgnatRange.Contains(ip) {
+		return fmt.Errorf("webhook target %s is not a public address", host)
+	}
+	return nil
+}
+
+//
+// 🔹 Helper: POST a signed webhook body
+//
+// The signature header is "t=<unix seconds>,v1=<hex HMAC-SHA256 of
+// "<t>.<body>" keyed with the subscription secret>". Receivers should
+// recompute it and reject stale timestamps to prevent replays.
+//
+func sendWebhook(ctx context.Context, target, secret, eventType string, deliveryID int64, body []byte) (int, string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, strings.NewReader(string(body)))
+	if err != nil {
+		return 0, "", 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SkyVault-Webhooks/1.0")
+	req.Header.Set("X-SkyVault-Event", eventType)
+	req.Header.Set("X-SkyVault-Delivery", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("X-SkyVault-Signature", "t="+strconv.FormatInt(ts, 10)+",v1="+signWebhook(secret, ts, body))
+
+	start := time.Now()
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, "", time.Since(start), err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	return resp.StatusCode, strings.ToValidUTF8(string(respBody), ""), time.Since(start), nil
+}
+
+func signWebhook(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func runPurgeWebhookEvents(ctx context.Context, p purgeWebhookEventsPayload) error {
+	tag, err := db.DB.Exec(ctx, `
+		DELETE FROM webhook_events e
+		WHERE e.created_at < NOW() - make_interval(days => $1)
+		  AND NOT EXISTS (
+			SELECT 1 FROM webhook_deliveries d WHERE d.event_id = e.id AND d.status = 'pending'
+		  )
+	`, p.Days)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "purged webhook events", "count", tag.RowsAffected())
+	return nil
+}
+
+//
+// 🔹 Subscription management
+//
+
+// ✅ A webhook subscription as returned by the API
+type WebhookSubscription struct {
+	ID          int       `json:"id"`
+	UserID      *int      `json:"userId"` // null for system-wide subscriptions
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Secret is only returned when the subscription is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+// ✅ One delivery of an event to a subscription
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	SubscriptionID int        `json:"subscriptionId"`
+	EventID        int64      `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus *int       `json:"responseStatus"`
+	ResponseBody   *string    `json:"responseBody"`
+	LastError      *string    `json:"lastError"`
+	DurationMs     *int       `json:"durationMs"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+}
+
+type WebhookRequest struct {
+	Username    string   `json:"username"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+}
+
+// webhookOwner resolves which subscriptions a request may see: the user
+// named by ?username= on the user routes, or everything (nil) on /admin.
+// On failure it returns the error code and message to send.
+func webhookOwner(ctx context.Context, r *http.Request, admin bool) (*int, string, string) {
+	if admin {
+		return nil, "", ""
+	}
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		return nil, codeInvalidRequest, "username is required"
+	}
+	var userID int
+	err := db.DB.QueryRow(ctx, `SELECT id FROM users WHERE email=$1`, username).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, codeNotFound, "User not found"
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "webhook owner lookup failed", "error", err)
+		return nil, codeInternal, "User lookup failed"
+	}
+	logging.SetUserID(ctx, userID)
+	return &userID, "", ""
+}
+
+func validateWebhookRequest(req *WebhookRequest) string {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "url must be an absolute http(s) URL"
+	}
+	seen := map[string]bool{}
+	events := []string{}
+	for _, e := range req.Events {
+		if !webhookEventTypes[e] {
+			return "unknown event type " + e
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+	req.Events = events
+	return ""
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func (h *Handlers) createWebhook(w http.ResponseWriter, r *http.Request, admin bool) {
+	var req WebhookRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, r, codeInvalidRequest, "Invalid JSON body")
+		return
+	}
+	if reason := validateWebhookRequest(&req); reason != "" {
+		writeError(w, r, codeInvalidRequest, reason)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	var userID *int
+	if !admin {
+		if req.Username == "" {
+			writeError(w, r, codeInvalidRequest, "username is required")
+			return
+		}
+		user, err := h.store.Users.Ensure(ctx, req.Username)
+		if err != nil {
+			slog.ErrorContext(ctx, "webhook create failed: ensure user", "error", err)
+			writeError(w, r, codeInternal, "User creation failed")
+			return
+		}
+		logging.SetUserID(ctx, user.ID)
+		userID = &user.ID
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		writeError(w, r, codeInternal, "Failed to create webhook")
+		return
+	}
+
+	sub := WebhookSubscription{UserID: userID, URL: req.URL, Events: req.Events, Description: req.Description, Active: true, Secret: secret}
+	err = db.DB.QueryRow(ctx, `
+		INSERT INTO webhook_subscriptions (user_id, url, secret, event_types, description)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, userID, req.URL, secret, req.Events, req.Description).Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "webhook create failed", "error", err)
+		writeError(w, r, codeInternal, "Failed to create webhook")
+		return
+	}
+	slog.InfoContext(ctx, "webhook subscription created", "subscription_id", sub.ID, "system", admin, "events", req.Events)
+
+	writeJSON(w, r, http.StatusCreated, sub)
+}
+
+func listWebhooks(w http.ResponseWriter, r *http.Request, admin bool) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	owner, code, msg := webhookOwner(ctx, r, admin)
+	if code != "" {
+		writeError(w, r, code, msg)
+		return
+	}
+
+	rows, err := db.DB.Query(ctx, `
+		SELECT id, user_id, url, event_types, description, active, created_at
+		FROM webhook_subscriptions
+		WHERE $1::integer IS NULL OR user_id = $1
+		ORDER BY id
+	`, owner)
+	if err != nil {
+		slog.ErrorContext(ctx, "webhook list failed", "error", err)
+		writeError(w, r, codeInternal, "Failed to fetch webhooks")
+		return
+	}
+	defer rows.Close()
+
+	subs := []WebhookSubscription{}
+	for rows.Next() {
+		var s WebhookSubscription
+		if err := rows.Scan(&s.ID, &s.UserID, &s.URL, &s.Events, &s.Description, &s.Active, &s.CreatedAt); err != nil {
+			slog.ErrorContext(ctx, "webhook list scan failed", "error", err)
+			writeError(w, r, codeInternal, "Failed to fetch webhooks")
+			return
+		}
+		subs = append(subs, s)
+	}
+
+	writeJSON(w, r, http.StatusOK, subs)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request, admin bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeError(w, r, codeInvalidRequest, "webhook id is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	owner, code, msg := webhookOwner(ctx, r, admin)
+	if code != "" {
+		writeError(w, r, code, msg)
+		return
+	}
+
+	tag, err := db.DB.Exec(ctx, `
+		DELETE FROM webhook_subscriptions WHERE id = $1 AND ($2::integer IS NULL OR user_id = $2)
+	`, id, owner)
+	if err != nil {
+		slog.ErrorContext(ctx, "webhook delete failed", "subscription_id", id, "error", err)
+		writeError(w, r, codeInternal, "Failed to delete webhook")
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		writeError(w, r, codeNotFound, "Webhook not found")
+		return
+	}
+	slog.InfoContext(ctx, "webhook subscription deleted", "subscription_id", id)
+	writeJSON(w, r, http.StatusOK, MessageResponse{Message: "Webhook deleted"})
+}
+
+func listWebhookDeliveries(w http.ResponseWriter, r *http.Request, admin bool) {
+	params := r.URL.Query()
+
+	limit := 50
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			writeError(w, r, codeInvalidRequest, "limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+	subID := 0
+	if v := params.Get("subscription_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, r, codeInvalidRequest, "subscription_id must be an integer")
+			return
+		}
+		subID = n
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	owner, code, msg := webhookOwner(ctx, r, admin)
+	if code != "" {
+		writeError(w, r, code, msg)
+		return
+	}
+
+	rows, err := db.DB.Query(ctx, `
+		SELECT d.id, d.subscription_id, d.event_id, e.event_type, d.status, d.attempts,
+		       d.response_status, d.response_body, d.last_error, d.duration_ms, d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		JOIN webhook_events e ON e.id = d.event_id
+		WHERE ($1::integer IS NULL OR s.user_id = $1)
+		  AND ($2 = 0 OR d.subscription_id = $2)
+		  AND ($3 = '' OR d.status = $3)
+		ORDER BY d.id DESC
+		LIMIT $4
+	`, owner, subID, params.Get("status"), limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "webhook delivery list failed", "error", err)
+		writeError(w, r, codeInternal, "Failed to fetch deliveries")
+		return
+	}
+	defer rows.Close()
+
+	list := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Status, &d.Attempts,
+			&d.ResponseStatus, &d.ResponseBody, &d.LastError, &d.DurationMs, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			slog.ErrorContext(ctx, "webhook delivery scan failed", "error", err)
+			writeError(w, r, codeInternal, "Failed to fetch deliveries")
+			return
+		}
+		list = append(list, d)
+	}
+
+	writeJSON(w, r, http.StatusOK, list)
+}
+
+//
+// 🔹 User routes: a user's own subscriptions (?username=)
+//
+func (h *Handlers) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	h.createWebhook(w, r, false)
+}
+
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	listWebhooks(w, r, false)
+}
+
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	deleteWebhook(w, r, false)
+}
+
+func ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	listWebhookDeliveries(w, r, false)
+}
+
+//
+// 🔹 Admin routes: create system-wide subscriptions; list, delete and
+// inspect deliveries of every subscription
+//
+func (h *Handlers) CreateSystemWebhook(w http.ResponseWriter, r *http.Request) {
+	h.createWebhook(w, r, true)
+}
+
+func ListAllWebhooks(w http.ResponseWriter, r *http.Request) {
+	listWebhooks(w, r, true)
+}
+
+func DeleteAnyWebhook(w http.ResponseWriter, r *http.Request) {
+	deleteWebhook(w, r, true)
+}
+
+func ListAllWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	listWebhookDeliveries(w, r, true)
+}
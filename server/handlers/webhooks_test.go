@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"testing"
+
+	"server/config"
+)
+
+func TestSignWebhook(t *testing.T) {
+	tests := []struct {
+		secret string
+		ts     int64
+		body   string
+		want   string
+	}{
+		{"whsec_test", 1767225600, `{"type":"file.uploaded"}`, "f5f993d6c4edf7c24aa11907b636592e141ca903e43f72b827a2fb7401a54218"},
+		{"key", 0, "", "85841b4efc3cd7776c3c8f9b7cca9e281c550e5d19889d78e9e669c6337f000d"},
+	}
+	for _, tt := range tests {
+		if got := signWebhook(tt.secret, tt.ts, []byte(tt.body)); got != tt.want {
+			t.Errorf("signWebhook(%q, %d, %q) = %s, want %s", tt.secret, tt.ts, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:4700::1111]:443", true},
+		{"100.63.255.255:443", true},
+		{"100.128.0.0:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false}, // cloud metadata
+		{"[fe80::1]:80", false},
+		{"[fd12:3456::1]:80", false}, // IPv6 ULA
+		{"100.64.0.1:80", false},     // CGNAT
+		{"100.127.255.254:80", false},
+		{"[::ffff:10.0.0.1]:80", false},
+		{"0.0.0.0:80", false},
+		{"224.0.0.1:80", false},
+		{"example.com:80", false},
+	}
+	for _, tt := range tests {
+		err := webhookDialControl("tcp", tt.address, nil)
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s: err = %v, want allowed=%v", tt.address, err, tt.allowed)
+		}
+	}
+
+	old := config.Get()
+	cfg := *old
+	cfg.Webhooks.AllowPrivate = true
+	config.Set(&cfg)
+	t.Cleanup(func() { config.Set(old) })
+	if err := webhookDialControl("tcp", "127.0.0.1:80", nil); err != nil {
+		t.Errorf("WEBHOOK_ALLOW_PRIVATE=true: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		spec, from, want string
+	}{
+		{"* * * * *", "2026-03-01 10:00", "2026-03-01 10:01"},
+		{"@hourly", "2026-03-01 10:00", "2026-03-01 11:00"},
+		{"@daily", "2026-03-01 10:00", "2026-03-02 00:00"},
+		{"*/15 * * * *", "2026-03-01 10:07", "2026-03-01 10:15"},
+		{"*/15 * * * *", "2026-03-01 10:45", "2026-03-01 11:00"},
+		{"5/20 * * * *", "2026-03-01 10:26", "2026-03-01 10:45"},
+		{"0 9-17/4 * * *", "2026-03-01 13:30", "2026-03-01 17:00"},
+		{"0 9-17/4 * * *", "2026-03-01 17:30", "2026-03-02 09:00"},
+		{"30 2 * * 1-5", "2026-03-06 03:00", "2026-03-09 02:30"}, // Friday → Monday
+		{"0 0 * * 7", "2026-03-01 00:00", "2026-03-08 00:00"},    // 7 is Sunday
+		{"0 12 1,15 * *", "2026-03-02 00:00", "2026-03-15 12:00"},
+		// Month and year rollover
+		{"0 0 1 * *", "2026-01-31 23:59", "2026-02-01 00:00"},
+		{"59 23 31 * *", "2026-04-01 00:00", "2026-05-31 23:59"},
+		{"0 0 1 1 *", "2026-12-31 23:59", "2027-01-01 00:00"},
+		{"0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+		// Both day fields restricted: either may match
+		{"0 0 13 * 5", "2026-03-01 00:00", "2026-03-06 00:00"},
+		// Never matches: gives up after five years
+		{"0 0 30 2 *", "2026-03-01 00:00", "2031-03-01 00:01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec+" from "+tt.from, func(t *testing.T) {
+			c, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+				t.Errorf("Next = %s, want %s", got.Format("2006-01-02 15:04"), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"1,,2 * * * *",
+		"@yearly",
+	} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("parseCron(%q) succeeded", spec)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Job statuses stored in jobs.status
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+// Job is a claimed row from the jobs table.
+type Job struct {
+	ID          int64
+	Type        string
+	Payload     json.RawMessage
+	Attempts    int // including the current one
+	MaxAttempts int
+}
+
+// Decode unmarshals the job payload into v.
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler processes one job. Returning an error schedules a retry (or
+// dead-letters the job once MaxAttempts is reached).
+type Handler func(ctx context.Context, job *Job) error
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job is dead-lettered without further retries.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type registration struct {
+	handler Handler
+	timeout time.Duration
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]registration{}
+)
+
+// DefaultTimeout bounds a single job attempt unless registered otherwise.
+const DefaultTimeout = 5 * time.Minute
+
+// Register installs the handler for jobType. timeout 0 means DefaultTimeout.
+func Register(jobType string, timeout time.Duration, h Handler) {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[jobType] = registration{handler: h, timeout: timeout}
+}
+
+// RegisterTyped installs a handler whose payload is decoded into T first.
+// A payload that does not decode is a permanent failure.
+func RegisterTyped[T any](jobType string, timeout time.Duration, fn func(ctx context.Context, payload T) error) {
+	Register(jobType, timeout, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := job.Decode(&payload); err != nil {
+			return Permanent(fmt.Errorf("decode %s payload: %w", jobType, err))
+		}
+		return fn(ctx, payload)
+	})
+}
+
+func lookup(jobType string) (registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[jobType]
+	return r, ok
+}
+
+// Querier is satisfied by *pgxpool.Pool, *pgx.Conn and pgx.Tx, so jobs can
+// be enqueued inside the transaction of the work that produces them.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Options tune a single Enqueue.
+type Options struct {
+	// Delay postpones the first attempt.
+	Delay time.Duration
+	// MaxAttempts before dead-lettering (default 5).
+	MaxAttempts int
+	// UniqueKey, when set, skips the enqueue if a queued or running job
+	// with the same key exists.
+	UniqueKey string
+}
+
+// Enqueue adds a job. It returns 0 without error when UniqueKey suppressed
+// a duplicate.
+func Enqueue(ctx context.Context, q Querier, jobType string, payload interface{}, opts Options) (int64, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("encode %s payload: %w", jobType, err)
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+
+	var id int64
+	err = q.QueryRow(ctx, `
+		INSERT INTO jobs (type, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, NOW() + make_interval(secs => $4), NULLIF($5, ''))
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`, jobType, body, opts.MaxAttempts, opts.Delay.Seconds(), opts.UniqueKey).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("enqueue %s: %w", jobType, err)
+	}
+	return id, nil
+}
+
+// backoff returns the delay before retry number `attempt` (1-based):
+// 10s, 20s, 40s, ... capped at one hour.
+func backoff(attempt int) time.Duration {
+	d := 10 * time.Second
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
@@ -0,0 +1,347 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"server/db"
+	"server/logging"
+	"server/metrics"
+	"server/tracing"
+)
+
+// schedule is a cron job registered with Schedule.
+type schedule struct {
+	name    string
+	spec    *cronSpec
+	rawSpec string
+	jobType string
+	payload json.RawMessage
+}
+
+var (
+	schedulesMu sync.Mutex
+	schedules   []schedule
+)
+
+// Schedule registers a recurring job. Every worker syncs the schedule to
+// job_schedules on start; each occurrence is enqueued by exactly one of them.
+func Schedule(name, spec, jobType string, payload interface{}) error {
+	parsed, err := parseCron(spec)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode schedule %s payload: %w", name, err)
+	}
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	schedules = append(schedules, schedule{name: name, spec: parsed, rawSpec: spec, jobType: jobType, payload: body})
+	return nil
+}
+
+// Worker claims and runs jobs until its context is cancelled.
+type Worker struct {
+	ID           string
+	Concurrency  int
+	PollInterval time.Duration
+	// Lease is how long a running job may go without finishing before it is
+	// assumed lost (crashed worker) and requeued.
+	Lease time.Duration
+}
+
+// NewWorker returns a worker with defaults suitable for a single process.
+func NewWorker() *Worker {
+	host, _ := os.Hostname()
+	return &Worker{
+		ID:           fmt.Sprintf("%s-%d", host, os.Getpid()),
+		Concurrency:  4,
+		PollInterval: 2 * time.Second,
+		Lease:        30 * time.Minute,
+	}
+}
+
+// Run processes jobs until ctx is cancelled, then waits for in-flight jobs.
+func (w *Worker) Run(ctx context.Context) error {
+	if err := w.syncSchedules(ctx); err != nil {
+		return err
+	}
+	slog.Info("worker started", "worker", w.ID, "concurrency", w.Concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.maintain(ctx)
+	}()
+
+	wg.Wait()
+	slog.Info("worker stopped", "worker", w.ID)
+	return nil
+}
+
+// loop claims one job at a time, sleeping only when the queue is empty.
+func (w *Worker) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := w.claim(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("job claim failed", "worker", w.ID, "error", err)
+			}
+			sleep(ctx, w.PollInterval)
+			continue
+		}
+		if job == nil {
+			sleep(ctx, w.PollInterval)
+			continue
+		}
+		w.run(job)
+	}
+}
+
+func (w *Worker) claim(ctx context.Context) (*Job, error) {
+	var j Job
+	err := db.DB.QueryRow(ctx, `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1,
+		    locked_by = $1, locked_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'queued' AND run_at <= NOW()
+			ORDER BY run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, type, payload, attempts, max_attempts
+	`, w.ID).Scan(&j.ID, &j.Type, &j.Payload, &j.Attempts, &j.MaxAttempts)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// run executes a claimed job and records the outcome. It deliberately uses
+// a fresh context so a shutdown lets in-flight jobs finish and report.
+func (w *Worker) run(job *Job) {
+	reg, ok := lookup(job.Type)
+	if !ok {
+		w.finish(job, Permanent(fmt.Errorf("no handler registered for %q", job.Type)))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reg.timeout)
+	defer cancel()
+
+	ctx = logging.WithAttrs(ctx, "job_id", job.ID, "job_type", job.Type, "attempt", job.Attempts)
+
+	// Each run is the root of its own trace.
+	ctx, span := tracing.Tracer.Start(ctx, "job "+job.Type, trace.WithAttributes(
+		attribute.Int64("job.id", job.ID),
+		attribute.String("job.type", job.Type),
+		attribute.Int("job.attempt", job.Attempts),
+	))
+	start := time.Now()
+	err := safeCall(ctx, reg.handler, job)
+	took := time.Since(start)
+	tracing.End(span, err)
+	if err == nil {
+		slog.InfoContext(ctx, "job done", "duration_ms", took.Milliseconds())
+	}
+	metrics.ObserveJob(job.Type, w.finish(job, err), took)
+}
+
+// safeCall turns a handler panic into an error so one bad job cannot take
+// the worker down.
+func safeCall(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
+
+// finish saves a job's outcome and returns it: succeeded, retried or dead.
+// Each update only applies while this worker still holds the job's lease
+// for this attempt. If the reaper requeued it in the meantime, possibly for
+// another worker, nothing is written and the outcome is lease_lost.
+func (w *Worker) finish(job *Job, jobErr error) (outcome string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const leaseHeld = ` AND status = 'running' AND locked_by = $2 AND attempts = $3`
+	var tag pgconn.CommandTag
+	var err error
+	var perm permanentError
+	switch {
+	case jobErr == nil:
+		outcome = StatusSucceeded
+		tag, err = db.DB.Exec(ctx, `
+			UPDATE jobs
+			SET status = 'succeeded', finished_at = NOW(), updated_at = NOW(),
+			    locked_by = NULL, locked_at = NULL, last_error = NULL
+			WHERE id = $1`+leaseHeld, job.ID, w.ID, job.Attempts)
+
+	case errors.As(jobErr, &perm) || job.Attempts >= job.MaxAttempts:
+		outcome = StatusDead
+		slog.Error("job dead-lettered", "job_id", job.ID, "job_type", job.Type, "attempts", job.Attempts, "error", jobErr)
+		tag, err = db.DB.Exec(ctx, `
+			UPDATE jobs
+			SET status = 'dead', finished_at = NOW(), updated_at = NOW(),
+			    locked_by = NULL, locked_at = NULL, last_error = $4
+			WHERE id = $1`+leaseHeld, job.ID, w.ID, job.Attempts, jobErr.Error())
+
+	default:
+		outcome = "retried"
+		delay := backoff(job.Attempts)
+		delay += time.Duration(rand.Int63n(int64(delay)/5 + 1)) // up to 20% jitter
+		slog.Warn("job failed, retrying", "job_id", job.ID, "job_type", job.Type,
+			"attempt", job.Attempts, "max_attempts", job.MaxAttempts, "retry_in", delay.Round(time.Second).String(), "error", jobErr)
+		tag, err = db.DB.Exec(ctx, `
+			UPDATE jobs
+			SET status = 'queued', run_at = NOW() + make_interval(secs => $4), updated_at = NOW(),
+			    locked_by = NULL, locked_at = NULL, last_error = $5
+			WHERE id = $1`+leaseHeld, job.ID, w.ID, job.Attempts, delay.Seconds(), jobErr.Error())
+	}
+	if err != nil {
+		slog.Error("job outcome not saved", "job_id", job.ID, "error", err)
+		return outcome
+	}
+	if tag.RowsAffected() == 0 {
+		slog.Warn("job lease lost, outcome discarded", "job_id", job.ID, "job_type", job.Type,
+			"attempt", job.Attempts, "outcome", outcome)
+		return "lease_lost"
+	}
+	return outcome
+}
+
+// maintain fires due cron schedules and requeues jobs whose worker vanished.
+func (w *Worker) maintain(ctx context.Context) {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		w.fireSchedules(ctx)
+		w.reapExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) reapExpired(ctx context.Context) {
+	tag, err := db.DB.Exec(ctx, `
+		UPDATE jobs
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'queued' END,
+		    finished_at = CASE WHEN attempts >= max_attempts THEN NOW() END,
+		    last_error = 'lease expired (worker lost)',
+		    locked_by = NULL, locked_at = NULL, updated_at = NOW()
+		WHERE status = 'running' AND locked_at < NOW() - make_interval(secs => $1)
+	`, w.Lease.Seconds())
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("job reaper failed", "error", err)
+		}
+		return
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		slog.Warn("requeued jobs with expired leases", "count", n)
+	}
+}
+
+// syncSchedules upserts registered schedules, keeping next_run_at unless
+// the spec changed.
+func (w *Worker) syncSchedules(ctx context.Context) error {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	now := time.Now().UTC()
+	for _, s := range schedules {
+		_, err := db.DB.Exec(ctx, `
+			INSERT INTO job_schedules (name, spec, job_type, payload, next_run_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (name) DO UPDATE SET
+				job_type = EXCLUDED.job_type,
+				payload = EXCLUDED.payload,
+				next_run_at = CASE WHEN job_schedules.spec = EXCLUDED.spec
+				                   THEN job_schedules.next_run_at ELSE EXCLUDED.next_run_at END,
+				spec = EXCLUDED.spec
+		`, s.name, s.rawSpec, s.jobType, s.payload, s.spec.Next(now))
+		if err != nil {
+			return fmt.Errorf("sync schedule %s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// fireSchedules enqueues every due schedule. Advancing next_run_at in the
+// same transaction as the enqueue makes each occurrence fire exactly once
+// across workers. Missed occurrences (no worker running) collapse into one.
+func (w *Worker) fireSchedules(ctx context.Context) {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	now := time.Now().UTC()
+	for _, s := range schedules {
+		if err := fireSchedule(ctx, s, now); err != nil && ctx.Err() == nil {
+			slog.Error("schedule failed", "schedule", s.name, "error", err)
+		}
+	}
+}
+
+func fireSchedule(ctx context.Context, s schedule, now time.Time) error {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE job_schedules
+		SET next_run_at = $3, last_run_at = $2
+		WHERE name = $1 AND next_run_at <= $2
+	`, s.name, now, s.spec.Next(now))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	if _, err := Enqueue(ctx, tx, s.jobType, s.payload, Options{UniqueKey: "schedule:" + s.name}); err != nil {
+		return err
+	}
+	slog.Info("schedule fired", "schedule", s.name, "job_type", s.jobType)
+	return tx.Commit(ctx)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
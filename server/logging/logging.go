@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+	"server/config"
+)
+
+//
+// 🔹 Setup: make slog the process-wide logger
+//
+// LOG_LEVEL is debug, info (default), warn or error. LOG_FORMAT is json
+// (default) or text for local reading. LOG_REDACT=false keeps emails and
+// storage keys in clear, for local debugging only. The standard library
+// logger is routed through the same handler.
+//
+func Setup(c config.Log) error {
+	level := slog.LevelInfo
+	if c.Level != "" {
+		if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+			return fmt.Errorf("invalid LOG_LEVEL %q: %w", c.Level, err)
+		}
+	}
+
+	h, err := newHandler(os.Stdout, c.Format, level, c.Redact)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+func newHandler(w io.Writer, format string, level slog.Leveler, redact bool) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	if redact {
+		opts.ReplaceAttr = redactAttr
+	}
+	switch strings.ToLower(format) {
+	case "", "json":
+		return contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	case "text":
+		return contextHandler{slog.NewTextHandler(w, opts)}, nil
+	}
+	return nil, fmt.Errorf("invalid LOG_FORMAT %q (want json or text)", format)
+}
+
+//
+// 🔹 Request and job context carried into every log line
+//
+type requestInfo struct {
+	id     string
+	userID atomic.Int64
+}
+
+type requestKey struct{}
+type attrsKey struct{}
+
+// WithRequestID starts request-scoped logging: every line logged with the
+// returned context (or one derived from it) carries request_id, and
+// user_id once SetUserID is called.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestKey{}, &requestInfo{id: id})
+}
+
+// RequestID returns the current request's ID, or "".
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// SetUserID records who the request is for once a handler has resolved
+// it. Lines logged from then on, including the access log, carry user_id.
+func SetUserID(ctx context.Context, userID int) {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		info.userID.Store(int64(userID))
+	}
+}
+
+// WithAttrs returns a context whose log lines carry args (key-value pairs
+// as for slog.Info), e.g. a job's ID and type.
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+	prev, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	attrs := append(append([]slog.Attr{}, prev...), argsToAttrs(args)...)
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+func argsToAttrs(args []any) []slog.Attr {
+	var r slog.Record
+	r.Add(args...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+// contextHandler adds the context's request, job and trace IDs to records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		r.AddAttrs(slog.String("request_id", info.id))
+		if uid := info.userID.Load(); uid != 0 {
+			r.AddAttrs(slog.Int64("user_id", uid))
+		}
+	}
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
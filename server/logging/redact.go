@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// secretKeys are attribute names whose values are never logged.
+var secretKeys = map[string]bool{
+	"secret":        true,
+	"password":      true,
+	"token":         true,
+	"authorization": true,
+	"api_key":       true,
+	"access_key":    true,
+	"secret_key":    true,
+	"dsn":           true,
+}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// redactAttr masks emails wherever they appear (attribute values, error
+// text and the message), shortens storage keys ("key" and "*_key"
+// attributes), which act as download capabilities, and drops secrets.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	k := strings.ToLower(a.Key)
+	if secretKeys[k] {
+		return slog.String(a.Key, "[REDACTED]")
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if k == "key" || strings.HasSuffix(k, "_key") {
+			return slog.String(a.Key, maskStorageKey(a.Value.String()))
+		}
+		return slog.String(a.Key, maskEmails(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok && err != nil {
+			return slog.String(a.Key, maskEmails(err.Error()))
+		}
+	}
+	return a
+}
+
+// maskEmails keeps the first character and the domain of each address:
+// jane.doe@example.com → j***@example.com.
+func maskEmails(s string) string {
+	if !strings.Contains(s, "@") {
+		return s
+	}
+	return emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+		at := strings.LastIndexByte(email, '@')
+		return email[:1] + "***" + email[at:]
+	})
+}
+
+// maskStorageKey keeps the key's prefix and the start of its name, enough
+// to tell objects apart in logs: blobs/3f2a9c1b….
+func maskStorageKey(key string) string {
+	dir, name := "", key
+	if i := strings.LastIndexByte(key, '/'); i >= 0 {
+		dir, name = key[:i+1], key[i+1:]
+	}
+	if len(name) <= 8 {
+		return dir + name
+	}
+	return dir + name[:8] + "…"
+}
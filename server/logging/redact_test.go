@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func logLine(t *testing.T, redact bool, log func(*slog.Logger)) string {
+	t.Helper()
+	var buf bytes.Buffer
+	h, err := newHandler(&buf, "json", slog.LevelDebug, redact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log(slog.New(h))
+	return buf.String()
+}
+
+func TestRedaction(t *testing.T) {
+	tests := []struct {
+		name    string
+		log     func(*slog.Logger)
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "secret keys",
+			log:     func(l *slog.Logger) { l.Info("login", "password", "hunter2", "Authorization", "Bearer abc", "api_key", "k-123") },
+			want:    []string{`"password":"[REDACTED]"`, `"Authorization":"[REDACTED]"`, `"api_key":"[REDACTED]"`},
+			notWant: []string{"hunter2", "Bearer abc", "k-123"},
+		},
+		{
+			name:    "email attribute",
+			log:     func(l *slog.Logger) { l.Info("upload", "user", "jane.doe@example.com") },
+			want:    []string{`"user":"j***@example.com"`},
+			notWant: []string{"jane.doe"},
+		},
+		{
+			name:    "email inside message",
+			log:     func(l *slog.Logger) { l.Info("no such user jane.doe@example.com or bob@test.io") },
+			want:    []string{"no such user j***@example.com or b***@test.io"},
+			notWant: []string{"jane.doe", "bob@"},
+		},
+		{
+			name:    "email inside error",
+			log:     func(l *slog.Logger) { l.Error("lookup", "error", errors.New("user jane.doe@example.com: not found")) },
+			want:    []string{`"error":"user j***@example.com: not found"`},
+			notWant: []string{"jane.doe"},
+		},
+		{
+			name:    "storage keys",
+			log:     func(l *slog.Logger) { l.Info("download", "key", "blobs/3f2a9c1b77e0aa-uuid", "s3_key", "short") },
+			want:    []string{`"key":"blobs/3f2a9c1b…"`, `"s3_key":"short"`},
+			notWant: []string{"77e0aa"},
+		},
+		{
+			name: "nested groups",
+			log: func(l *slog.Logger) {
+				l.WithGroup("req").Info("call", slog.Group("auth", "token", "t-1", "email", "jane.doe@example.com"))
+			},
+			want:    []string{`"req":{"auth":{"token":"[REDACTED]","email":"j***@example.com"}}`},
+			notWant: []string{"t-1", "jane.doe"},
+		},
+		{
+			name:    "context attrs",
+			log:     func(l *slog.Logger) { l.InfoContext(WithAttrs(context.Background(), "user", "jane.doe@example.com"), "job") },
+			want:    []string{`"user":"j***@example.com"`},
+			notWant: []string{"jane.doe"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := logLine(t, true, tt.log)
+			for _, s := range tt.want {
+				if !strings.Contains(line, s) {
+					t.Errorf("missing %s in %s", s, line)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(line, s) {
+					t.Errorf("leaked %q in %s", s, line)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactionDisabled(t *testing.T) {
+	line := logLine(t, false, func(l *slog.Logger) { l.Info("upload jane.doe@example.com", "password", "hunter2") })
+	if !strings.Contains(line, "jane.doe@example.com") || !strings.Contains(line, "hunter2") {
+		t.Errorf("LOG_REDACT=false still redacted: %s", line)
+	}
+}
@@ -1,57 +1,258 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"server/apiversion"
+	"server/config"
 	"server/db"
 	"server/handlers"
+	"server/jobs"
+	"server/logging"
+	"server/metrics"
+	"server/scanner"
+	"server/store"
+	"server/tracing"
 	"server/utils"
 
 	ghandlers "github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 
-	"github.com/awslabs/aws-lambda-go-api-proxy/httpadapter"
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/awslabs/aws-lambda-go-api-proxy/httpadapter"
 )
 
 func main() {
 	// Load env vars
-	if err := godotenv.Load(); err != nil {
-		log.Println("⚠️ No .env file found")
+	envErr := godotenv.Load()
+
+	// ⚙️ Configuration: defaults < config file < env < flags
+	command, args := splitCommand(os.Args[1:])
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("❌ Failed to load config: ", err)
 	}
+	if len(command) > 0 {
+		if command[0] == "config" {
+			os.Exit(configCommand(command[1:], cfg))
+		}
+		if command[0] == "openapi" {
+			config.Set(cfg) // the document depends on LEGACY_ROUTES
+			os.Exit(openapiCommand())
+		}
+		cfg.Server.Mode = command[0]
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("❌ Invalid config:\n", err)
+	}
+	config.Set(cfg)
+
+	// 🪵 Structured logging
+	if err := logging.Setup(cfg.Log); err != nil {
+		log.Fatal("❌ Failed to configure logging: ", err)
+	}
+	if envErr != nil {
+		slog.Warn("no .env file found")
+	}
+
+	// 🔭 Tracing (before anything that opens spans)
+	service := "skyvault-api"
+	if cfg.Server.Mode == "worker" {
+		service = "skyvault-worker"
+	}
+	if err := tracing.Init(context.Background(), service); err != nil {
+		fatal("failed to initialize tracing", err)
+	}
+	defer tracing.Shutdown(context.Background())
 
 	// ✅ Connect to Postgres
-	if err := db.Connect(); err != nil {
-		log.Fatal("❌ Failed to connect to DB:", err)
+	if err := db.Connect(cfg.Database); err != nil {
+		fatal("failed to connect to DB", err)
 	}
 	defer db.Close()
 
+	// ✅ Apply schema migrations
+	if err := db.Migrate(context.Background()); err != nil {
+		fatal("failed to migrate DB", err)
+	}
+
 	// ✅ Initialize AWS S3
-	utils.InitAWS()
+	utils.InitAWS(cfg.Storage)
 
-	// Setup router
-	r := mux.NewRouter()
+	// ✅ Initialize malware scanner
+	if err := scanner.Init(cfg.Scanner); err != nil {
+		fatal("failed to initialize scanner", err)
+	}
+
+	// ✅ File handlers, backed by Postgres and S3
+	h := handlers.New(store.NewPostgres(db.DB, db.Reader(), handlers.WriteEvent), store.S3{})
+
+	// ✅ Register background job handlers
+	if err := h.RegisterJobs(); err != nil {
+		fatal("failed to register jobs", err)
+	}
 
-	// File routes
-	r.HandleFunc("/upload", handlers.UploadFile).Methods("POST")
-	r.HandleFunc("/files", handlers.ListUserFiles).Methods("GET")
-	r.HandleFunc("/download", handlers.DownloadFile).Methods("GET")
-	r.HandleFunc("/delete", handlers.DeleteFile).Methods("DELETE")
+	// 👷 Worker mode: same binary, processes the job queue instead of HTTP
+	if cfg.Server.Mode == "worker" {
+		runWorker(cfg)
+		return
+	}
+
+	// Setup router
+	r := newRouter(h, cfg)
 
-	// ✅ Admin analytics routes
-	r.HandleFunc("/admin/system-stats", handlers.GetSystemStats).Methods("GET")
-	r.HandleFunc("/admin/user-stats", handlers.GetUserStats).Methods("GET")
-	r.HandleFunc("/admin/file-details", handlers.GetUserFileDetails).Methods("GET")
+	// 📄 Every route must be in the OpenAPI document, and vice versa
+	apiDoc := handlers.APIDocument()
+	if err := apiDoc.Check(r); err != nil {
+		slog.Warn("router and OpenAPI document differ", "error", err)
+	}
+	if cfg.Server.OpenAPIValidate {
+		r.Use(apiDoc.ValidateResponses)
+	}
 
 	// CORS setup
 	cors := ghandlers.CORS(
 		ghandlers.AllowedOrigins([]string{"*"}),
-		ghandlers.AllowedMethods([]string{"GET", "POST", "DELETE", "OPTIONS"}),
+		ghandlers.AllowedMethods([]string{"GET", "HEAD", "POST", "DELETE", "OPTIONS"}),
 		ghandlers.AllowedHeaders([]string{"*"}),
+		ghandlers.ExposedHeaders([]string{"Content-Range", "Content-Disposition", "ETag", "Last-Modified", "Accept-Ranges", logging.RequestIDHeader,
+			apiversion.Header, "Deprecation", "Sunset", "Link"}),
 	)
 
+	handler := tracing.Handler(cors(r))
+
+	// 🌐 HTTP mode: a plain server (containers, local development)
+	if cfg.Server.Mode == "http" {
+		runHTTP(handler, cfg.Server.Port)
+		return
+	}
+
 	// ✅ Wrap router in Lambda adapter (instead of ListenAndServe)
-	adapter := httpadapter.New(cors(r))
-	lambda.Start(adapter.ProxyWithContext)
+	adapter := httpadapter.New(handler)
+	pusher := metrics.NewPusher(cfg.Metrics)
+	var options []lambda.Option
+	if pusher != nil {
+		options = append(options, lambda.WithEnableSIGTERM(pusher.Delete))
+	}
+	lambda.StartWithOptions(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		resp, err := adapter.ProxyWithContext(ctx, req)
+		// Lambda freezes the process once we return: export spans and
+		// metrics now
+		tracing.Flush(ctx)
+		if pusher != nil {
+			pusher.Push()
+		}
+		return resp, err
+	}, options...)
+}
+
+// splitCommand separates the leading words (`worker`, `http`, `config
+// check`) from the flags that follow them. A mode given as a command wins
+// over RUN_MODE; without one the server runs as a Lambda handler.
+func splitCommand(args []string) (command, rest []string) {
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = append(command, args[0])
+		args = args[1:]
+	}
+	return command, args
+}
+
+// configCommand runs `server config check`: it prints the effective
+// configuration with secrets masked and reports every validation problem.
+// It returns the process exit code.
+func configCommand(args []string, cfg *config.Config) int {
+	if len(args) != 1 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: server config check [-config file] [flags]")
+		return 2
+	}
+	fmt.Print(cfg.Redacted())
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "\n❌ invalid configuration:\n%v\n", err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "\n✅ configuration is valid")
+	return 0
+}
+
+// openapiCommand runs `server openapi`: it prints the API description, for
+// client generators, without connecting to anything.
+func openapiCommand() int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(handlers.APIDocument()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runWorker processes jobs until SIGINT/SIGTERM, letting running jobs finish.
+func runWorker(cfg *config.Config) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := jobs.NewWorker()
+	w.Concurrency = cfg.Jobs.WorkerConcurrency
+	// The worker has no HTTP API, so metrics and probes get their own
+	// listener.
+	if addr := cfg.Metrics.Addr; addr != "" {
+		srv := http.NewServeMux()
+		srv.Handle("/metrics", metrics.Handler())
+		srv.HandleFunc("/healthz", handlers.Healthz)
+		srv.HandleFunc("/readyz", handlers.Readyz)
+		go func() {
+			slog.Info("serving metrics", "addr", addr)
+			if err := http.ListenAndServe(addr, srv); err != nil {
+				slog.Error("metrics listener failed", "error", err)
+			}
+		}()
+	}
+	if err := w.Run(ctx); err != nil {
+		fatal("worker failed", err)
+	}
+}
+
+// runHTTP serves the API on port until SIGINT/SIGTERM, then drains in-flight
+// requests for up to 30s.
+func runHTTP(handler http.Handler, port int) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: ":" + strconv.Itoa(port), Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("http shutdown failed", "error", err)
+		}
+	}()
+
+	slog.Info("serving http", "addr", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fatal("http server failed", err)
+	}
+}
+
+// fatal logs a startup failure and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
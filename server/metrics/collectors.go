@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"server/db"
+)
+
+func counterValue(c prometheus.Counter) float64 {
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
+
+func desc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+}
+
+//
+// 🔹 pgx pool statistics, read from each pool's Stat() at scrape time
+//
+// pool is "primary" or, with DB_REPLICA_URL set, "replica".
+//
+var (
+	poolAcquired        = desc("db_pool_acquired_conns", "Connections currently checked out of the pool.", "pool")
+	poolIdle            = desc("db_pool_idle_conns", "Idle connections in the pool.", "pool")
+	poolConstructing    = desc("db_pool_constructing_conns", "Connections being opened.", "pool")
+	poolTotal           = desc("db_pool_total_conns", "All connections in the pool.", "pool")
+	poolMax             = desc("db_pool_max_conns", "Configured pool size.", "pool")
+	poolAcquires        = desc("db_pool_acquires_total", "Successful connection acquires.", "pool")
+	poolAcquireSeconds  = desc("db_pool_acquire_duration_seconds_total", "Time spent waiting for a connection.", "pool")
+	poolEmptyAcquires   = desc("db_pool_empty_acquires_total", "Acquires that had to wait because no connection was idle.", "pool")
+	poolCanceled        = desc("db_pool_canceled_acquires_total", "Acquires abandoned because their context ended.", "pool")
+	poolNewConns        = desc("db_pool_new_conns_total", "Connections opened.", "pool")
+	poolLifetimeDestroy = desc("db_pool_max_lifetime_destroys_total", "Connections closed for reaching their maximum lifetime.", "pool")
+	poolIdleDestroy     = desc("db_pool_max_idle_destroys_total", "Connections closed for idling too long.", "pool")
+)
+
+type poolCollector struct{}
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		poolAcquired, poolIdle, poolConstructing, poolTotal, poolMax,
+		poolAcquires, poolAcquireSeconds, poolEmptyAcquires, poolCanceled,
+		poolNewConns, poolLifetimeDestroy, poolIdleDestroy,
+	} {
+		ch <- d
+	}
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	collectPool(ch, "primary", db.DB)
+	collectPool(ch, "replica", db.Replica)
+}
+
+func collectPool(ch chan<- prometheus.Metric, name string, pool *pgxpool.Pool) {
+	if pool == nil {
+		return
+	}
+	s := pool.Stat()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, name)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, name)
+	}
+	gauge(poolAcquired, float64(s.AcquiredConns()))
+	gauge(poolIdle, float64(s.IdleConns()))
+	gauge(poolConstructing, float64(s.ConstructingConns()))
+	gauge(poolTotal, float64(s.TotalConns()))
+	gauge(poolMax, float64(s.MaxConns()))
+	counter(poolAcquires, float64(s.AcquireCount()))
+	counter(poolAcquireSeconds, s.AcquireDuration().Seconds())
+	counter(poolEmptyAcquires, float64(s.EmptyAcquireCount()))
+	counter(poolCanceled, float64(s.CanceledAcquireCount()))
+	counter(poolNewConns, float64(s.NewConnsCount()))
+	counter(poolLifetimeDestroy, float64(s.MaxLifetimeDestroyCount()))
+	counter(poolIdleDestroy, float64(s.MaxIdleDestroyCount()))
+}
+
+//
+// 🔹 Job queue depth, queried from the jobs table at scrape time
+//
+var (
+	queueDepth  = desc("job_queue_depth", "Jobs waiting or running, by type and status.", "type", "status")
+	queueOldest = desc("job_queue_oldest_seconds", "Age of the oldest queued job that is due to run.")
+	queueDead   = desc("job_dead_letters", "Jobs in the dead-letter set, by type.", "type")
+)
+
+type queueCollector struct{}
+
+func (queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepth
+	ch <- queueOldest
+	ch <- queueDead
+}
+
+func (queueCollector) Collect(ch chan<- prometheus.Metric) {
+	if db.DB == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := db.DB.Query(ctx, `
+		SELECT type, status, COUNT(*) FROM jobs
+		WHERE status IN ('queued', 'running', 'dead')
+		GROUP BY type, status
+	`)
+	if err != nil {
+		slog.WarnContext(ctx, "job queue metrics failed", "error", err)
+		return
+	}
+	for rows.Next() {
+		var jobType, status string
+		var n int64
+		if err := rows.Scan(&jobType, &status, &n); err != nil {
+			rows.Close()
+			slog.WarnContext(ctx, "job queue metrics failed", "error", err)
+			return
+		}
+		if status == "dead" {
+			ch <- prometheus.MustNewConstMetric(queueDead, prometheus.GaugeValue, float64(n), jobType)
+		} else {
+			ch <- prometheus.MustNewConstMetric(queueDepth, prometheus.GaugeValue, float64(n), jobType, status)
+		}
+	}
+	rows.Close()
+
+	var oldest float64
+	err = db.DB.QueryRow(ctx, `
+		SELECT COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(run_at)), 0)::float8
+		FROM jobs WHERE status = 'queued' AND run_at <= NOW()
+	`).Scan(&oldest)
+	if err != nil {
+		slog.WarnContext(ctx, "job queue metrics failed", "error", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(queueOldest, prometheus.GaugeValue, oldest)
+}
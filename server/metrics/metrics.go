@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "skyvault"
+
+// Registry holds every SkyVault metric. It is served at /metrics and is
+// what Push sends to the Pushgateway.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// UploadBytes counts bytes accepted by /upload, duplicates included.
+	UploadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes received in successful uploads.",
+	})
+
+	// DownloadBytes counts file bytes sent by /download.
+	DownloadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_bytes_total",
+		Help:      "File bytes sent to clients by downloads.",
+	})
+
+	// Uploads counts successful uploads by whether the content was already
+	// stored (dedup="hit") or had to be written (dedup="miss").
+	Uploads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_total",
+		Help:      "Successful uploads by deduplication outcome (hit or miss).",
+	}, []string{"dedup"})
+
+	s3Duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "s3_operation_duration_seconds",
+		Help:      "S3 call latency by operation.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation"})
+
+	s3Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "s3_operation_errors_total",
+		Help:      "Failed S3 calls by operation.",
+	}, []string{"operation"})
+
+	jobsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_processed_total",
+		Help:      "Background job runs by type and outcome (succeeded, retried, dead, lease_lost).",
+	}, []string{"type", "outcome"})
+
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Background job run time by type.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900},
+	}, []string{"type"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		UploadBytes, DownloadBytes, Uploads,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dedup_hit_ratio",
+			Help:      "Share of uploads since start that were already stored. Use uploads_total for fleet-wide ratios.",
+		}, dedupHitRatio),
+		s3Duration, s3Errors,
+		jobsProcessed, jobDuration,
+		poolCollector{},
+		queueCollector{},
+	)
+	// Pre-create both series so the ratio is defined from the first scrape.
+	Uploads.WithLabelValues("hit")
+	Uploads.WithLabelValues("miss")
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+//
+// 🔹 Middleware: count and time every request by its mux route template
+//
+// Labelling by template (/files/{id}/thumbnail) rather than path keeps the
+// number of series bounded.
+//
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		m := httpsnoop.CaptureMetrics(next, w, r)
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(m.Code)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(m.Duration.Seconds())
+	})
+}
+
+// ObserveS3 records one S3 call. Use as
+// defer metrics.ObserveS3("GetObject", time.Now(), &err).
+func ObserveS3(operation string, start time.Time, err *error) {
+	s3Duration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil && *err != nil {
+		s3Errors.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveJob records the outcome of one job run.
+func ObserveJob(jobType, outcome string, took time.Duration) {
+	jobsProcessed.WithLabelValues(jobType, outcome).Inc()
+	jobDuration.WithLabelValues(jobType).Observe(took.Seconds())
+}
+
+func dedupHitRatio() float64 {
+	hits := counterValue(Uploads.WithLabelValues("hit"))
+	total := hits + counterValue(Uploads.WithLabelValues("miss"))
+	if total == 0 {
+		return 0
+	}
+	return hits / total
+}
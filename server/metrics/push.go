@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+	"server/config"
+)
+
+// Pusher sends the registry to a Prometheus Pushgateway. Under the Lambda
+// adapter nothing can scrape /metrics between invocations, so the handler
+// pushes at the end of every invocation instead.
+//
+// Each execution environment owns one group, keyed by function and
+// instance, and deletes it on shutdown: counters are per process, so groups
+// must not be shared, and a group left behind would keep reporting the
+// last values of an environment that no longer exists.
+type Pusher struct {
+	pusher *push.Pusher
+}
+
+// NewPusher returns a Pusher for c.PushgatewayURL, or nil when it is not
+// set.
+func NewPusher(c config.Metrics) *Pusher {
+	if c.PushgatewayURL == "" {
+		return nil
+	}
+	function := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	instance := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME")
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+
+	slog.Info("metrics push enabled", "function", function, "instance", instance)
+	return &Pusher{
+		pusher: push.New(c.PushgatewayURL, namespace).
+			Gatherer(Registry).
+			Grouping("function", function).
+			Grouping("instance", instance).
+			Client(&http.Client{Timeout: 2 * time.Second}),
+	}
+}
+
+// Push sends the current values. It runs synchronously because a Lambda
+// environment is frozen once the response is returned.
+func (p *Pusher) Push() {
+	if err := p.pusher.Push(); err != nil {
+		slog.Warn("metrics push failed", "error", err)
+	}
+}
+
+// Delete removes this environment's group from the Pushgateway.
+func (p *Pusher) Delete() {
+	if err := p.pusher.Delete(); err != nil {
+		slog.Warn("metrics group delete failed", "error", err)
+	}
+}
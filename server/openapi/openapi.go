@@ -0,0 +1,251 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// 🔹 OpenAPI 3.1 documents built from Go types
+//
+// Routes are described with Operation values whose bodies are examples of
+// the Go types the handlers actually encode and decode. Schemas are derived
+// from those types by reflection (see schema.go), so a field added to a
+// response struct shows up in the document without touching it.
+//
+
+// Version is the OpenAPI version documents declare.
+const Version = "3.1.0"
+
+// Document is the root of an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// PathItem maps a lower-case HTTP method to its operation.
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	OperationID string                    `json:"operationId"`
+	Summary     string                    `json:"summary"`
+	Description string                    `json:"description,omitempty"`
+	Tags        []string                  `json:"tags,omitempty"`
+	Deprecated  bool                      `json:"deprecated,omitempty"`
+	Parameters  []ParameterObject         `json:"parameters,omitempty"`
+	RequestBody *RequestBodyObject        `json:"requestBody,omitempty"`
+	Responses   map[string]ResponseObject `json:"responses"`
+}
+
+type ParameterObject struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBodyObject struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type ResponseObject struct {
+	Description string                  `json:"description"`
+	Headers     map[string]HeaderObject `json:"headers,omitempty"`
+	Content     map[string]MediaType    `json:"content,omitempty"`
+}
+
+type HeaderObject struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+//
+// 🔹 Describing routes
+//
+
+// Operation describes one route. Body and Response.Body are zero values
+// (or pointers to them) of the Go types exchanged as JSON.
+type Operation struct {
+	Method      string
+	Path        string // mux template without regexps: /files/{id}/thumbnail
+	ID          string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+	Params      []Param
+	Body        interface{} // JSON request body
+	Form        []Param     // multipart/form-data fields, instead of Body
+	Responses   []Response
+}
+
+// Param is a query, path or header parameter, or a form field. Type is a
+// zero value of its Go type; Binary marks a file upload field.
+type Param struct {
+	In          string // query (default), path or header
+	Name        string
+	Description string
+	Required    bool
+	Type        interface{}
+	Enum        []string
+	Binary      bool
+}
+
+// Response is one documented status. ContentType defaults to
+// application/json when Body is set; Binary marks a raw byte stream.
+type Response struct {
+	Status      int
+	Description string
+	Body        interface{}
+	ContentType string
+	Binary      bool
+	Headers     map[string]string // name → description (string values)
+}
+
+// New returns an empty document.
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      map[string]PathItem{},
+		Components: Components{Schemas: map[string]*Schema{}},
+	}
+}
+
+// Add documents op, deriving schemas for its types. It panics on an
+// operation documented twice, which is a programming error.
+func (d *Document) Add(op Operation) {
+	method := strings.ToLower(op.Method)
+	item := d.Paths[op.Path]
+	if item == nil {
+		item = PathItem{}
+		d.Paths[op.Path] = item
+	}
+	if item[method] != nil {
+		panic(fmt.Sprintf("openapi: %s %s documented twice", op.Method, op.Path))
+	}
+
+	o := &OperationObject{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Deprecated:  op.Deprecated,
+		Responses:   map[string]ResponseObject{},
+	}
+	for _, p := range op.Params {
+		in := p.In
+		if in == "" {
+			in = "query"
+		}
+		o.Parameters = append(o.Parameters, ParameterObject{
+			Name:        p.Name,
+			In:          in,
+			Description: p.Description,
+			Required:    p.Required || in == "path",
+			Schema:      d.paramSchema(p),
+		})
+	}
+
+	switch {
+	case op.Body != nil:
+		o.RequestBody = &RequestBodyObject{Required: true, Content: map[string]MediaType{
+			"application/json": {Schema: d.SchemaOf(op.Body)},
+		}}
+	case len(op.Form) > 0:
+		form := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for _, p := range op.Form {
+			s := d.paramSchema(p)
+			s.Description = p.Description
+			form.Properties[p.Name] = s
+			if p.Required {
+				form.Required = append(form.Required, p.Name)
+			}
+		}
+		o.RequestBody = &RequestBodyObject{Required: true, Content: map[string]MediaType{
+			"multipart/form-data": {Schema: form},
+		}}
+	}
+
+	for _, r := range op.Responses {
+		ro := ResponseObject{Description: r.Description}
+		if ro.Description == "" {
+			ro.Description = http.StatusText(r.Status)
+		}
+		switch {
+		case r.Binary:
+			ct := r.ContentType
+			if ct == "" {
+				ct = "application/octet-stream"
+			}
+			ro.Content = map[string]MediaType{ct: {Schema: &Schema{Type: "string", Format: "binary"}}}
+		case r.Body != nil:
+			ct := r.ContentType
+			if ct == "" {
+				ct = "application/json"
+			}
+			ro.Content = map[string]MediaType{ct: {Schema: d.SchemaOf(r.Body)}}
+		}
+		for name, desc := range r.Headers {
+			if ro.Headers == nil {
+				ro.Headers = map[string]HeaderObject{}
+			}
+			ro.Headers[name] = HeaderObject{Description: desc, Schema: &Schema{Type: "string"}}
+		}
+		o.Responses[strconv.Itoa(r.Status)] = ro
+	}
+	item[method] = o
+}
+
+func (d *Document) paramSchema(p Param) *Schema {
+	if p.Binary {
+		return &Schema{Type: "string", Format: "binary"}
+	}
+	t := p.Type
+	if t == nil {
+		t = ""
+	}
+	s := d.SchemaOf(t)
+	for _, e := range p.Enum {
+		s.Enum = append(s.Enum, e)
+	}
+	return s
+}
+
+// Operations lists every documented "METHOD /path", sorted.
+func (d *Document) Operations() []string {
+	var ops []string
+	for path, item := range d.Paths {
+		for method := range item {
+			ops = append(ops, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// Lookup returns the operation documented for method and path.
+func (d *Document) Lookup(method, path string) *OperationObject {
+	return d.Paths[path][strings.ToLower(method)]
+}
@@ -0,0 +1,119 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+)
+
+//
+// 🔹 Keeping the document and the router in step
+//
+
+// muxVar strips the regexp from a mux path variable: {id:[0-9]+} → {id}.
+var muxVar = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// PathTemplate turns a mux path template into an OpenAPI path.
+func PathTemplate(tpl string) string {
+	return muxVar.ReplaceAllString(tpl, "{$1}")
+}
+
+// Check compares the document with the routes registered on r and reports
+// routes nobody documented and documented operations with no route. HEAD
+// is covered by GET.
+func (d *Document) Check(r *mux.Router) error {
+	routed := map[string]bool{}
+	var errs []error
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil // matcher-only routes (subrouter roots)
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path := PathTemplate(tpl)
+		for _, m := range methods {
+			if m == http.MethodHead || m == http.MethodOptions {
+				continue
+			}
+			routed[m+" "+path] = true
+			if d.Lookup(m, path) == nil {
+				errs = append(errs, fmt.Errorf("route %s %s is not documented", m, path))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, op := range d.Operations() {
+		if !routed[op] {
+			errs = append(errs, fmt.Errorf("documented operation %s has no route", op))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// ValidateResponses is router middleware (r.Use) that checks every JSON
+// response against the document and logs each mismatch. It buffers JSON
+// bodies, so it is meant for development and staging, not production.
+func (d *Document) ValidateResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		status := 0
+		var body bytes.Buffer
+		isJSON := false
+		started := func(code int) {
+			if status == 0 {
+				status = code
+				isJSON = strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+			}
+		}
+		wrapped := httpsnoop.Wrap(w, httpsnoop.Hooks{
+			WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+				return func(code int) {
+					started(code)
+					next(code)
+				}
+			},
+			Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+				return func(b []byte) (int, error) {
+					started(http.StatusOK)
+					if isJSON {
+						body.Write(b)
+					}
+					return next(b)
+				}
+			},
+		})
+		next.ServeHTTP(wrapped, r)
+
+		if !isJSON {
+			return
+		}
+		if err := d.ValidateResponse(r.Method, PathTemplate(tpl), status, body.Bytes()); err != nil {
+			slog.WarnContext(r.Context(), "response does not match OpenAPI document", "error", err)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// 🔹 Checking JSON against the document
+//
+
+// ValidateResponse checks a JSON response body against what the document
+// says method path returns with status. Statuses the operation does not
+// document are an error too.
+func (d *Document) ValidateResponse(method, path string, status int, body []byte) error {
+	op := d.Lookup(method, path)
+	if op == nil {
+		return fmt.Errorf("%s %s is not documented", method, path)
+	}
+	res, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return fmt.Errorf("%s %s: status %d is not documented", method, path, status)
+	}
+	media, ok := res.Content["application/json"]
+	if !ok || media.Schema == nil {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("%s %s %d: invalid JSON: %w", method, path, status, err)
+	}
+	if err := d.Validate(media.Schema, v); err != nil {
+		return fmt.Errorf("%s %s %d: %w", method, path, status, err)
+	}
+	return nil
+}
+
+// Validate checks v, a value decoded from JSON (with json.Number for
+// numbers), against s. Every violation found is reported.
+func (d *Document) Validate(s *Schema, v interface{}) error {
+	var errs []error
+	d.validate(s, v, "$", &errs)
+	return errors.Join(errs...)
+}
+
+func (d *Document) validate(s *Schema, v interface{}, at string, errs *[]error) {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		ref, ok := d.Components.Schemas[name]
+		if !ok {
+			*errs = append(*errs, fmt.Errorf("%s: unknown schema %s", at, s.Ref))
+			return
+		}
+		d.validate(ref, v, at, errs)
+		return
+	}
+
+	if len(s.AnyOf) > 0 {
+		for _, alt := range s.AnyOf {
+			var altErrs []error
+			d.validate(alt, v, at, &altErrs)
+			if len(altErrs) == 0 {
+				return
+			}
+		}
+		*errs = append(*errs, fmt.Errorf("%s: matches none of the allowed schemas", at))
+		return
+	}
+
+	if types := schemaTypes(s); len(types) > 0 {
+		got := jsonType(v)
+		if !typeAllowed(types, got, v) {
+			*errs = append(*errs, fmt.Errorf("%s: got %s, want %s", at, got, strings.Join(types, " or ")))
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		*errs = append(*errs, fmt.Errorf("%s: %v is not one of %v", at, v, s.Enum))
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				*errs = append(*errs, fmt.Errorf("%s: missing required property %q", at, name))
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			switch {
+			case s.Properties[k] != nil:
+				d.validate(s.Properties[k], val[k], at+"."+k, errs)
+			case s.AdditionalProperties != nil:
+				d.validate(s.AdditionalProperties, val[k], at+"."+k, errs)
+			case s.Properties != nil:
+				*errs = append(*errs, fmt.Errorf("%s: undocumented property %q", at, k))
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range val {
+				d.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i), errs)
+			}
+		}
+	}
+}
+
+func schemaTypes(s *Schema) []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	}
+	return nil
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func typeAllowed(types []string, got string, v interface{}) bool {
+	for _, t := range types {
+		if t == got || (t == "integer" && got == "number" && isInteger(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isInteger(v interface{}) bool {
+	switch n := v.(type) {
+	case json.Number:
+		_, err := n.Int64()
+		return err == nil
+	case float64:
+		return n == math.Trunc(n)
+	}
+	return false
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
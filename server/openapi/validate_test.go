@@ -0,0 +1,151 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testItem struct {
+	ID    int     `json:"id"`
+	Score float64 `json:"score"`
+	Name  string  `json:"name"`
+}
+
+type testBody struct {
+	Count   int64             `json:"count"`
+	Items   []testItem        `json:"items"`
+	Parent  *testItem         `json:"parent"`           // object or null
+	Note    *string           `json:"note"`             // string or null
+	When    time.Time         `json:"when,omitempty"`   // optional
+	Labels  map[string]string `json:"labels,omitempty"` // any keys
+	private int
+}
+
+func decodeJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	s := d.SchemaOf(testBody{})
+
+	valid := `{"count": 2, "items": [{"id": 1, "score": 0.5, "name": "a"}, {"id": 2, "score": 3, "name": "b"}],
+	           "parent": null, "note": "n", "labels": {"k": "v"}}`
+	if err := d.Validate(s, decodeJSON(t, valid)); err != nil {
+		t.Errorf("valid body: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want string // substring of the error
+	}{
+		{"missing required", `{"items": [], "parent": null, "note": null}`, `missing required property "count"`},
+		{"undocumented property", `{"count": 1, "items": [], "parent": null, "note": null, "extra": 1}`, `undocumented property "extra"`},
+		{"fraction for integer", `{"count": 1.5, "items": [], "parent": null, "note": null}`, "$.count: got number, want integer"},
+		{"string for integer", `{"count": "1", "items": [], "parent": null, "note": null}`, "$.count: got string"},
+		{"nested item", `{"count": 1, "items": [{"id": 1, "score": "high", "name": "a"}], "parent": null, "note": null}`, "$.items[0].score: got string, want number"},
+		{"anyOf matches neither", `{"count": 1, "items": [], "parent": 5, "note": null}`, "$.parent: matches none of the allowed schemas"},
+		{"anyOf object invalid", `{"count": 1, "items": [], "parent": {"id": 1}, "note": null}`, "$.parent: matches none"},
+		{"null for non-nullable", `{"count": 1, "items": null, "parent": null, "note": null}`, "$.items: got null, want array"},
+		{"additional property type", `{"count": 1, "items": [], "parent": null, "note": null, "labels": {"k": 1}}`, "$.labels.k: got number, want string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.Validate(s, decodeJSON(t, tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateIntegerForms(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	s := &Schema{Type: "integer"}
+	for _, ok := range []string{"1", "-3", "0"} {
+		if err := d.Validate(s, decodeJSON(t, ok)); err != nil {
+			t.Errorf("%s: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"1.5", "true", `"1"`} {
+		if err := d.Validate(s, decodeJSON(t, bad)); err == nil {
+			t.Errorf("%s accepted as an integer", bad)
+		}
+	}
+	// A number schema accepts integers too
+	if err := d.Validate(&Schema{Type: "number"}, decodeJSON(t, "2")); err != nil {
+		t.Errorf("integer as number: %v", err)
+	}
+}
+
+func TestValidateEnum(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	s := &Schema{Type: "string", Enum: []interface{}{"ok", "failed"}}
+	if err := d.Validate(s, "ok"); err != nil {
+		t.Error(err)
+	}
+	if err := d.Validate(s, "maybe"); err == nil {
+		t.Error("value outside the enum accepted")
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	d.Add(Operation{
+		Method: "GET", Path: "/items/{id}", ID: "getItem",
+		Responses: []Response{
+			{Status: http.StatusOK, Body: testItem{}},
+			{Status: http.StatusNoContent},
+		},
+	})
+
+	if err := d.ValidateResponse("GET", "/items/{id}", 200, []byte(`{"id": 1, "score": 1, "name": "a"}`)); err != nil {
+		t.Errorf("valid response: %v", err)
+	}
+	if err := d.ValidateResponse("GET", "/items/{id}", 204, nil); err != nil {
+		t.Errorf("response without a body: %v", err)
+	}
+	for name, check := range map[string]error{
+		"undocumented status": d.ValidateResponse("GET", "/items/{id}", 404, []byte(`{}`)),
+		"undocumented path":   d.ValidateResponse("GET", "/other", 200, []byte(`{}`)),
+		"invalid JSON":        d.ValidateResponse("GET", "/items/{id}", 200, []byte(`{`)),
+		"wrong body":          d.ValidateResponse("GET", "/items/{id}", 200, []byte(`{"id": "1", "score": 1, "name": "a"}`)),
+	} {
+		if check == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	if ref := d.SchemaOf(testBody{}).Ref; ref != "#/components/schemas/testBody" {
+		t.Fatalf("ref = %q", ref)
+	}
+	s := d.Components.Schemas["testBody"]
+	got, _ := json.Marshal(s.Required)
+	if !bytes.Equal(got, []byte(`["count","items","parent","note"]`)) {
+		t.Errorf("required = %s", got)
+	}
+	if _, ok := s.Properties["private"]; ok {
+		t.Error("unexported field documented")
+	}
+	if typ := s.Properties["count"]; typ.Type != "integer" || typ.Format != "int64" {
+		t.Errorf("count = %+v", typ)
+	}
+	if when := s.Properties["when"]; when.Type != "string" || when.Format != "date-time" {
+		t.Errorf("when = %+v", when)
+	}
+}
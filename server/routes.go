@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"server/apiversion"
+	"server/config"
+	"server/handlers"
+	"server/logging"
+	"server/metrics"
+	"server/tracing"
+
+	"github.com/gorilla/mux"
+)
+
+// legacyDeprecatedSince is announced in the Deprecation header of the
+// unversioned routes: the release that introduced /v1.
+var legacyDeprecatedSince = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// newRouter registers every route: the operational endpoints, each API
+// version and, when enabled, the unversioned alias of v1.
+func newRouter(h *handlers.Handlers, cfg *config.Config) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(logging.Middleware, metrics.Middleware, tracing.Middleware)
+	// Unmatched requests skip r.Use middleware, so they get the request ID
+	// for the error body here
+	r.NotFoundHandler = logging.Middleware(http.HandlerFunc(handlers.NotFound))
+	r.MethodNotAllowedHandler = logging.Middleware(http.HandlerFunc(handlers.MethodNotAllowed))
+
+	// 📈 Prometheus metrics
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// 🩺 Liveness and readiness probes
+	r.HandleFunc("/healthz", handlers.Healthz).Methods("GET", "HEAD")
+	r.HandleFunc("/readyz", handlers.Readyz).Methods("GET", "HEAD")
+
+	// 📄 API description
+	r.HandleFunc("/openapi.json", handlers.OpenAPI).Methods("GET")
+
+	// 🏷️ Versioned API: /v1/..., plus the unversioned paths as a deprecated
+	// alias of v1 (registered last, so they never shadow a version)
+	versions := apiVersions(h)
+	for _, v := range versions {
+		apiversion.Mount(r, v)
+	}
+	if cfg.Server.LegacyRoutes {
+		sunset, _ := time.Parse(time.DateOnly, cfg.Server.LegacySunset) // validated; zero when empty
+		apiversion.MountLegacy(r, versions[0], apiversion.Legacy{Since: legacyDeprecatedSince, Sunset: sunset})
+	}
+	return r
+}
+
+// apiVersions lists every version of the API, oldest first. To change a
+// contract, add a version here with its own routes (reusing v1's handlers
+// for whatever did not change) instead of editing v1. The unversioned
+// paths stay an alias of v1, since that is what clients written before
+// versioning expect.
+func apiVersions(h *handlers.Handlers) []apiversion.Version {
+	return []apiversion.Version{
+		{Name: "v1", Routes: v1Routes(h)},
+	}
+}
+
+// v1Routes is the API as it was before versioning.
+func v1Routes(h *handlers.Handlers) func(r *mux.Router) {
+	return func(r *mux.Router) {
+		// File routes
+		r.HandleFunc("/upload", h.UploadFile).Methods("POST")
+		r.HandleFunc("/uploads", h.UploadFiles).Methods("POST")
+		r.HandleFunc("/files", h.ListUserFiles).Methods("GET")
+		r.HandleFunc("/files/bulk", h.BulkFiles).Methods("POST")
+		r.HandleFunc("/files/{id:[0-9]+}/thumbnail", handlers.GetThumbnail).Methods("GET", "HEAD")
+		r.HandleFunc("/download", h.DownloadFile).Methods("GET", "HEAD")
+		r.HandleFunc("/delete", h.DeleteFile).Methods("DELETE")
+		r.HandleFunc("/search", handlers.SearchFiles).Methods("GET")
+
+		// 🔔 Webhook subscriptions
+		r.HandleFunc("/webhooks", handlers.ListWebhooks).Methods("GET")
+		r.HandleFunc("/webhooks", h.CreateWebhook).Methods("POST")
+		r.HandleFunc("/webhooks", handlers.DeleteWebhook).Methods("DELETE")
+		r.HandleFunc("/webhooks/deliveries", handlers.ListWebhookDeliveries).Methods("GET")
+
+		// ✅ Admin analytics routes
+		r.HandleFunc("/admin/system-stats", h.GetSystemStats).Methods("GET")
+		r.HandleFunc("/admin/users", h.GetAllUserStats).Methods("GET")
+		r.HandleFunc("/admin/user-stats", h.GetUserStats).Methods("GET")
+		r.HandleFunc("/admin/file-details", h.GetUserFileDetails).Methods("GET")
+		r.HandleFunc("/admin/user-usage", h.GetUserUsageHistory).Methods("GET")
+		r.HandleFunc("/admin/jobs", handlers.ListJobs).Methods("GET")
+		r.HandleFunc("/admin/jobs/retry", handlers.RetryJob).Methods("POST")
+		r.HandleFunc("/admin/webhooks", handlers.ListAllWebhooks).Methods("GET")
+		r.HandleFunc("/admin/webhooks", h.CreateSystemWebhook).Methods("POST")
+		r.HandleFunc("/admin/webhooks", handlers.DeleteAnyWebhook).Methods("DELETE")
+		r.HandleFunc("/admin/webhooks/deliveries", handlers.ListAllWebhookDeliveries).Methods("GET")
+	}
+}
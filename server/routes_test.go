@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+
+	"server/config"
+	"server/handlers"
+	"server/store"
+)
+
+// The router and the OpenAPI document must list the same operations.
+func TestRouterMatchesOpenAPI(t *testing.T) {
+	s, _ := store.NewMemory()
+	r := newRouter(handlers.New(s, &store.MemoryObjects{}), config.Get())
+	if err := handlers.APIDocument().Check(r); err != nil {
+		t.Fatal(err)
+	}
+}
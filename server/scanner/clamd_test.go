@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd accepts one INSTREAM session, records the chunk sizes and the
+// reassembled content, and answers with reply.
+type fakeClamd struct {
+	ln      net.Listener
+	chunks  []int
+	content bytes.Buffer
+	err     chan error
+}
+
+func startFakeClamd(t *testing.T, reply string) *fakeClamd {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeClamd{ln: ln, err: make(chan error, 1)}
+	go func() { f.err <- f.serve(reply) }()
+	return f
+}
+
+func (f *fakeClamd) serve(reply string) error {
+	conn, err := f.ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return err
+	}
+	if cmd != "zINSTREAM\x00" {
+		return io.ErrUnexpectedEOF
+	}
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return err
+		}
+		if size == 0 {
+			break
+		}
+		f.chunks = append(f.chunks, int(size))
+		if _, err := io.CopyN(&f.content, r, int64(size)); err != nil {
+			return err
+		}
+	}
+	_, err = conn.Write([]byte(reply + "\x00"))
+	return err
+}
+
+func TestClamdScan(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     string
+		want      Result
+		wantErr   string
+		contentSz int
+	}{
+		{"clean", "stream: OK", Result{Status: StatusClean}, "", 10},
+		{"found", "stream: Eicar-Test-Signature FOUND", Result{Status: StatusInfected, Signature: "Eicar-Test-Signature"}, "", 68},
+		{"error", "INSTREAM size limit exceeded. ERROR", Result{}, "size limit exceeded", 1},
+		{"empty content", "stream: OK", Result{Status: StatusClean}, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := startFakeClamd(t, tt.reply)
+			c := &Clamd{Addr: f.ln.Addr().String(), Timeout: 5 * time.Second}
+			got, err := c.Scan(context.Background(), bytes.NewReader(make([]byte, tt.contentSz)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil || got != tt.want {
+				t.Fatalf("Scan = %+v, %v; want %+v", got, err, tt.want)
+			}
+			if err := <-f.err; err != nil {
+				t.Fatalf("fake clamd: %v", err)
+			}
+		})
+	}
+}
+
+func TestClamdChunkFraming(t *testing.T) {
+	data := make([]byte, 2*clamdChunkSize+123)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	f := startFakeClamd(t, "stream: OK")
+	c := &Clamd{Addr: f.ln.Addr().String(), Timeout: 5 * time.Second}
+	if _, err := c.Scan(context.Background(), bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-f.err; err != nil {
+		t.Fatalf("fake clamd: %v", err)
+	}
+	want := []int{clamdChunkSize, clamdChunkSize, 123}
+	if len(f.chunks) != len(want) {
+		t.Fatalf("chunks = %v, want %v", f.chunks, want)
+	}
+	for i := range want {
+		if f.chunks[i] != want[i] {
+			t.Fatalf("chunks = %v, want %v", f.chunks, want)
+		}
+	}
+	if !bytes.Equal(f.content.Bytes(), data) {
+		t.Error("clamd received different content")
+	}
+}
+
+func TestClamdDialError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	c := &Clamd{Addr: addr, Timeout: time.Second}
+	if _, err := c.Scan(context.Background(), strings.NewReader("x")); err == nil {
+		t.Fatal("Scan against a closed port succeeded")
+	}
+}
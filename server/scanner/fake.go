@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// eicar is the standard antivirus test file.
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Fake is an in-process scanner for local development and tests. It flags
+// content containing any of its signatures (the EICAR string by default).
+type Fake struct {
+	Signatures map[string][]byte // signature name → byte pattern
+}
+
+// NewFake returns a Fake that detects the EICAR test file.
+func NewFake() *Fake {
+	return &Fake{Signatures: map[string][]byte{
+		"Eicar-Test-Signature": []byte(eicar),
+	}}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	for name, pattern := range f.Signatures {
+		if bytes.Contains(data, pattern) {
+			return Result{Status: StatusInfected, Signature: name}, nil
+		}
+	}
+	return Result{Status: StatusClean}, nil
+}
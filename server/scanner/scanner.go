@@ -0,0 +1,77 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"server/config"
+)
+
+// Scan statuses stored in file_blobs.scan_status
+const (
+	StatusPending  = "pending"
+	StatusClean    = "clean"
+	StatusInfected = "infected"
+	StatusError    = "error"
+)
+
+// Result is a scanner's verdict on one piece of content.
+type Result struct {
+	Status    string // StatusClean or StatusInfected
+	Signature string // name of the matched signature when infected
+}
+
+// Scanner inspects content for malware. Implementations must consume r
+// fully or not at all; errors mean "no verdict", not "infected".
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+	Name() string
+}
+
+// Default is the scanner used by the handlers, set by Init.
+var Default Scanner = Noop{}
+
+// Init selects the default scanner (see New).
+func Init(c config.Scanner) error {
+	s, err := New(c)
+	if err != nil {
+		return err
+	}
+	Default = s
+	slog.Info("malware scanner initialized", "engine", s.Name())
+	return nil
+}
+
+// New builds the scanner selected by c.Engine (SCANNER):
+//
+//	clamd  clamd INSTREAM client at CLAMD_ADDR (host:port or unix socket path)
+//	fake   in-process fake that flags the EICAR test file
+//	none   no scanning; every blob is reported clean (default)
+func New(c config.Scanner) (Scanner, error) {
+	switch mode := c.Engine; mode {
+	case "", "none":
+		slog.Warn("malware scanning disabled (SCANNER=none)")
+		return Noop{}, nil
+	case "fake":
+		return NewFake(), nil
+	case "clamd":
+		if c.ClamdAddr == "" {
+			return nil, fmt.Errorf("SCANNER=clamd requires CLAMD_ADDR")
+		}
+		return &Clamd{Addr: c.ClamdAddr, Timeout: 2 * time.Minute}, nil
+	default:
+		return nil, fmt.Errorf("unknown SCANNER %q", mode)
+	}
+}
+
+// Noop reports everything clean without looking at it.
+type Noop struct{}
+
+func (Noop) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{Status: StatusClean}, nil
+}
+
+func (Noop) Name() string { return "none" }
@@ -0,0 +1,892 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// 🔹 Memory: an in-process Store for unit tests
+//
+// It keeps the same books as the Postgres store (ref counts, logical and
+// physical totals, attribution, the usage ledger) so dedup and accounting
+// logic can be exercised without a database. Webhook events are recorded
+// instead of delivered. Everything is lost with the process.
+//
+type Memory struct {
+	mu     sync.Mutex
+	nextID map[string]int // per table, like the serial columns
+	now    func() time.Time
+
+	users     map[string]*User
+	userStats map[int]*UserStats
+	blobs     map[int]*Blob
+	chunks    map[string]*memChunk
+	manifests map[int][]Chunk // blob_chunks, per blob
+	files     map[int]*memFile
+	usage     map[int]map[time.Time]Usage
+	system    SystemStats
+	events    []RecordedEvent
+}
+
+// UserStats mirrors the user_stats columns the store maintains.
+type UserStats struct {
+	FilesCount           int
+	StorageUsed          int64 // logical
+	AttributedStorage    int64 // physical share
+	DeduplicationSavings int64
+	UploadsThisMonth     int
+	DownloadsThisMonth   int
+	StatsMonth           time.Time
+	LastActive           time.Time
+}
+
+// SystemStats mirrors today's system_stats row.
+type SystemStats struct {
+	TotalFiles     int
+	TotalStorage   int64 // physical
+	LogicalStorage int64
+	TotalUploads   int
+	TotalDownloads int
+}
+
+// RecordedEvent is a webhook event the memory store would have written to
+// the outbox.
+type RecordedEvent struct {
+	Type   string
+	UserID int
+	Data   FileEvent
+}
+
+// memChunk is a chunks row. Unlike in Postgres, a chunk is dropped as soon
+// as nothing references it: there is no purge.chunks job to wait for.
+type memChunk struct {
+	size     int64
+	refCount int
+}
+
+type memFile struct {
+	id         int
+	userID     int
+	blobID     int
+	name       string
+	uploadedAt time.Time
+	folder     string
+	tags       []string
+	public     bool
+	trashedAt  *time.Time
+}
+
+// NewMemory returns an empty in-memory Store and the Memory behind it, for
+// inspecting its books.
+func NewMemory() (*Store, *Memory) {
+	m := &Memory{
+		nextID:    map[string]int{},
+		now:       time.Now,
+		users:     map[string]*User{},
+		userStats: map[int]*UserStats{},
+		blobs:     map[int]*Blob{},
+		chunks:    map[string]*memChunk{},
+		manifests: map[int][]Chunk{},
+		files:     map[int]*memFile{},
+		usage:     map[int]map[time.Time]Usage{},
+	}
+	return &Store{Users: memUsers{m}, Files: memFiles{m}, Blobs: memBlobs{m}, Chunks: memChunks{m}, Stats: memStats{m}}, m
+}
+
+// UserStats returns a copy of a user's stats.
+func (m *Memory) UserStats(userID int) UserStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.userStats[userID]; s != nil {
+		return *s
+	}
+	return UserStats{}
+}
+
+// SystemStats returns a copy of the system totals.
+func (m *Memory) SystemStats() SystemStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.system
+}
+
+// Events returns the webhook events written so far.
+func (m *Memory) Events() []RecordedEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RecordedEvent(nil), m.events...)
+}
+
+// Usage returns a user's ledger entry for month.
+func (m *Memory) Usage(userID int, month time.Time) Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage[userID][month]
+}
+
+// SetScanStatus records a scan verdict for a blob, as the scan job would.
+func (m *Memory) SetScanStatus(blobID int, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b := m.blobs[blobID]; b != nil {
+		b.ScanStatus = status
+	}
+}
+
+// SetNow replaces the clock behind created, uploaded and last-active times.
+func (m *Memory) SetNow(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+func (m *Memory) id(table string) int {
+	m.nextID[table]++
+	return m.nextID[table]
+}
+
+type (
+	memUsers  struct{ *Memory }
+	memBlobs  struct{ *Memory }
+	memChunks struct{ *Memory }
+	memFiles  struct{ *Memory }
+	memStats  struct{ *Memory }
+)
+
+//
+// 🔹 Users
+//
+func (m memUsers) Ensure(_ context.Context, email string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[email]
+	if !ok {
+		u = &User{ID: m.id("users"), Email: email, Plan: "free"}
+		m.users[email] = u
+		m.userStats[u.ID] = &UserStats{}
+	}
+	return *u, nil
+}
+
+//
+// 🔹 Blobs
+//
+func (m memBlobs) ByID(_ context.Context, id int) (Blob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b := m.blobs[id]; b != nil {
+		return *b, nil
+	}
+	return Blob{}, ErrNotFound
+}
+
+func (m memBlobs) ByHash(_ context.Context, hash string) (Blob, error) {
+	return m.find(func(b *Blob) bool { return b.Hash == hash })
+}
+
+func (m memBlobs) ByKey(_ context.Context, key string) (Blob, error) {
+	return m.find(func(b *Blob) bool { return b.S3Key == key })
+}
+
+func (m memBlobs) find(match func(*Blob) bool) (Blob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range m.blobs {
+		if match(b) {
+			return *b, nil
+		}
+	}
+	return Blob{}, ErrNotFound
+}
+
+func (m memBlobs) Delete(_ context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, id)
+	return nil
+}
+
+func (m memBlobs) DeleteOrphan(_ context.Context, b Blob) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cur := m.blobs[b.ID]
+	if cur == nil || cur.RefCount > 0 {
+		return 0, false, nil
+	}
+	for _, f := range m.files {
+		if f.blobID == b.ID {
+			return 0, false, nil
+		}
+	}
+	physical := cur.Size
+	if cur.StorageMode == StorageModeChunked {
+		physical = m.releaseChunks(b.ID)
+	}
+	delete(m.blobs, b.ID)
+	return physical, true, nil
+}
+
+//
+// 🔹 Chunks
+//
+func (m memChunks) Claim(_ context.Context, hashes []string) (map[string]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := map[string]bool{}
+	for _, h := range hashes {
+		if c := m.chunks[h]; c != nil && c.refCount > 0 {
+			stored[h] = true
+		}
+	}
+	return stored, nil
+}
+
+func (m memChunks) Overlapping(_ context.Context, blobID int, start, end int64) ([]Chunk, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Chunk
+	for _, c := range m.manifests[blobID] {
+		if c.Offset <= end && c.Offset+c.Size > start {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (m memChunks) Release(_ context.Context, blobID int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.releaseChunks(blobID), nil
+}
+
+// releaseChunks drops blobID's chunk references and returns the bytes of
+// the chunks left unreferenced.
+func (m *Memory) releaseChunks(blobID int) int64 {
+	var freed int64
+	for _, c := range m.manifests[blobID] {
+		row := m.chunks[c.Hash]
+		if row == nil {
+			continue
+		}
+		if row.refCount--; row.refCount <= 0 {
+			freed += row.size
+			delete(m.chunks, c.Hash)
+		}
+	}
+	delete(m.manifests, blobID)
+	return freed
+}
+
+// Chunks returns the stored chunks and their reference counts.
+func (m *Memory) Chunks() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	refs := map[string]int{}
+	for h, c := range m.chunks {
+		refs[h] = c.refCount
+	}
+	return refs
+}
+
+//
+// 🔹 Files
+//
+func (m memFiles) Link(_ context.Context, l Link) (Linked, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := Linked{BlobID: l.Blob.ID}
+	switch {
+	case l.NewBlob:
+		b := l.Blob
+		b.ID = m.id("file_blobs")
+		b.RefCount = 1
+		b.CreatedAt = m.now()
+		if b.StorageMode == "" {
+			b.StorageMode = StorageModeFile
+		}
+		if b.ScanStatus == "" {
+			b.ScanStatus = "pending"
+		}
+		if b.ThumbnailStatus == "" {
+			b.ThumbnailStatus = "none"
+		}
+		m.blobs[b.ID] = &b
+		res.BlobID = b.ID
+		for _, c := range l.Chunks {
+			row := m.chunks[c.Hash]
+			if row == nil {
+				row = &memChunk{size: c.Size}
+				m.chunks[c.Hash] = row
+			}
+			if row.refCount++; row.refCount == 1 {
+				res.NewChunkBytes += c.Size
+			}
+		}
+		if len(l.Chunks) > 0 {
+			m.manifests[b.ID] = append([]Chunk(nil), l.Chunks...)
+		}
+	case l.Duplicate:
+		b := m.blobs[l.Blob.ID]
+		if b == nil {
+			return res, ErrNotFound
+		}
+		b.RefCount++
+	default:
+		if m.blobs[l.Blob.ID] == nil {
+			return res, ErrNotFound
+		}
+	}
+
+	res.FileID = m.id("user_files")
+	m.files[res.FileID] = &memFile{
+		id:         res.FileID,
+		userID:     l.UserID,
+		blobID:     res.BlobID,
+		name:       l.FileName,
+		uploadedAt: m.now(),
+		folder:     "/",
+	}
+	m.events = append(m.events, RecordedEvent{Type: EventFileUploaded, UserID: l.UserID, Data: FileEvent{
+		FileID:    res.FileID,
+		UserID:    l.UserID,
+		Email:     l.Email,
+		FileName:  l.FileName,
+		Size:      l.Blob.Size,
+		MimeType:  l.Blob.MimeType,
+		Hash:      l.Blob.Hash,
+		S3Key:     l.Blob.S3Key,
+		Duplicate: l.Duplicate,
+	}})
+	return res, nil
+}
+
+func (m memFiles) Unlink(_ context.Context, ref FileRef) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := m.blobs[ref.Blob.ID]
+	if b == nil {
+		return 0, ErrNotFound
+	}
+	if ref.FileID != 0 {
+		delete(m.files, ref.FileID)
+		m.events = append(m.events, RecordedEvent{Type: EventFileDeleted, UserID: ref.UserID, Data: FileEvent{
+			FileID:   ref.FileID,
+			UserID:   ref.UserID,
+			Email:    ref.Email,
+			FileName: ref.FileName,
+			Size:     ref.Blob.Size,
+			Hash:     ref.Blob.Hash,
+			S3Key:    ref.Blob.S3Key,
+		}})
+	}
+	b.RefCount--
+	return b.RefCount, nil
+}
+
+func (m memFiles) List(_ context.Context, email string) ([]File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var files []File
+	for _, f := range m.newestFirst() {
+		if u := m.userByID(f.userID); u != nil && u.Email == email && f.trashedAt == nil {
+			files = append(files, m.file(f))
+		}
+	}
+	return files, nil
+}
+
+func (m memFiles) Trash(_ context.Context, email string) ([]File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var files []File
+	for _, f := range m.newestFirst() {
+		if u := m.userByID(f.userID); u != nil && u.Email == email && f.trashedAt != nil {
+			files = append(files, m.file(f))
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].TrashedAt.After(*files[j].TrashedAt) })
+	return files, nil
+}
+
+func (m *Memory) file(f *memFile) File {
+	return File{
+		ID:         f.id,
+		UserID:     f.userID,
+		FileName:   f.name,
+		UploadedAt: f.uploadedAt,
+		Folder:     f.folder,
+		Tags:       append([]string{}, f.tags...),
+		Public:     f.public,
+		TrashedAt:  f.trashedAt,
+		Blob:       *m.blobs[f.blobID],
+	}
+}
+
+func (m memFiles) Holder(_ context.Context, blobID int, email string) (FileRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, f := range m.newestFirst() {
+		u := m.userByID(f.userID)
+		if f.blobID == blobID && f.trashedAt == nil && (email == "" || u.Email == email) {
+			return FileRef{FileID: f.id, UserID: u.ID, Email: u.Email, FileName: f.name, Blob: *m.blobs[blobID]}, nil
+		}
+	}
+	return FileRef{}, ErrNotFound
+}
+
+func (m memFiles) ByKey(_ context.Context, key, email string) (FileRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var blob *Blob
+	for _, b := range m.blobs {
+		if b.S3Key == key {
+			blob = b
+		}
+	}
+	if blob == nil {
+		return FileRef{}, ErrNotFound
+	}
+	trashed := false
+	for _, f := range m.newestFirst() {
+		if f.blobID != blob.ID {
+			continue
+		}
+		if f.trashedAt != nil {
+			trashed = true
+			continue
+		}
+		if u := m.userByID(f.userID); email == "" || u.Email == email {
+			return FileRef{FileID: f.id, UserID: u.ID, Email: u.Email, FileName: f.name, Blob: *blob}, nil
+		}
+	}
+	if email == "" && !trashed {
+		return FileRef{Blob: *blob}, nil
+	}
+	return FileRef{}, ErrNotFound
+}
+
+func (m memFiles) Bulk(_ context.Context, b Bulk) (BulkResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := BulkResult{Items: make([]BulkItem, len(b.FileIDs))}
+	var ok []*memFile
+	for i, id := range b.FileIDs {
+		f := m.files[id]
+		exists := f != nil && f.userID == b.Owner.ID
+		res.Items[i] = BulkItem{FileID: id, Err: bulkCheck(b, exists, exists && f.trashedAt != nil)}
+		if res.Items[i].Err == nil {
+			ok = append(ok, f)
+		}
+	}
+	if b.Atomic && len(ok) < len(b.FileIDs) {
+		return res, nil
+	}
+
+	now := m.now()
+	seen := map[int]bool{}
+	var logical int64
+	for _, f := range ok {
+		switch b.Op {
+		case BulkDelete:
+			if !b.Permanent {
+				f.trashedAt = &now
+				break
+			}
+			blob := m.blobs[f.blobID]
+			delete(m.files, f.id)
+			m.events = append(m.events, RecordedEvent{Type: EventFileDeleted, UserID: b.Owner.ID, Data: FileEvent{
+				FileID:   f.id,
+				UserID:   b.Owner.ID,
+				Email:    b.Owner.Email,
+				FileName: f.name,
+				Size:     blob.Size,
+				Hash:     blob.Hash,
+				S3Key:    blob.S3Key,
+			}})
+			blob.RefCount--
+			logical += blob.Size
+			if !seen[blob.ID] {
+				seen[blob.ID] = true
+				res.Blobs = append(res.Blobs, blob.ID)
+			}
+		case BulkRestore:
+			f.trashedAt = nil
+		case BulkMove:
+			f.folder = b.Folder
+		case BulkTag:
+			f.tags = retag(f.tags, b.AddTags, b.RemoveTags)
+		case BulkShare:
+			f.public = b.Public
+		}
+		if event := bulkEvent(b); event != "" {
+			blob := m.blobs[f.blobID]
+			data := FileEvent{
+				FileID:   f.id,
+				UserID:   b.Owner.ID,
+				Email:    b.Owner.Email,
+				FileName: f.name,
+				Size:     blob.Size,
+				Hash:     blob.Hash,
+				S3Key:    blob.S3Key,
+			}
+			if b.Op == BulkShare {
+				data.Public = &b.Public
+			}
+			m.events = append(m.events, RecordedEvent{Type: event, UserID: b.Owner.ID, Data: data})
+		}
+	}
+	for _, id := range res.Blobs {
+		if blob := m.blobs[id]; blob.RefCount <= 0 {
+			res.Released = append(res.Released, *blob)
+		}
+	}
+	if b.Op == BulkDelete && b.Permanent && len(ok) > 0 {
+		m.system.TotalFiles = max(m.system.TotalFiles-len(ok), 0)
+		m.system.LogicalStorage = max(m.system.LogicalStorage-logical, 0)
+		if s := m.userStats[b.Owner.ID]; s != nil {
+			s.FilesCount = max(s.FilesCount-len(ok), 0)
+			s.StorageUsed = max(s.StorageUsed-logical, 0)
+			s.LastActive = now
+		}
+	}
+	res.Committed = true
+	return res, nil
+}
+
+// retag adds then removes tags like the SQL: sorted, without duplicates.
+func retag(tags, add, remove []string) []string {
+	drop := map[string]bool{}
+	for _, t := range remove {
+		drop[t] = true
+	}
+	set := map[string]bool{}
+	out := []string{}
+	for _, t := range append(append([]string{}, tags...), add...) {
+		if !drop[t] && !set[t] {
+			set[t] = true
+			out = append(out, t)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// newestFirst orders files like the SQL's ORDER BY uploaded_at DESC; ids
+// break ties so same-instant uploads keep insertion order reversed.
+func (m *Memory) newestFirst() []*memFile {
+	out := make([]*memFile, 0, len(m.files))
+	for _, f := range m.files {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].uploadedAt.Equal(out[j].uploadedAt) {
+			return out[i].uploadedAt.After(out[j].uploadedAt)
+		}
+		return out[i].id > out[j].id
+	})
+	return out
+}
+
+func (m *Memory) userByID(id int) *User {
+	for _, u := range m.users {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+//
+// 🔹 Stats
+//
+func (m memStats) UserStorage(_ context.Context, userID int) (int64, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.userStats[userID]
+	if s == nil {
+		return 0, 0, ErrNotFound
+	}
+	return s.StorageUsed, s.AttributedStorage, nil
+}
+
+func (m memStats) FileAdded(_ context.Context, userID int, logical, physical int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.system.TotalFiles++
+	m.system.TotalStorage += physical
+	m.system.LogicalStorage += logical
+	m.system.TotalUploads++
+	if s := m.userStats[userID]; s != nil {
+		s.FilesCount++
+		s.StorageUsed += logical
+		s.LastActive = m.now()
+	}
+	return nil
+}
+
+func (m memStats) FileRemoved(_ context.Context, userID int, logical, physical int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.system.TotalFiles = max(m.system.TotalFiles-1, 0)
+	m.system.TotalStorage = max(m.system.TotalStorage-physical, 0)
+	m.system.LogicalStorage = max(m.system.LogicalStorage-logical, 0)
+	if s := m.userStats[userID]; s != nil {
+		s.FilesCount = max(s.FilesCount-1, 0)
+		s.StorageUsed = max(s.StorageUsed-logical, 0)
+		s.LastActive = m.now()
+	}
+	return nil
+}
+
+func (m memStats) PhysicalFreed(_ context.Context, bytes int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.system.TotalStorage = max(m.system.TotalStorage-bytes, 0)
+	return nil
+}
+
+func (m memStats) Downloaded(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.system.TotalDownloads++
+	return nil
+}
+
+func (m memStats) RecordUsage(_ context.Context, userID int, u Usage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.usage[userID] == nil {
+		m.usage[userID] = map[time.Time]Usage{}
+	}
+	cur := m.usage[userID][u.Month]
+	cur.Month = u.Month
+	cur.Uploads += u.Uploads
+	cur.Downloads += u.Downloads
+	cur.UploadBytes += u.UploadBytes
+	cur.EgressBytes += u.EgressBytes
+	m.usage[userID][u.Month] = cur
+
+	if s := m.userStats[userID]; s != nil {
+		// Counters from a previous month start again from zero.
+		if !s.StatsMonth.Equal(u.Month) {
+			s.UploadsThisMonth, s.DownloadsThisMonth = 0, 0
+		}
+		s.UploadsThisMonth += u.Uploads
+		s.DownloadsThisMonth += u.Downloads
+		s.StatsMonth = u.Month
+		s.LastActive = m.now()
+	}
+	return nil
+}
+
+// SyncAttribution recomputes what the user_storage_attribution view
+// derives: each reference is charged size / ref_count of its blob.
+func (m memStats) SyncAttribution(_ context.Context, blobID int, extraUserIDs ...int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	affected := map[int]bool{}
+	for _, id := range extraUserIDs {
+		affected[id] = true
+	}
+	for _, f := range m.files {
+		if f.blobID == blobID {
+			affected[f.userID] = true
+		}
+	}
+
+	logical := map[int]int64{}
+	shares := map[int]float64{}
+	for _, f := range m.files {
+		b := m.blobs[f.blobID]
+		logical[f.userID] += b.Size
+		shares[f.userID] += float64(b.Size) / float64(max(b.RefCount, 1))
+	}
+	for id := range affected {
+		if s := m.userStats[id]; s != nil {
+			s.AttributedStorage = int64(math.Round(shares[id]))
+			s.DeduplicationSavings = logical[id] - s.AttributedStorage
+		}
+	}
+	return nil
+}
+
+//
+// 🔹 Reports
+//
+func (m memStats) System(context.Context) (SystemReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := SystemReport{
+		Users:     len(m.users),
+		Files:     m.system.TotalFiles,
+		Uploads:   m.system.TotalUploads,
+		Downloads: m.system.TotalDownloads,
+	}
+	for _, b := range m.blobs {
+		r.Logical += b.Size * int64(b.RefCount)
+		if b.StorageMode == StorageModeChunked {
+			r.ChunkedBlobs++
+			r.ChunkLogical += b.Size
+		} else {
+			r.Physical += b.Size
+		}
+	}
+	for _, c := range m.chunks {
+		r.ChunkPhysical += c.size
+	}
+	r.Physical += r.ChunkPhysical
+	return r, nil
+}
+
+func (m memStats) Users(_ context.Context, q UserQuery) ([]UserReport, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := userSortKeys[q.Sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	var matched []UserReport
+	for _, u := range m.users {
+		r := m.userReport(u, q.Month)
+		if q.Search != "" && !strings.Contains(strings.ToLower(r.Email), strings.ToLower(q.Search)) {
+			continue
+		}
+		if q.InactiveDays >= 0 && !r.LastActive.Before(m.now().AddDate(0, 0, -q.InactiveDays)) {
+			continue
+		}
+		matched = append(matched, r)
+	}
+
+	// (key, id) ascending, or descending with Desc
+	before := func(a UserReport, aKey int64, b UserReport, bKey int64) bool {
+		if aKey != bKey {
+			return (aKey < bKey) != q.Desc
+		}
+		return a.ID != b.ID && (a.ID < b.ID) != q.Desc
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return before(matched[i], key(matched[i]), matched[j], key(matched[j]))
+	})
+
+	page := []UserReport{}
+	for _, r := range matched {
+		if q.After != nil {
+			pos := UserReport{ID: q.After.ID}
+			if !before(pos, sortValueKey(q.After.Value), r, key(r)) {
+				continue
+			}
+		}
+		if len(page) == q.Limit {
+			break
+		}
+		page = append(page, r)
+	}
+	return page, len(matched), nil
+}
+
+// userSortKeys orders UserReports like the SQL sort columns.
+var userSortKeys = map[string]func(UserReport) int64{
+	SortByID:       func(u UserReport) int64 { return int64(u.ID) },
+	SortByStorage:  func(u UserReport) int64 { return u.Logical },
+	SortByFiles:    func(u UserReport) int64 { return int64(u.Files) },
+	SortByActivity: func(u UserReport) int64 { return u.LastActive.UnixNano() },
+}
+
+// sortValueKey converts a UserCursor value to its userSortKeys form.
+func sortValueKey(v interface{}) int64 {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case time.Time:
+		return v.UnixNano()
+	}
+	return 0
+}
+
+func (m *Memory) userReport(u *User, month time.Time) UserReport {
+	r := UserReport{ID: u.ID, Email: u.Email, LastActive: time.Unix(0, 0).UTC()}
+	if s := m.userStats[u.ID]; s != nil {
+		r.Files = s.FilesCount
+		r.Logical = s.StorageUsed
+		r.Physical = s.AttributedStorage
+		r.Savings = s.DeduplicationSavings
+		if !s.LastActive.IsZero() {
+			r.LastActive = s.LastActive
+		}
+		if s.StatsMonth.Equal(month) {
+			r.UploadsThisMonth = s.UploadsThisMonth
+			r.DownloadsThisMonth = s.DownloadsThisMonth
+		}
+	}
+	return r
+}
+
+func (m memStats) User(_ context.Context, email string, month time.Time) (UserReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.users[email]
+	if u == nil {
+		return UserReport{}, ErrNotFound
+	}
+	return m.userReport(u, month), nil
+}
+
+func (m memStats) UsageHistory(_ context.Context, email string, first, last time.Time) ([]Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.users[email]
+	if u == nil {
+		return nil, ErrNotFound
+	}
+	var out []Usage
+	for month, usage := range m.usage[u.ID] {
+		if !month.Before(first) && !month.After(last) {
+			out = append(out, usage)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Month.Before(out[j].Month) })
+	return out, nil
+}
+
+func (m memStats) FileDetails(_ context.Context, email string) ([]FileDetail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []FileDetail
+	for _, f := range m.newestFirst() {
+		u := m.userByID(f.userID)
+		if u == nil || u.Email != email || f.trashedAt != nil {
+			continue
+		}
+		b := m.blobs[f.blobID]
+		out = append(out, FileDetail{
+			FileID:     f.id,
+			FileName:   f.name,
+			Size:       b.Size,
+			Hash:       b.Hash,
+			UploadedAt: f.uploadedAt,
+			Email:      u.Email,
+			RefCount:   b.RefCount,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"server/utils"
+)
+
+// Objects is where blob content is written, read back and removed.
+type Objects interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// OpenRange reads bytes [start, end] (inclusive) of an object.
+	OpenRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// S3 stores objects in the configured bucket (see utils.InitAWS).
+type S3 struct{}
+
+func (S3) Put(ctx context.Context, key string, r io.Reader) error {
+	return utils.UploadToS3(ctx, r, key)
+}
+
+func (S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return utils.DownloadFromS3(ctx, key)
+}
+
+func (S3) OpenRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error) {
+	return utils.DownloadRangeFromS3(ctx, key, start, end)
+}
+
+func (S3) Delete(ctx context.Context, key string) error {
+	return utils.DeleteFromS3(ctx, key)
+}
+
+// MemoryObjects keeps objects in a map, for tests.
+type MemoryObjects struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *MemoryObjects) Put(_ context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.objects == nil {
+		m.objects = map[string][]byte{}
+	}
+	m.objects[key] = data
+	return nil
+}
+
+func (m *MemoryObjects) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	data, ok := m.Get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *MemoryObjects) OpenRange(_ context.Context, key string, start, end int64) (io.ReadCloser, error) {
+	data, ok := m.Get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	end = min(end+1, int64(len(data)))
+	start = min(start, end)
+	return io.NopCloser(bytes.NewReader(data[start:end])), nil
+}
+
+func (m *MemoryObjects) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+// Get returns an object's content and whether it exists.
+func (m *MemoryObjects) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	return bytes.Clone(data), ok
+}
@@ -0,0 +1,901 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NewPostgres returns a Store backed by primary. reader serves the queries
+// that tolerate replication lag (listings) and may be primary itself;
+// outbox writes file.* webhook events inside the Link/Unlink transactions.
+func NewPostgres(primary, reader *pgxpool.Pool, outbox Outbox) *Store {
+	pg := &postgres{db: primary, reader: reader, outbox: outbox}
+	return &Store{Users: pgUsers{pg}, Files: pgFiles{pg}, Blobs: pgBlobs{pg}, Chunks: pgChunks{pg}, Stats: pgStats{pg}}
+}
+
+type postgres struct {
+	db     *pgxpool.Pool
+	reader *pgxpool.Pool
+	outbox Outbox
+}
+
+type (
+	pgUsers  struct{ *postgres }
+	pgBlobs  struct{ *postgres }
+	pgChunks struct{ *postgres }
+	pgFiles  struct{ *postgres }
+	pgStats  struct{ *postgres }
+)
+
+// notFound maps pgx's no-rows error to ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+//
+// 🔹 Users
+//
+func (p pgUsers) Ensure(ctx context.Context, email string) (User, error) {
+	u := User{Email: email}
+	err := p.db.QueryRow(ctx,
+		`INSERT INTO users (email) VALUES ($1)
+		 ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email
+		 RETURNING id, plan`,
+		email,
+	).Scan(&u.ID, &u.Plan)
+	if err != nil {
+		return u, fmt.Errorf("failed to ensure user: %w", err)
+	}
+
+	// Ensure user_stats row exists too
+	_, err = p.db.Exec(ctx, `
+		INSERT INTO user_stats (user_id, files_count, storage_used, uploads_this_month, downloads_this_month, deduplication_savings, last_active)
+		VALUES ($1, 0, 0, 0, 0, 0, NOW())
+		ON CONFLICT (user_id) DO NOTHING
+	`, u.ID)
+	if err != nil {
+		return u, fmt.Errorf("failed to ensure user_stats: %w", err)
+	}
+	return u, nil
+}
+
+//
+// 🔹 Blobs
+//
+const blobColumns = `
+	id, hash, s3_key, size, COALESCE(mime_type, ''), COALESCE(created_at, NOW()),
+	COALESCE(ref_count, 0), storage_mode, scan_status`
+
+func scanBlob(row pgx.Row) (Blob, error) {
+	var b Blob
+	err := row.Scan(&b.ID, &b.Hash, &b.S3Key, &b.Size, &b.MimeType, &b.CreatedAt, &b.RefCount, &b.StorageMode, &b.ScanStatus)
+	return b, notFound(err)
+}
+
+func (p pgBlobs) ByID(ctx context.Context, id int) (Blob, error) {
+	return scanBlob(p.db.QueryRow(ctx, `SELECT`+blobColumns+` FROM file_blobs WHERE id=$1`, id))
+}
+
+func (p pgBlobs) ByHash(ctx context.Context, hash string) (Blob, error) {
+	return scanBlob(p.db.QueryRow(ctx, `SELECT`+blobColumns+` FROM file_blobs WHERE hash=$1`, hash))
+}
+
+func (p pgBlobs) ByKey(ctx context.Context, key string) (Blob, error) {
+	return scanBlob(p.db.QueryRow(ctx, `SELECT`+blobColumns+` FROM file_blobs WHERE s3_key=$1`, key))
+}
+
+func (p pgBlobs) Delete(ctx context.Context, id int) error {
+	_, err := p.db.Exec(ctx, `DELETE FROM file_blobs WHERE id=$1`, id)
+	return err
+}
+
+func (p pgBlobs) DeleteOrphan(ctx context.Context, b Blob) (int64, bool, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	err = tx.QueryRow(ctx, `
+		SELECT id FROM file_blobs fb
+		WHERE id = $1 AND ref_count <= 0
+		  AND NOT EXISTS (SELECT 1 FROM user_files uf WHERE uf.blob_id = fb.id)
+		FOR UPDATE
+	`, b.ID).Scan(&b.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	physical := b.Size
+	if b.StorageMode == StorageModeChunked {
+		if physical, err = releaseChunks(ctx, tx, b.ID); err != nil {
+			return 0, false, fmt.Errorf("release chunks: %w", err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM file_blobs WHERE id = $1`, b.ID); err != nil {
+		return 0, false, err
+	}
+	return physical, true, tx.Commit(ctx)
+}
+
+// chunkGCGrace is how long an unreferenced chunk is kept before the
+// purge.chunks job may delete it. It must outlast the gap between an upload
+// claiming its chunks and committing its references.
+const chunkGCGrace = time.Hour
+
+//
+// 🔹 Chunks
+//
+func (p pgChunks) Claim(ctx context.Context, hashes []string) (map[string]bool, error) {
+	// A claim waits for a purge holding the chunk's lock, so the purge's
+	// delete cannot land after the caller's uploads.
+	_, err := p.db.Exec(ctx, `
+		UPDATE chunks SET gc_after = NOW() + make_interval(secs => $2)
+		WHERE hash = ANY($1) AND ref_count <= 0
+	`, hashes, chunkGCGrace.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("chunk claim failed: %w", err)
+	}
+
+	// Only referenced chunks are known to have their object; unreferenced
+	// ones are uploaded again.
+	rows, err := p.db.Query(ctx, `SELECT hash FROM chunks WHERE hash = ANY($1) AND ref_count > 0`, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("chunk lookup failed: %w", err)
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("chunk lookup failed: %w", err)
+	}
+	stored := make(map[string]bool, len(hashes))
+	for _, h := range found {
+		stored[h] = true
+	}
+	return stored, nil
+}
+
+func (p pgChunks) Overlapping(ctx context.Context, blobID int, start, end int64) ([]Chunk, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT c.hash, bc."offset", bc.size
+		FROM blob_chunks bc
+		JOIN chunks c ON c.id = bc.chunk_id
+		WHERE bc.blob_id = $1 AND bc."offset" <= $3 AND bc."offset" + bc.size > $2
+		ORDER BY bc.seq
+	`, blobID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Chunk, error) {
+		var c Chunk
+		err := row.Scan(&c.Hash, &c.Offset, &c.Size)
+		return c, err
+	})
+}
+
+func (p pgChunks) Release(ctx context.Context, blobID int) (int64, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	freed, err := releaseChunks(ctx, tx, blobID)
+	if err != nil {
+		return 0, err
+	}
+	return freed, tx.Commit(ctx)
+}
+
+// insertChunks records blobID's chunk list and takes a reference to each
+// chunk, returning the bytes of chunks nothing referenced before.
+func insertChunks(ctx context.Context, tx pgx.Tx, blobID int, chunks []Chunk) (int64, error) {
+	var newBytes int64
+	for seq, c := range chunks {
+		var chunkID int
+		var first bool
+		// ref_count = 1 afterwards means nothing referenced the chunk
+		// before, whether the row is new or was waiting for the purge.
+		err := tx.QueryRow(ctx, `
+			INSERT INTO chunks (hash, s3_key, size)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (hash) DO UPDATE SET ref_count = GREATEST(chunks.ref_count, 0) + 1
+			RETURNING id, ref_count = 1
+		`, c.Hash, ChunkKey(c.Hash), c.Size).Scan(&chunkID, &first)
+		if err != nil {
+			return 0, fmt.Errorf("chunk upsert failed: %w", err)
+		}
+		if first {
+			newBytes += c.Size
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO blob_chunks (blob_id, seq, chunk_id, "offset", size) VALUES ($1, $2, $3, $4, $5)`,
+			blobID, seq, chunkID, c.Offset, c.Size,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("manifest insert failed: %w", err)
+		}
+	}
+	return newBytes, nil
+}
+
+// releaseChunks is Chunks.Release inside the caller's transaction.
+func releaseChunks(ctx context.Context, tx pgx.Tx, blobID int) (int64, error) {
+	var freed int64
+	err := tx.QueryRow(ctx, `
+		WITH updated AS (
+			UPDATE chunks c
+			SET ref_count = c.ref_count - m.n,
+			    gc_after = NOW() + make_interval(secs => $2)
+			FROM (SELECT chunk_id, COUNT(*) AS n FROM blob_chunks WHERE blob_id = $1 GROUP BY chunk_id) m
+			WHERE c.id = m.chunk_id
+			RETURNING c.size, c.ref_count
+		)
+		SELECT COALESCE(SUM(size) FILTER (WHERE ref_count <= 0), 0) FROM updated
+	`, blobID, chunkGCGrace.Seconds()).Scan(&freed)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM blob_chunks WHERE blob_id = $1`, blobID)
+	return freed, err
+}
+
+//
+// 🔹 Files
+//
+func (p pgFiles) Link(ctx context.Context, l Link) (Linked, error) {
+	res := Linked{BlobID: l.Blob.ID}
+
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	switch {
+	case l.NewBlob:
+		mode := l.Blob.StorageMode
+		if mode == "" {
+			mode = StorageModeFile
+		}
+		err = tx.QueryRow(ctx,
+			`INSERT INTO file_blobs (hash, s3_key, size, mime_type, claimed_mime_type, detected_mime_type, storage_mode)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+			l.Blob.Hash, l.Blob.S3Key, l.Blob.Size, l.Blob.MimeType, l.Blob.ClaimedMimeType, l.Blob.DetectedMimeType, mode,
+		).Scan(&res.BlobID)
+		if err != nil {
+			return res, fmt.Errorf("insert file_blobs: %w", err)
+		}
+		if res.NewChunkBytes, err = insertChunks(ctx, tx, res.BlobID, l.Chunks); err != nil {
+			return res, err
+		}
+	case l.Duplicate:
+		if _, err := tx.Exec(ctx, `UPDATE file_blobs SET ref_count = ref_count + 1 WHERE id=$1`, l.Blob.ID); err != nil {
+			return res, err
+		}
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO user_files (user_id, blob_id, filename) VALUES ($1, $2, $3) RETURNING id`,
+		l.UserID, res.BlobID, l.FileName,
+	).Scan(&res.FileID)
+	if err != nil {
+		return res, err
+	}
+
+	err = p.outbox(ctx, tx, EventFileUploaded, l.UserID, FileEvent{
+		FileID:    res.FileID,
+		UserID:    l.UserID,
+		Email:     l.Email,
+		FileName:  l.FileName,
+		Size:      l.Blob.Size,
+		MimeType:  l.Blob.MimeType,
+		Hash:      l.Blob.Hash,
+		S3Key:     l.Blob.S3Key,
+		Duplicate: l.Duplicate,
+	})
+	if err != nil {
+		return res, fmt.Errorf("webhook outbox: %w", err)
+	}
+
+	return res, tx.Commit(ctx)
+}
+
+func (p pgFiles) Unlink(ctx context.Context, ref FileRef) (int, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if ref.FileID != 0 {
+		if _, err := tx.Exec(ctx, `DELETE FROM user_files WHERE id=$1`, ref.FileID); err != nil {
+			return 0, err
+		}
+	}
+
+	var refCount int
+	err = tx.QueryRow(ctx,
+		`UPDATE file_blobs SET ref_count=ref_count-1 WHERE id=$1 RETURNING ref_count`,
+		ref.Blob.ID,
+	).Scan(&refCount)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	if ref.FileID != 0 {
+		err := p.outbox(ctx, tx, EventFileDeleted, ref.UserID, FileEvent{
+			FileID:   ref.FileID,
+			UserID:   ref.UserID,
+			Email:    ref.Email,
+			FileName: ref.FileName,
+			Size:     ref.Blob.Size,
+			Hash:     ref.Blob.Hash,
+			S3Key:    ref.Blob.S3Key,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("webhook outbox: %w", err)
+		}
+	}
+	return refCount, tx.Commit(ctx)
+}
+
+func (p pgFiles) List(ctx context.Context, email string) ([]File, error) {
+	return p.list(ctx, `uf.trashed_at IS NULL ORDER BY uf.uploaded_at DESC`, email)
+}
+
+func (p pgFiles) Trash(ctx context.Context, email string) ([]File, error) {
+	return p.list(ctx, `uf.trashed_at IS NOT NULL ORDER BY uf.trashed_at DESC, uf.id DESC`, email)
+}
+
+// list returns email's files matching the condition and order in where.
+func (p pgFiles) list(ctx context.Context, where, email string) ([]File, error) {
+	rows, err := p.reader.Query(ctx, `
+		SELECT uf.id, uf.user_id, uf.filename, uf.uploaded_at,
+		       uf.folder, uf.tags, COALESCE(uf.is_public, false), uf.trashed_at,
+		       fb.id, fb.size, fb.mime_type, fb.hash, fb.s3_key, fb.ref_count,
+		       fb.storage_mode, fb.scan_status, fb.thumbnail_status
+		FROM user_files uf
+		JOIN file_blobs fb ON uf.blob_id = fb.id
+		JOIN users u ON uf.user_id = u.id
+		WHERE u.email = $1 AND `+where, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		var f File
+		b := &f.Blob
+		if err := rows.Scan(&f.ID, &f.UserID, &f.FileName, &f.UploadedAt,
+			&f.Folder, &f.Tags, &f.Public, &f.TrashedAt,
+			&b.ID, &b.Size, &b.MimeType, &b.Hash, &b.S3Key, &b.RefCount,
+			&b.StorageMode, &b.ScanStatus, &b.ThumbnailStatus); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+func (p pgFiles) Holder(ctx context.Context, blobID int, email string) (FileRef, error) {
+	ref := FileRef{}
+	err := p.db.QueryRow(ctx, `
+		SELECT uf.id, u.id, u.email, uf.filename
+		FROM user_files uf
+		JOIN users u ON uf.user_id = u.id
+		WHERE uf.blob_id = $1 AND uf.trashed_at IS NULL AND ($2 = '' OR u.email = $2)
+		ORDER BY uf.uploaded_at DESC
+		LIMIT 1
+	`, blobID, email).Scan(&ref.FileID, &ref.UserID, &ref.Email, &ref.FileName)
+	if err != nil {
+		return ref, notFound(err)
+	}
+	ref.Blob, err = pgBlobs{p.postgres}.ByID(ctx, blobID)
+	return ref, err
+}
+
+func (p pgFiles) ByKey(ctx context.Context, key, email string) (FileRef, error) {
+	var ref FileRef
+	b := &ref.Blob
+	// Pick exactly one reference outside the trash: the user's newest copy
+	// when email is given, otherwise the newest reference to the blob.
+	err := p.db.QueryRow(ctx, `
+		SELECT fb.id, fb.hash, fb.size, fb.storage_mode, fb.s3_key, COALESCE(u.id, 0), COALESCE(uf.id, 0),
+		       COALESCE(u.email, ''), COALESCE(uf.filename, '')
+		FROM file_blobs fb
+		LEFT JOIN user_files uf ON uf.blob_id = fb.id AND uf.trashed_at IS NULL
+		LEFT JOIN users u ON uf.user_id = u.id
+		WHERE fb.s3_key=$1 AND ($2 = '' OR u.email = $2)
+		  AND (uf.id IS NOT NULL OR NOT EXISTS (SELECT 1 FROM user_files t WHERE t.blob_id = fb.id))
+		ORDER BY uf.uploaded_at DESC NULLS LAST
+		LIMIT 1
+	`, key, email).Scan(&b.ID, &b.Hash, &b.Size, &b.StorageMode, &b.S3Key, &ref.UserID, &ref.FileID, &ref.Email, &ref.FileName)
+	return ref, notFound(err)
+}
+
+func (p pgFiles) Bulk(ctx context.Context, b Bulk) (BulkResult, error) {
+	res := BulkResult{Items: make([]BulkItem, len(b.FileIDs))}
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Lock the owner's files first so their state cannot change between
+	// the checks and the update
+	rows, err := tx.Query(ctx, `
+		SELECT uf.id, uf.filename, uf.trashed_at IS NOT NULL,
+		       fb.id, fb.hash, fb.s3_key, fb.size, fb.storage_mode
+		FROM user_files uf
+		JOIN file_blobs fb ON uf.blob_id = fb.id
+		WHERE uf.user_id = $1 AND uf.id = ANY($2)
+		FOR UPDATE OF uf
+	`, b.Owner.ID, b.FileIDs)
+	if err != nil {
+		return res, err
+	}
+	type found struct {
+		name    string
+		trashed bool
+		blob    Blob
+	}
+	files := map[int]found{}
+	for rows.Next() {
+		var id int
+		var f found
+		if err := rows.Scan(&id, &f.name, &f.trashed, &f.blob.ID, &f.blob.Hash, &f.blob.S3Key, &f.blob.Size, &f.blob.StorageMode); err != nil {
+			rows.Close()
+			return res, err
+		}
+		files[id] = f
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+
+	var ids []int
+	for i, id := range b.FileIDs {
+		f, ok := files[id]
+		res.Items[i] = BulkItem{FileID: id, Err: bulkCheck(b, ok, f.trashed)}
+		if res.Items[i].Err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if b.Atomic && len(ids) < len(b.FileIDs) {
+		return res, nil
+	}
+	if len(ids) == 0 {
+		res.Committed = true
+		return res, nil
+	}
+
+	switch {
+	case b.Op == BulkDelete && b.Permanent:
+		if _, err := tx.Exec(ctx, `DELETE FROM user_files WHERE id = ANY($1)`, ids); err != nil {
+			return res, err
+		}
+		// One ref_count update per blob, however many of its references
+		// went, and one stats update for all of them
+		refs := map[int]int{}
+		blobs := map[int]Blob{}
+		var logical int64
+		for _, id := range ids {
+			f := files[id]
+			if refs[f.blob.ID] == 0 {
+				res.Blobs = append(res.Blobs, f.blob.ID)
+			}
+			refs[f.blob.ID]++
+			blobs[f.blob.ID] = f.blob
+			logical += f.blob.Size
+
+			err := p.outbox(ctx, tx, EventFileDeleted, b.Owner.ID, FileEvent{
+				FileID:   id,
+				UserID:   b.Owner.ID,
+				Email:    b.Owner.Email,
+				FileName: f.name,
+				Size:     f.blob.Size,
+				Hash:     f.blob.Hash,
+				S3Key:    f.blob.S3Key,
+			})
+			if err != nil {
+				return res, fmt.Errorf("webhook outbox: %w", err)
+			}
+		}
+		counts := make([]int, len(res.Blobs))
+		for i, id := range res.Blobs {
+			counts[i] = refs[id]
+		}
+		rows, err := tx.Query(ctx, `
+			UPDATE file_blobs fb SET ref_count = fb.ref_count - d.n
+			FROM unnest($1::int[], $2::int[]) AS d(id, n)
+			WHERE fb.id = d.id
+			RETURNING fb.id, fb.ref_count
+		`, res.Blobs, counts)
+		if err != nil {
+			return res, err
+		}
+		for rows.Next() {
+			var id, refCount int
+			if err := rows.Scan(&id, &refCount); err != nil {
+				rows.Close()
+				return res, err
+			}
+			if refCount <= 0 {
+				res.Released = append(res.Released, blobs[id])
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return res, err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE system_stats
+			SET total_files = GREATEST(total_files - $1, 0),
+			    logical_storage = GREATEST(logical_storage - $2, 0)
+			WHERE snapshot_date = CURRENT_DATE
+		`, len(ids), logical)
+		if err != nil {
+			return res, err
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE user_stats
+			SET files_count = GREATEST(files_count - $1, 0),
+			    storage_used = GREATEST(storage_used - $2, 0),
+			    last_active = NOW()
+			WHERE user_id = $3
+		`, len(ids), logical, b.Owner.ID)
+		if err != nil {
+			return res, err
+		}
+	case b.Op == BulkDelete:
+		_, err = tx.Exec(ctx, `UPDATE user_files SET trashed_at = NOW() WHERE id = ANY($1)`, ids)
+	case b.Op == BulkRestore:
+		_, err = tx.Exec(ctx, `UPDATE user_files SET trashed_at = NULL WHERE id = ANY($1)`, ids)
+	case b.Op == BulkMove:
+		_, err = tx.Exec(ctx, `UPDATE user_files SET folder = $2 WHERE id = ANY($1)`, ids, b.Folder)
+	case b.Op == BulkTag:
+		// Empty slices, not nil: a NULL array would drop every tag
+		add, remove := append([]string{}, b.AddTags...), append([]string{}, b.RemoveTags...)
+		_, err = tx.Exec(ctx, `
+			UPDATE user_files
+			SET tags = ARRAY(
+				SELECT DISTINCT t FROM unnest(tags || $2::text[]) AS t
+				WHERE NOT t = ANY($3::text[])
+				ORDER BY t
+			)
+			WHERE id = ANY($1)
+		`, ids, add, remove)
+	case b.Op == BulkShare:
+		_, err = tx.Exec(ctx, `UPDATE user_files SET is_public = $2 WHERE id = ANY($1)`, ids, b.Public)
+	default:
+		return res, fmt.Errorf("unknown bulk operation %q", b.Op)
+	}
+	if err != nil {
+		return res, err
+	}
+	if event := bulkEvent(b); event != "" {
+		for _, id := range ids {
+			f := files[id]
+			data := FileEvent{
+				FileID:   id,
+				UserID:   b.Owner.ID,
+				Email:    b.Owner.Email,
+				FileName: f.name,
+				Size:     f.blob.Size,
+				Hash:     f.blob.Hash,
+				S3Key:    f.blob.S3Key,
+			}
+			if b.Op == BulkShare {
+				data.Public = &b.Public
+			}
+			if err := p.outbox(ctx, tx, event, b.Owner.ID, data); err != nil {
+				return res, fmt.Errorf("webhook outbox: %w", err)
+			}
+		}
+	}
+	res.Committed = true
+	return res, tx.Commit(ctx)
+}
+
+//
+// 🔹 Stats
+//
+func (p pgStats) UserStorage(ctx context.Context, userID int) (int64, int64, error) {
+	var logical, physical int64
+	err := p.db.QueryRow(ctx,
+		`SELECT storage_used, attributed_storage FROM user_stats WHERE user_id=$1`,
+		userID,
+	).Scan(&logical, &physical)
+	return logical, physical, notFound(err)
+}
+
+func (p pgStats) FileAdded(ctx context.Context, userID int, logical, physical int64) error {
+	// total_storage is physical, logical_storage counts every copy
+	_, err := p.db.Exec(ctx, `
+		UPDATE system_stats
+		SET total_files = total_files + 1,
+		    total_storage = total_storage + $1,
+		    logical_storage = logical_storage + $2,
+		    total_uploads = total_uploads + 1
+		WHERE snapshot_date = CURRENT_DATE
+	`, physical, logical)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.Exec(ctx, `
+		UPDATE user_stats
+		SET files_count = files_count + 1,
+		    storage_used = storage_used + $1,
+		    last_active = NOW()
+		WHERE user_id = $2
+	`, logical, userID)
+	return err
+}
+
+func (p pgStats) FileRemoved(ctx context.Context, userID int, logical, physical int64) error {
+	_, err := p.db.Exec(ctx, `
+		UPDATE system_stats
+		SET total_files = GREATEST(total_files - 1, 0),
+		    total_storage = GREATEST(total_storage - $1, 0),
+		    logical_storage = GREATEST(logical_storage - $2, 0)
+		WHERE snapshot_date = CURRENT_DATE
+	`, physical, logical)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.Exec(ctx, `
+		UPDATE user_stats
+		SET files_count = GREATEST(files_count - 1, 0),
+		    storage_used = GREATEST(storage_used - $1, 0),
+		    last_active = NOW()
+		WHERE user_id = $2
+	`, logical, userID)
+	return err
+}
+
+func (p pgStats) PhysicalFreed(ctx context.Context, bytes int64) error {
+	_, err := p.db.Exec(ctx, `
+		UPDATE system_stats
+		SET total_storage = GREATEST(total_storage - $1, 0)
+		WHERE snapshot_date = CURRENT_DATE
+	`, bytes)
+	return err
+}
+
+func (p pgStats) Downloaded(ctx context.Context) error {
+	_, err := p.db.Exec(ctx, `
+		UPDATE system_stats
+		SET total_downloads = total_downloads + 1
+		WHERE snapshot_date = CURRENT_DATE
+	`)
+	return err
+}
+
+func (p pgStats) RecordUsage(ctx context.Context, userID int, u Usage) error {
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO user_usage_monthly (user_id, month, uploads, downloads, upload_bytes, egress_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, month)
+		DO UPDATE SET
+			uploads = user_usage_monthly.uploads + EXCLUDED.uploads,
+			downloads = user_usage_monthly.downloads + EXCLUDED.downloads,
+			upload_bytes = user_usage_monthly.upload_bytes + EXCLUDED.upload_bytes,
+			egress_bytes = user_usage_monthly.egress_bytes + EXCLUDED.egress_bytes
+	`, userID, u.Month, u.Uploads, u.Downloads, u.UploadBytes, u.EgressBytes)
+	if err != nil {
+		return err
+	}
+
+	// Counters from a previous month start again from zero.
+	_, err = p.db.Exec(ctx, `
+		UPDATE user_stats
+		SET uploads_this_month = CASE WHEN stats_month = $2 THEN uploads_this_month ELSE 0 END + $3,
+		    downloads_this_month = CASE WHEN stats_month = $2 THEN downloads_this_month ELSE 0 END + $4,
+		    stats_month = $2,
+		    last_active = NOW()
+		WHERE user_id = $1
+	`, userID, u.Month, u.Uploads, u.Downloads)
+	return err
+}
+
+// SyncAttribution derives both figures from the user_storage_attribution
+// view (savings = logical bytes minus attributed physical bytes) rather
+// than accumulating them, so they stay correct whichever operation changed
+// ref_count. System savings are not stored: GetSystemStats derives them.
+func (p pgStats) SyncAttribution(ctx context.Context, blobID int, extraUserIDs ...int) error {
+	_, err := p.db.Exec(ctx, `
+		UPDATE user_stats us
+		SET deduplication_savings = COALESCE(a.dedup_savings, 0),
+		    attributed_storage = COALESCE(a.attributed_bytes, 0)
+		FROM user_stats us2
+		LEFT JOIN user_storage_attribution a ON a.user_id = us2.user_id
+		WHERE us2.user_id = us.user_id
+		  AND (us.user_id IN (SELECT user_id FROM user_files WHERE blob_id = $1)
+		       OR us.user_id = ANY($2))
+	`, blobID, extraUserIDs)
+	return err
+}
+
+//
+// 🔹 Reports
+//
+// Storage figures are derived from file_blobs and chunks rather than read
+// from the snapshot, so they are correct even on days without a snapshot
+// row.
+//
+func (p pgStats) System(ctx context.Context) (SystemReport, error) {
+	var r SystemReport
+	err := p.reader.QueryRow(ctx, `
+		SELECT total_users, total_files,
+		       total_uploads, total_downloads,
+		       b.logical, b.whole_physical + c.physical,
+		       b.chunked_blobs, b.chunked_bytes, c.physical
+		FROM system_stats,
+		     (SELECT COALESCE(SUM(size * ref_count), 0) AS logical,
+		             COALESCE(SUM(size) FILTER (WHERE storage_mode <> 'chunked'), 0) AS whole_physical,
+		             COUNT(*) FILTER (WHERE storage_mode = 'chunked') AS chunked_blobs,
+		             COALESCE(SUM(size) FILTER (WHERE storage_mode = 'chunked'), 0) AS chunked_bytes
+		      FROM file_blobs) b,
+		     (SELECT COALESCE(SUM(size), 0) AS physical FROM chunks) c
+		ORDER BY snapshot_date DESC
+		LIMIT 1
+	`).Scan(
+		&r.Users, &r.Files, &r.Uploads, &r.Downloads,
+		&r.Logical, &r.Physical,
+		&r.ChunkedBlobs, &r.ChunkLogical, &r.ChunkPhysical,
+	)
+	return r, notFound(err)
+}
+
+// userSortColumns maps UserQuery.Sort to its column.
+var userSortColumns = map[string]string{
+	SortByID:       "u.id",
+	SortByStorage:  "us.storage_used",
+	SortByFiles:    "us.files_count",
+	SortByActivity: "COALESCE(us.last_active, 'epoch'::timestamp)",
+}
+
+// userReportColumns are what scanUserReport reads; $monthArg is the usage
+// month.
+func userReportColumns(monthArg int) string {
+	return fmt.Sprintf(`
+		u.id, u.email,
+		us.files_count, us.storage_used, COALESCE(us.last_active, 'epoch'::timestamp),
+		CASE WHEN us.stats_month = $%[1]d THEN us.uploads_this_month ELSE 0 END,
+		CASE WHEN us.stats_month = $%[1]d THEN us.downloads_this_month ELSE 0 END,
+		us.deduplication_savings, us.attributed_storage`, monthArg)
+}
+
+func scanUserReport(row pgx.Row) (UserReport, error) {
+	var u UserReport
+	err := row.Scan(&u.ID, &u.Email, &u.Files, &u.Logical, &u.LastActive,
+		&u.UploadsThisMonth, &u.DownloadsThisMonth, &u.Savings, &u.Physical)
+	return u, err
+}
+
+func (p pgStats) Users(ctx context.Context, q UserQuery) ([]UserReport, int, error) {
+	sortExpr, ok := userSortColumns[q.Sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	order, cmp := "ASC", ">"
+	if q.Desc {
+		order, cmp = "DESC", "<"
+	}
+
+	args := []interface{}{}
+	where := []string{"TRUE"}
+	if q.Search != "" {
+		args = append(args, "%"+escapeLike(q.Search)+"%")
+		where = append(where, fmt.Sprintf("u.email ILIKE $%d", len(args)))
+	}
+	if q.InactiveDays >= 0 {
+		args = append(args, q.InactiveDays)
+		where = append(where, fmt.Sprintf(
+			"COALESCE(us.last_active, 'epoch'::timestamp) < NOW() - make_interval(days => $%d)", len(args)))
+	}
+
+	// Filters apply to the total; the cursor only narrows the page.
+	var total int
+	err := p.reader.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM users u
+		JOIN user_stats us ON u.id = us.user_id
+		WHERE `+strings.Join(where, " AND "), args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if q.After != nil {
+		args = append(args, q.After.Value, q.After.ID)
+		where = append(where, fmt.Sprintf("(%s, u.id) %s ($%d, $%d)", sortExpr, cmp, len(args)-1, len(args)))
+	}
+	args = append(args, q.Month, q.Limit)
+	rows, err := p.reader.Query(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM users u
+		JOIN user_stats us ON u.id = us.user_id
+		WHERE %s
+		ORDER BY %s %s, u.id %s
+		LIMIT $%d
+	`, userReportColumns(len(args)-1), strings.Join(where, " AND "), sortExpr, order, order, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	page, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (UserReport, error) {
+		return scanUserReport(row)
+	})
+	return page, total, err
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (p pgStats) User(ctx context.Context, email string, month time.Time) (UserReport, error) {
+	u, err := scanUserReport(p.reader.QueryRow(ctx, `
+		SELECT `+userReportColumns(1)+`
+		FROM users u
+		JOIN user_stats us ON u.id = us.user_id
+		WHERE u.email = $2
+	`, month, email))
+	return u, notFound(err)
+}
+
+func (p pgStats) UsageHistory(ctx context.Context, email string, first, last time.Time) ([]Usage, error) {
+	var userID int
+	err := p.reader.QueryRow(ctx, `SELECT id FROM users WHERE email=$1`, email).Scan(&userID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	rows, err := p.reader.Query(ctx, `
+		SELECT month, uploads, downloads, upload_bytes, egress_bytes
+		FROM user_usage_monthly
+		WHERE user_id = $1 AND month >= $2 AND month <= $3
+		ORDER BY month ASC
+	`, userID, first, last)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Usage, error) {
+		var u Usage
+		err := row.Scan(&u.Month, &u.Uploads, &u.Downloads, &u.UploadBytes, &u.EgressBytes)
+		return u, err
+	})
+}
+
+func (p pgStats) FileDetails(ctx context.Context, email string) ([]FileDetail, error) {
+	rows, err := p.reader.Query(ctx, `
+		SELECT uf.id, uf.filename, fb.size, fb.hash, uf.uploaded_at, u.email, fb.ref_count
+		FROM user_files uf
+		JOIN file_blobs fb ON uf.blob_id = fb.id
+		JOIN users u ON uf.user_id = u.id
+		WHERE u.email = $1 AND uf.trashed_at IS NULL
+		ORDER BY uf.uploaded_at DESC
+	`, email)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (FileDetail, error) {
+		var f FileDetail
+		err := row.Scan(&f.FileID, &f.FileName, &f.Size, &f.Hash, &f.UploadedAt, &f.Email, &f.RefCount)
+		return f, err
+	})
+}
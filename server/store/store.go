@@ -0,0 +1,404 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"server/jobs"
+)
+
+//
+// 🔹 Data access for users, files, blobs and storage accounting
+//
+// Handlers depend on these interfaces rather than on a database, so the
+// dedup, chunking and accounting logic and the admin reports run unchanged
+// against Postgres (NewPostgres) or in memory (NewMemory). Scans,
+// thumbnails, search, webhooks and the job queue still query Postgres
+// directly.
+//
+
+// ErrNotFound is returned by lookups that match nothing.
+var ErrNotFound = errors.New("not found")
+
+// Reasons a bulk operation skips a file.
+var (
+	ErrTrashed    = errors.New("file is in the trash")
+	ErrNotTrashed = errors.New("file is not in the trash")
+)
+
+// Webhook event types written by Link, Unlink and Bulk.
+const (
+	EventFileUploaded = "file.uploaded"
+	EventFileDeleted  = "file.deleted"
+	EventFileTrashed  = "file.trashed"
+	EventFileRestored = "file.restored"
+	EventFileShared   = "file.shared" // made public or private again
+)
+
+// file_blobs.storage_mode values
+const (
+	StorageModeFile    = "file"    // whole object at s3_key
+	StorageModeChunked = "chunked" // content in chunks, manifest at s3_key
+)
+
+// Store bundles the repositories a Handlers needs.
+type Store struct {
+	Users  Users
+	Files  Files
+	Blobs  Blobs
+	Chunks Chunks
+	Stats  Stats
+}
+
+// User is a users row.
+type User struct {
+	ID    int
+	Email string
+	Plan  string
+}
+
+// Blob is a file_blobs row: one stored copy of some content.
+type Blob struct {
+	ID               int
+	Hash             string
+	S3Key            string
+	Size             int64
+	MimeType         string
+	ClaimedMimeType  string
+	DetectedMimeType string
+	CreatedAt        time.Time
+	RefCount         int
+	StorageMode      string
+	ScanStatus       string
+	ThumbnailStatus  string
+}
+
+// Chunk is one piece of a chunked blob, stored at ChunkKey(Hash).
+type Chunk struct {
+	Hash   string
+	Offset int64 // within the blob
+	Size   int64
+}
+
+// ChunkKey is where a chunk's content is stored. Keys are deterministic,
+// so concurrent uploads of the same chunk write the same object.
+func ChunkKey(hash string) string {
+	return "chunks/" + hash
+}
+
+// File is a user's reference to a blob, as listed to them.
+type File struct {
+	ID         int
+	UserID     int
+	FileName   string
+	UploadedAt time.Time
+	Folder     string
+	Tags       []string
+	Public     bool
+	TrashedAt  *time.Time // nil unless in the trash
+	Blob       Blob
+}
+
+// FileRef identifies one reference to drop or serve. FileID and UserID are
+// 0 for a blob nobody references any more.
+type FileRef struct {
+	FileID   int
+	UserID   int
+	Email    string
+	FileName string
+	Blob     Blob
+}
+
+// Link is an upload to record. With NewBlob the blob row is inserted from
+// Blob; with Duplicate the existing Blob.ID gains a reference; otherwise
+// Blob.ID was already inserted (chunked uploads) and is only linked.
+type Link struct {
+	UserID    int
+	Email     string
+	FileName  string
+	Blob      Blob
+	NewBlob   bool
+	Duplicate bool
+	// Chunks is the chunk list of a new chunked blob, recorded with it.
+	Chunks []Chunk
+}
+
+// Linked is the outcome of Link.
+type Linked struct {
+	FileID int
+	BlobID int
+	// NewChunkBytes are the bytes of the new blob's chunks that nothing
+	// referenced before.
+	NewChunkBytes int64
+}
+
+// Bulk operations on a user's files
+const (
+	BulkDelete  = "delete"  // to the trash, or for good with Permanent
+	BulkRestore = "restore" // out of the trash
+	BulkMove    = "move"    // into Folder
+	BulkTag     = "tag"     // add AddTags, then drop RemoveTags
+	BulkShare   = "share"   // set is_public to Public
+)
+
+// Bulk is one operation over many of Owner's files (user_files ids).
+type Bulk struct {
+	Op         string
+	Owner      User
+	FileIDs    []int
+	Atomic     bool // all or nothing; otherwise each file succeeds or fails alone
+	Permanent  bool
+	Folder     string
+	AddTags    []string
+	RemoveTags []string
+	Public     bool
+}
+
+// BulkResult reports every file of a Bulk, in request order.
+type BulkResult struct {
+	Items []BulkItem
+	// Committed is false when an atomic operation changed nothing because
+	// some file failed.
+	Committed bool
+	// Released lists blobs whose last reference was permanently deleted.
+	// Their rows and content are left for the caller to remove, as after
+	// Unlink.
+	Released []Blob
+	// Blobs lists every blob that lost a reference, for SyncAttribution.
+	Blobs []int
+}
+
+// BulkItem is one file's outcome: Err is nil, ErrNotFound (no such file of
+// the owner's), ErrTrashed or ErrNotTrashed.
+type BulkItem struct {
+	FileID int
+	Err    error
+}
+
+// bulkCheck decides whether b can apply to a file in the given state.
+func bulkCheck(b Bulk, exists, trashed bool) error {
+	switch {
+	case !exists:
+		return ErrNotFound
+	case b.Op == BulkRestore && !trashed:
+		return ErrNotTrashed
+	case b.Op == BulkDelete && b.Permanent, b.Op == BulkRestore:
+		return nil
+	case trashed:
+		return ErrTrashed
+	}
+	return nil
+}
+
+// bulkEvent is the event written for each file a Bulk applies to, if any.
+// Permanent deletes write EventFileDeleted along with their accounting.
+func bulkEvent(b Bulk) string {
+	switch {
+	case b.Op == BulkDelete && !b.Permanent:
+		return EventFileTrashed
+	case b.Op == BulkRestore:
+		return EventFileRestored
+	case b.Op == BulkShare:
+		return EventFileShared
+	}
+	return ""
+}
+
+// FileEvent is the data of file.* webhook events.
+type FileEvent struct {
+	FileID    int    `json:"fileId"`
+	UserID    int    `json:"userId"`
+	Email     string `json:"email"`
+	FileName  string `json:"fileName"`
+	Size      int64  `json:"size"`
+	MimeType  string `json:"mimeType,omitempty"`
+	Hash      string `json:"hash"`
+	S3Key     string `json:"s3Key"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Signature string `json:"signature,omitempty"` // file.quarantined
+	Public    *bool  `json:"public,omitempty"`    // file.shared
+}
+
+// UserReport is a user's row in the admin reports. The monthly counters
+// are for the month the report was asked for, zero if the user has no
+// activity in it.
+type UserReport struct {
+	ID                 int
+	Email              string
+	Files              int
+	Logical            int64
+	Physical           int64 // attributed share
+	Savings            int64
+	LastActive         time.Time // the Unix epoch if never active
+	UploadsThisMonth   int
+	DownloadsThisMonth int
+}
+
+// Sort keys for UserQuery
+const (
+	SortByID       = "id"
+	SortByStorage  = "storage"  // logical bytes
+	SortByFiles    = "files"    // file count
+	SortByActivity = "activity" // last activity, never-active users first
+)
+
+// UserQuery selects a page of UserReports. The order is made total by
+// breaking ties on the user id.
+type UserQuery struct {
+	Search       string // case-insensitive email substring
+	InactiveDays int    // only users inactive for this many days; -1 for all
+	Sort         string
+	Desc         bool
+	// After continues from a previous page: the sort value (int for id and
+	// files, int64 for storage, time.Time for activity) and id of the last
+	// user on it.
+	After *UserCursor
+	Limit int
+	Month time.Time // usage month for the monthly counters
+}
+
+// UserCursor is the position of a user in a UserQuery order.
+type UserCursor struct {
+	Value interface{}
+	ID    int
+}
+
+// SystemReport holds the system-wide figures behind GET
+// /admin/system-stats. Storage figures are derived from the blobs and
+// chunks themselves.
+type SystemReport struct {
+	Users     int
+	Files     int
+	Uploads   int
+	Downloads int
+	Logical   int64 // every reference
+	Physical  int64 // whole blobs plus distinct chunks
+	// Chunk-level deduplication: bytes of chunked blobs and of the
+	// distinct chunks that store them.
+	ChunkedBlobs  int
+	ChunkLogical  int64
+	ChunkPhysical int64
+}
+
+// FileDetail is one of a user's files in the admin file report.
+type FileDetail struct {
+	FileID     int
+	FileName   string
+	Size       int64
+	Hash       string
+	UploadedAt time.Time
+	Email      string
+	RefCount   int
+}
+
+// Usage is one increment to a user's usage for Month (the first day of a
+// usage month).
+type Usage struct {
+	Month       time.Time
+	Uploads     int
+	Downloads   int
+	UploadBytes int64
+	EgressBytes int64
+}
+
+// Outbox writes a webhook event inside q, the transaction of the change it
+// describes.
+type Outbox func(ctx context.Context, q jobs.Querier, eventType string, userID int, data interface{}) error
+
+type Users interface {
+	// Ensure returns the user with email, creating it (and its user_stats
+	// row) on first use.
+	Ensure(ctx context.Context, email string) (User, error)
+}
+
+type Blobs interface {
+	ByID(ctx context.Context, id int) (Blob, error)
+	ByKey(ctx context.Context, key string) (Blob, error)
+	ByHash(ctx context.Context, hash string) (Blob, error)
+	Delete(ctx context.Context, id int) error
+	// DeleteOrphan deletes an unreferenced blob's row and releases its
+	// chunks, after checking under the row lock that it is still
+	// unreferenced: an upload linking to it meanwhile keeps it (ok=false).
+	// It returns the physical bytes freed; the object at S3Key may be
+	// deleted once ok.
+	DeleteOrphan(ctx context.Context, b Blob) (physical int64, ok bool, err error)
+}
+
+// Chunks keeps the chunk lists of chunked blobs (DEDUP_MODE=chunk) and the
+// reference counts of their chunks. Chunk content is in Objects; a chunked
+// blob and its chunk list are recorded by Files.Link.
+type Chunks interface {
+	// Claim holds off purge.chunks from the unreferenced chunks among
+	// hashes, so they survive until the upload reusing them links its blob
+	// (see Link.Chunks), and returns the hashes whose objects are known to
+	// be stored.
+	Claim(ctx context.Context, hashes []string) (map[string]bool, error)
+	// Overlapping returns blobID's chunks that overlap bytes [start, end],
+	// in order.
+	Overlapping(ctx context.Context, blobID int, start, end int64) ([]Chunk, error)
+	// Release drops blobID's chunk references. Chunks left unreferenced
+	// stay until purge.chunks removes them; their bytes are returned.
+	Release(ctx context.Context, blobID int) (int64, error)
+}
+
+type Files interface {
+	// Link records an upload and its file.uploaded event atomically.
+	Link(ctx context.Context, l Link) (Linked, error)
+	// Unlink drops a reference and decrements the blob's ref_count
+	// atomically, returning the remaining count. With ref.FileID 0 only the
+	// count is decremented and no event is written.
+	Unlink(ctx context.Context, ref FileRef) (int, error)
+	// List returns a user's files outside the trash, newest first. It may
+	// read from a replica.
+	List(ctx context.Context, email string) ([]File, error)
+	// Trash returns a user's trashed files, most recently trashed first.
+	Trash(ctx context.Context, email string) ([]File, error)
+	// Holder returns the newest reference to blobID outside the trash,
+	// restricted to email when it is not empty.
+	Holder(ctx context.Context, blobID int, email string) (FileRef, error)
+	// ByKey returns the newest reference to the blob stored at key outside
+	// the trash, restricted to email when it is not empty. A blob with no
+	// references left, trashed or not, is returned with FileID 0 when email
+	// is empty.
+	ByKey(ctx context.Context, key, email string) (FileRef, error)
+	// Bulk applies b in one transaction. Files that fail are reported in
+	// the result, not as an error. Permanent deletes write file.deleted
+	// events and update ref_count, user_stats and system_stats once per
+	// blob and user rather than once per file; physical bytes are left to
+	// the caller (Stats.PhysicalFreed) since chunked blobs free an amount
+	// only known once their chunks are released.
+	Bulk(ctx context.Context, b Bulk) (BulkResult, error)
+}
+
+// Stats keeps user_stats, system_stats and the usage ledger in step with
+// file changes. Logical bytes count every reference; physical bytes count
+// what is actually stored.
+type Stats interface {
+	// UserStorage returns a user's logical and attributed physical bytes.
+	UserStorage(ctx context.Context, userID int) (logical, physical int64, err error)
+	FileAdded(ctx context.Context, userID int, logical, physical int64) error
+	FileRemoved(ctx context.Context, userID int, logical, physical int64) error
+	// PhysicalFreed accounts for stored bytes released outside a delete
+	// (orphan purges).
+	PhysicalFreed(ctx context.Context, bytes int64) error
+	Downloaded(ctx context.Context) error
+	RecordUsage(ctx context.Context, userID int, u Usage) error
+	// SyncAttribution re-derives attributed storage and dedup savings for
+	// every holder of blobID, plus extraUserIDs (users who just dropped
+	// their last reference to it).
+	SyncAttribution(ctx context.Context, blobID int, extraUserIDs ...int) error
+
+	// The admin reports. They may read from a replica.
+	System(ctx context.Context) (SystemReport, error)
+	// Users returns a page of q and the number of users matching its
+	// filters, ignoring After and Limit.
+	Users(ctx context.Context, q UserQuery) (page []UserReport, total int, err error)
+	User(ctx context.Context, email string, month time.Time) (UserReport, error)
+	// UsageHistory returns the ledger of the user with email for the months
+	// from first to last, oldest first. Months without activity are
+	// missing. ErrNotFound means no such user.
+	UsageHistory(ctx context.Context, email string, first, last time.Time) ([]Usage, error)
+	// FileDetails lists the user's files outside the trash, newest first.
+	FileDetails(ctx context.Context, email string) ([]FileDetail, error)
+}
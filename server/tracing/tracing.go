@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer creates SkyVault's own spans. It delegates to whatever provider
+// Init installs, so it is safe to use before (or without) Init.
+var Tracer = otel.Tracer("server")
+
+var provider *sdktrace.TracerProvider
+
+//
+// 🔹 Init: install the tracer provider and W3C trace-context propagation
+//
+// OTEL_TRACES_EXPORTER picks the exporter: otlp (OTLP over HTTP, configured
+// with the standard OTEL_EXPORTER_OTLP_* variables), stdout (pretty-printed
+// spans, for local use) or none. It defaults to otlp when
+// OTEL_EXPORTER_OTLP_ENDPOINT is set and none otherwise. OTEL_SERVICE_NAME
+// overrides service, and OTEL_TRACES_SAMPLER is honoured by the SDK.
+//
+func Init(ctx context.Context, service string) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	kind := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER"))
+	if kind == "" && (os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "") {
+		kind = "otlp"
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch kind {
+	case "", "none":
+		return nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout", "console":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q (want otlp, stdout or none)", kind)
+	}
+	if err != nil {
+		return fmt.Errorf("create %s exporter: %w", kind, err)
+	}
+
+	// Later options win, so OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+	// override the defaults.
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(service)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return fmt.Errorf("build resource: %w", err)
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	slog.Info("tracing enabled", "exporter", kind, "service", service)
+	return nil
+}
+
+// Flush exports buffered spans. Lambda freezes the process between
+// invocations, so the handler flushes before returning.
+func Flush(ctx context.Context) {
+	if provider == nil {
+		return
+	}
+	if err := provider.ForceFlush(ctx); err != nil {
+		slog.Warn("span flush failed", "error", err)
+	}
+}
+
+// Shutdown flushes and stops the exporter.
+func Shutdown(ctx context.Context) {
+	if provider == nil {
+		return
+	}
+	if err := provider.Shutdown(ctx); err != nil {
+		slog.Warn("tracing shutdown failed", "error", err)
+	}
+}
+
+// End records err (if any) on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+//
+// 🔹 HTTP: one server span per request, continuing the caller's trace
+//
+// Handler wraps the whole stack so CORS and routing are inside the span;
+// Middleware (a mux middleware) then names the span after the matched
+// route template.
+//
+func Handler(h http.Handler) http.Handler {
+	return otelhttp.NewHandler(h, "http.request",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
+
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + tpl)
+				span.SetAttributes(semconv.HTTPRoute(tpl))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,112 @@
+package utils
+
+import "io"
+
+// Content-defined chunking (FastCDC with normalized chunking).
+//
+// Boundaries are chosen from a rolling gear hash over the content itself, so
+// an insertion or edit only changes the chunks around it and every other
+// chunk keeps its hash and deduplicates against earlier uploads.
+
+const (
+	ChunkMinSize = 16 << 10  // 16 KiB
+	ChunkAvgSize = 64 << 10  // 64 KiB
+	ChunkMaxSize = 256 << 10 // 256 KiB
+)
+
+// Cut-point masks test the high bits of the gear hash, which depend on the
+// last 64 bytes. Below the average size a boundary needs 2 extra zero bits
+// (harder), above it 2 fewer (easier), pulling sizes toward ChunkAvgSize.
+const (
+	chunkMaskHard = uint64(1<<18-1) << (64 - 18)
+	chunkMaskEasy = uint64(1<<14-1) << (64 - 14)
+)
+
+// gear maps each byte to a pseudo-random 64-bit value. It is generated from
+// a fixed seed because changing it would change every chunk boundary.
+var gear [256]uint64
+
+func init() {
+	seed := uint64(0x5eed5b1a17c0ffee)
+	for i := range gear {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunk splits data into content-defined chunks. The returned slices share
+// data's backing array.
+func Chunk(data []byte) [][]byte {
+	var chunks [][]byte
+	for len(data) > 0 {
+		n := nextCut(data)
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return chunks
+}
+
+// ChunkReader splits r into the same chunks as Chunk, calling fn with each
+// in order. Only ChunkMaxSize bytes are held at a time; the slice passed to
+// fn is only valid until it returns.
+func ChunkReader(r io.Reader, fn func(chunk []byte) error) error {
+	buf := make([]byte, ChunkMaxSize)
+	filled := 0
+	eof := false
+	for {
+		if !eof && filled < len(buf) {
+			n, err := io.ReadFull(r, buf[filled:])
+			filled += n
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if filled == 0 {
+			return nil
+		}
+		// A cut only looks at the first ChunkMaxSize bytes, so a full
+		// buffer decides it as the whole content would
+		n := nextCut(buf[:filled])
+		if err := fn(buf[:n]); err != nil {
+			return err
+		}
+		filled = copy(buf, buf[n:filled])
+	}
+}
+
+// nextCut returns the length of the first chunk of data.
+func nextCut(data []byte) int {
+	n := len(data)
+	if n <= ChunkMinSize {
+		return n
+	}
+	if n > ChunkMaxSize {
+		n = ChunkMaxSize
+	}
+	normal := ChunkAvgSize
+	if n < normal {
+		normal = n
+	}
+
+	var fp uint64
+	i := ChunkMinSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&chunkMaskHard == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&chunkMaskEasy == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
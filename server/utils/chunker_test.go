@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+func randomBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func TestChunkReassembles(t *testing.T) {
+	for _, n := range []int{0, 1, ChunkMinSize, ChunkMinSize + 1, ChunkMaxSize, 3*ChunkMaxSize + 17, 4 << 20} {
+		data := randomBytes(int64(n), n)
+		if got := bytes.Join(Chunk(data), nil); !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: reassembled %d bytes that differ from the input", n, len(got))
+		}
+	}
+}
+
+func TestChunkReaderMatchesChunk(t *testing.T) {
+	for _, n := range []int{0, 1, ChunkMinSize, ChunkMaxSize, ChunkMaxSize + 1, 3*ChunkMaxSize + 17, 4 << 20} {
+		data := randomBytes(int64(n), n)
+		want := Chunk(data)
+		var got [][]byte
+		// Short reads must not move any boundary
+		err := ChunkReader(iotest.HalfReader(bytes.NewReader(data)), func(c []byte) error {
+			got = append(got, append([]byte(nil), c...))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%d bytes: %d chunks, want %d", n, len(got), len(want))
+		}
+		for i := range want {
+			if !bytes.Equal(got[i], want[i]) {
+				t.Errorf("%d bytes: chunk %d differs", n, i)
+			}
+		}
+	}
+}
+
+func TestChunkSizeBounds(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"random": randomBytes(1, 8<<20),
+		// A constant run never matches a mask, so every cut is forced at the max
+		"zeros": make([]byte, 2<<20),
+	} {
+		chunks := Chunk(data)
+		for i, c := range chunks {
+			last := i == len(chunks)-1
+			if len(c) > ChunkMaxSize || (!last && len(c) < ChunkMinSize) || len(c) == 0 {
+				t.Errorf("%s: chunk %d of %d has %d bytes", name, i, len(chunks), len(c))
+			}
+		}
+		if name == "random" {
+			avg := len(data) / len(chunks)
+			if avg < ChunkAvgSize/2 || avg > ChunkAvgSize*2 {
+				t.Errorf("random: average chunk %d bytes, want near %d", avg, ChunkAvgSize)
+			}
+		}
+	}
+}
+
+func TestChunkBoundariesSurviveInsertion(t *testing.T) {
+	data := randomBytes(2, 4<<20)
+	edited := append(append(append([]byte(nil), data[:1<<20]...), "inserted bytes"...), data[1<<20:]...)
+
+	hashes := func(b []byte) map[[32]byte]bool {
+		m := map[[32]byte]bool{}
+		for _, c := range Chunk(b) {
+			m[sha256.Sum256(c)] = true
+		}
+		return m
+	}
+	before, after := hashes(data), hashes(edited)
+	changed := 0
+	for h := range after {
+		if !before[h] {
+			changed++
+		}
+	}
+	// Only the chunk holding the insertion (and at most its neighbour when
+	// the edit moves a cut point) should differ.
+	if changed > 2 {
+		t.Errorf("%d of %d chunks changed after a 14-byte insertion", changed, len(after))
+	}
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// textExtractors are the media types ExtractText understands.
+var textExtractors = map[string]func(data []byte, limit int) (string, error){
+	"text/plain":       plainText,
+	"text/markdown":    plainText,
+	"text/x-markdown":  plainText,
+	"text/csv":         plainText,
+	"application/json": jsonText,
+	"application/pdf":  ExtractPDFText,
+}
+
+// CanExtractText reports whether ExtractText supports mediaType.
+func CanExtractText(mediaType string) bool {
+	_, ok := textExtractors[mediaType]
+	return ok
+}
+
+// ExtractText returns the searchable text of a document of the given bare
+// media type, truncated to at most limit bytes of valid UTF-8 without NULs
+// (which Postgres text cannot hold).
+func ExtractText(data []byte, mediaType string, limit int) (string, error) {
+	extract, ok := textExtractors[mediaType]
+	if !ok {
+		return "", nil
+	}
+	text, err := extract(data, limit)
+	if err != nil {
+		return "", err
+	}
+	text = strings.ReplaceAll(strings.ToValidUTF8(text, ""), "\x00", "")
+	return truncateUTF8(text, limit), nil
+}
+
+func plainText(data []byte, limit int) (string, error) {
+	if len(data) > limit {
+		data = data[:limit]
+	}
+	return string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))), nil
+}
+
+// jsonText keeps keys and scalar values, dropping the punctuation. Invalid
+// JSON is indexed as plain text.
+func jsonText(data []byte, limit int) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var sb strings.Builder
+	for sb.Len() < limit {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return plainText(data, limit)
+		}
+		switch v := tok.(type) {
+		case string:
+			sb.WriteString(v)
+			sb.WriteByte('\n')
+		case json.Number:
+			sb.WriteString(v.String())
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String(), nil
+}
+
+func truncateUTF8(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
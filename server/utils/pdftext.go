@@ -0,0 +1,976 @@
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrEncryptedPDF is returned for PDFs whose content needs a password.
+var ErrEncryptedPDF = errors.New("pdf is encrypted")
+
+// maxPDFStream bounds one decompressed stream so a small deflate bomb cannot
+// exhaust memory.
+const maxPDFStream = 64 << 20
+
+// maxPDFNesting bounds how deeply arrays and dictionaries may nest. Real
+// documents stay in single digits; deeper input is hostile and would
+// otherwise overflow the goroutine stack, which cannot be recovered.
+const maxPDFNesting = 64
+
+var errPDFNesting = errors.New("pdf objects nested too deeply")
+
+// ExtractPDFText returns the text layer of a PDF, page by page, stopping
+// once limit bytes have been collected. It understands enough of the format
+// for text search: plain and compressed object streams, FlateDecode, page
+// tree walking with inherited resources, form XObjects, and ToUnicode CMaps
+// (which modern generators use for every embedded font). Scanned PDFs
+// without a text layer yield "".
+func ExtractPDFText(data []byte, limit int) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return "", errors.New("not a pdf")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", ErrEncryptedPDF
+	}
+
+	doc := &pdfDoc{objects: map[int]*pdfObject{}, cmaps: map[int]*toUnicode{}}
+	doc.load(data)
+
+	ex := &pdfExtractor{doc: doc, limit: limit}
+	for _, page := range doc.pages() {
+		if ex.full() {
+			break
+		}
+		ex.runContent(doc.contents(page.dict), page.resources, 0)
+		ex.newline()
+	}
+
+	// Drop the blank lines left by positioning-only text objects.
+	var lines []string
+	for _, line := range strings.Split(ex.out.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+//
+// 🔹 Objects
+//
+
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfString  []byte
+	pdfArray   []interface{}
+	pdfDict    map[pdfName]interface{}
+	pdfRef     struct{ num, gen int }
+)
+
+type pdfObject struct {
+	value  interface{}
+	stream []byte // raw (still encoded) stream data, nil if none
+}
+
+type pdfDoc struct {
+	objects map[int]*pdfObject
+	cmaps   map[int]*toUnicode // by ToUnicode object number
+}
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// load indexes every "N G obj" in file order, so objects redefined by an
+// incremental update win, then unpacks compressed object streams.
+func (d *pdfDoc) load(data []byte) {
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		lx := &pdfLexer{data: data, pos: m[1]}
+		v, err := lx.value()
+		if err != nil {
+			continue
+		}
+		obj := &pdfObject{value: v}
+		if dict, ok := v.(pdfDict); ok {
+			save := lx.pos
+			if tok, err := lx.token(); err == nil && tok == pdfKeyword("stream") {
+				obj.stream = streamBody(data, lx.pos, dict)
+			} else {
+				lx.pos = save
+			}
+		}
+		d.objects[num] = obj
+	}
+
+	var objStms []*pdfObject
+	for _, obj := range d.objects {
+		if dict, ok := obj.value.(pdfDict); ok && dict["Type"] == pdfName("ObjStm") {
+			objStms = append(objStms, obj)
+		}
+	}
+	for _, obj := range objStms {
+		d.loadObjStm(obj)
+	}
+}
+
+// streamBody locates the bytes between "stream" and "endstream".
+func streamBody(data []byte, pos int, dict pdfDict) []byte {
+	if pos < len(data) && data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(data) && data[pos] == '\n' {
+		pos++
+	}
+	if n, ok := dict["Length"].(float64); ok {
+		end := pos + int(n)
+		if end <= len(data) && bytes.HasPrefix(bytes.TrimLeft(data[end:], " \r\n"), []byte("endstream")) {
+			return data[pos:end]
+		}
+	}
+	end := bytes.Index(data[pos:], []byte("endstream"))
+	if end < 0 {
+		return nil
+	}
+	return bytes.TrimRight(data[pos:pos+end], "\r\n")
+}
+
+func (d *pdfDoc) loadObjStm(obj *pdfObject) {
+	dict := obj.value.(pdfDict)
+	body, err := d.decodeStream(obj)
+	if err != nil {
+		return
+	}
+	n, _ := d.resolve(dict["N"]).(float64)
+	first, _ := d.resolve(dict["First"]).(float64)
+	if int(first) > len(body) {
+		return
+	}
+
+	header := &pdfLexer{data: body[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		numTok, err1 := header.token()
+		offTok, err2 := header.token()
+		num, ok1 := numTok.(float64)
+		off, ok2 := offTok.(float64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			return
+		}
+		if _, exists := d.objects[int(num)]; exists {
+			continue
+		}
+		lx := &pdfLexer{data: body, pos: int(first) + int(off)}
+		if v, err := lx.value(); err == nil {
+			d.objects[int(num)] = &pdfObject{value: v}
+		}
+	}
+}
+
+// resolve follows indirect references.
+func (d *pdfDoc) resolve(v interface{}) interface{} {
+	for i := 0; i < 16; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		obj, ok := d.objects[ref.num]
+		if !ok {
+			return nil
+		}
+		v = obj.value
+	}
+	return nil
+}
+
+func (d *pdfDoc) dict(v interface{}) pdfDict {
+	dict, _ := d.resolve(v).(pdfDict)
+	return dict
+}
+
+// streamOf returns the decoded stream v refers to, or nil.
+func (d *pdfDoc) streamOf(v interface{}) []byte {
+	ref, ok := v.(pdfRef)
+	if !ok {
+		return nil
+	}
+	obj, ok := d.objects[ref.num]
+	if !ok || obj.stream == nil {
+		return nil
+	}
+	body, err := d.decodeStream(obj)
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+func (d *pdfDoc) decodeStream(obj *pdfObject) ([]byte, error) {
+	dict, _ := obj.value.(pdfDict)
+	var filters []interface{}
+	switch f := d.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []interface{}{f}
+	case pdfArray:
+		filters = f
+	}
+
+	body := obj.stream
+	for _, f := range filters {
+		switch d.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			out, err := inflate(body)
+			if err != nil {
+				return nil, err
+			}
+			body = out
+		default:
+			return nil, errors.New("unsupported stream filter")
+		}
+	}
+	return body, nil
+}
+
+// inflate decodes zlib data, falling back to raw deflate, and keeps what it
+// could read from a truncated stream.
+func inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxPDFStream))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+//
+// 🔹 Page tree
+//
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages walks the page tree from the catalog. Documents with a damaged
+// tree fall back to every /Type /Page object in object-number order.
+func (d *pdfDoc) pages() []pdfPage {
+	var pages []pdfPage
+	seen := map[int]bool{}
+
+	var walk func(node interface{}, inherited pdfDict, depth int)
+	walk = func(node interface{}, inherited pdfDict, depth int) {
+		if depth > 64 {
+			return
+		}
+		if ref, ok := node.(pdfRef); ok {
+			if seen[ref.num] {
+				return
+			}
+			seen[ref.num] = true
+		}
+		dict := d.dict(node)
+		if dict == nil {
+			return
+		}
+		res := inherited
+		if r := d.dict(dict["Resources"]); r != nil {
+			res = r
+		}
+		if kids, ok := d.resolve(dict["Kids"]).(pdfArray); ok {
+			for _, kid := range kids {
+				walk(kid, res, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: dict, resources: res})
+	}
+
+	for _, num := range d.sortedObjects() {
+		if dict, ok := d.objects[num].value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			walk(dict["Pages"], nil, 0)
+			break
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	for _, num := range d.sortedObjects() {
+		if dict, ok := d.objects[num].value.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			pages = append(pages, pdfPage{dict: dict, resources: d.dict(dict["Resources"])})
+		}
+	}
+	return pages
+}
+
+func (d *pdfDoc) sortedObjects() []int {
+	nums := make([]int, 0, len(d.objects))
+	for n := range d.objects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// contents concatenates a page's content streams.
+func (d *pdfDoc) contents(page pdfDict) []byte {
+	switch c := page["Contents"].(type) {
+	case pdfRef:
+		if arr, ok := d.resolve(c).(pdfArray); ok {
+			return d.joinStreams(arr)
+		}
+		return d.streamOf(c)
+	case pdfArray:
+		return d.joinStreams(c)
+	}
+	return nil
+}
+
+func (d *pdfDoc) joinStreams(refs pdfArray) []byte {
+	var buf bytes.Buffer
+	for _, ref := range refs {
+		buf.Write(d.streamOf(ref))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+//
+// 🔹 Fonts
+//
+
+// pdfFont is what text decoding needs from a font resource.
+type pdfFont struct {
+	cmap      *toUnicode
+	composite bool // Type0: multi-byte codes, meaningless without a cmap
+}
+
+func (d *pdfDoc) font(v interface{}) *pdfFont {
+	dict := d.dict(v)
+	if dict == nil {
+		return nil
+	}
+	f := &pdfFont{composite: dict["Subtype"] == pdfName("Type0")}
+	if ref, ok := dict["ToUnicode"].(pdfRef); ok {
+		cm, cached := d.cmaps[ref.num]
+		if !cached {
+			if body := d.streamOf(ref); body != nil {
+				cm = parseToUnicode(body)
+			}
+			d.cmaps[ref.num] = cm
+		}
+		f.cmap = cm
+	}
+	return f
+}
+
+type cmapRange struct {
+	lo, hi uint32
+	dst    []byte   // UTF-16BE of lo; later codes increment the last unit
+	dsts   []string // explicit per-code strings, when given as an array
+}
+
+// toUnicode maps character codes to text.
+type toUnicode struct {
+	codeLen int
+	single  map[uint32]string
+	ranges  []cmapRange
+}
+
+func parseToUnicode(body []byte) *toUnicode {
+	cm := &toUnicode{single: map[uint32]string{}}
+	lx := &pdfLexer{data: body}
+	for {
+		tok, err := lx.token()
+		if err != nil {
+			break
+		}
+		switch tok {
+		case pdfKeyword("begincodespacerange"):
+			if lo, err := lx.value(); err == nil {
+				if s, ok := lo.(pdfString); ok && cm.codeLen == 0 {
+					cm.codeLen = len(s)
+				}
+			}
+		case pdfKeyword("beginbfchar"):
+			for {
+				src, err := lx.value()
+				s, ok := src.(pdfString)
+				if err != nil || !ok {
+					break
+				}
+				dst, _ := lx.value()
+				if ds, ok := dst.(pdfString); ok {
+					cm.single[codeOf(s)] = utf16String(ds)
+				}
+			}
+		case pdfKeyword("beginbfrange"):
+			for {
+				lo, err := lx.value()
+				los, ok := lo.(pdfString)
+				if err != nil || !ok {
+					break
+				}
+				hi, _ := lx.value()
+				his, _ := hi.(pdfString)
+				dst, _ := lx.value()
+				r := cmapRange{lo: codeOf(los), hi: codeOf(his)}
+				if r.hi < r.lo || r.hi-r.lo > 0xFFFF {
+					continue
+				}
+				switch dv := dst.(type) {
+				case pdfString:
+					r.dst = dv
+				case pdfArray:
+					for _, e := range dv {
+						es, _ := e.(pdfString)
+						r.dsts = append(r.dsts, utf16String(es))
+					}
+				}
+				cm.ranges = append(cm.ranges, r)
+			}
+		}
+	}
+	return cm
+}
+
+func (cm *toUnicode) lookup(code uint32) (string, bool) {
+	if s, ok := cm.single[code]; ok {
+		return s, true
+	}
+	for _, r := range cm.ranges {
+		if code < r.lo || code > r.hi {
+			continue
+		}
+		off := code - r.lo
+		if r.dsts != nil {
+			if int(off) < len(r.dsts) {
+				return r.dsts[off], true
+			}
+			return "", false
+		}
+		if len(r.dst) < 2 {
+			return "", false
+		}
+		dst := append([]byte(nil), r.dst...)
+		last := uint32(dst[len(dst)-2])<<8 | uint32(dst[len(dst)-1])
+		last += off
+		dst[len(dst)-2], dst[len(dst)-1] = byte(last>>8), byte(last)
+		return utf16String(dst), true
+	}
+	return "", false
+}
+
+func codeOf(b []byte) uint32 {
+	var c uint32
+	for _, x := range b {
+		c = c<<8 | uint32(x)
+	}
+	return c
+}
+
+func utf16String(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// winAnsiHigh covers the 0x80–0x9F codes where WinAnsiEncoding, used by most
+// simple fonts, differs from Latin-1.
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+	0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+// decode turns a shown string into text.
+func (f *pdfFont) decode(s []byte) string {
+	var sb strings.Builder
+	if f != nil && f.cmap != nil {
+		n := f.cmap.codeLen
+		if n == 0 {
+			n = 1
+			if f.composite {
+				n = 2
+			}
+		}
+		for i := 0; i+n <= len(s); i += n {
+			if t, ok := f.cmap.lookup(codeOf(s[i : i+n])); ok {
+				sb.WriteString(t)
+			} else if n == 1 {
+				sb.WriteRune(latinRune(s[i]))
+			}
+		}
+		return sb.String()
+	}
+	if f != nil && f.composite {
+		// Glyph ids with no mapping to text.
+		return ""
+	}
+	for _, b := range s {
+		sb.WriteRune(latinRune(b))
+	}
+	return sb.String()
+}
+
+func latinRune(b byte) rune {
+	if r, ok := winAnsiHigh[b]; ok {
+		return r
+	}
+	return rune(b)
+}
+
+//
+// 🔹 Content stream interpretation
+//
+
+type pdfExtractor struct {
+	doc   *pdfDoc
+	out   strings.Builder
+	limit int
+	lastY float64
+}
+
+func (e *pdfExtractor) full() bool { return e.out.Len() >= e.limit }
+
+func (e *pdfExtractor) write(s string) {
+	for _, r := range s {
+		if r == 0 || e.full() {
+			continue
+		}
+		e.out.WriteRune(r)
+	}
+}
+
+func (e *pdfExtractor) space() {
+	if s := e.out.String(); s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		e.out.WriteByte(' ')
+	}
+}
+
+func (e *pdfExtractor) newline() {
+	if s := e.out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		e.out.WriteByte('\n')
+	}
+}
+
+// runContent interprets the text operators of a content stream. Form
+// XObjects are followed (to a fixed depth) since some generators put all
+// of a page's text inside one.
+func (e *pdfExtractor) runContent(content []byte, res pdfDict, depth int) {
+	fonts := e.doc.dict(res["Font"])
+	xobjects := e.doc.dict(res["XObject"])
+	var font *pdfFont
+	fontCache := map[pdfName]*pdfFont{}
+
+	lx := &pdfLexer{data: content}
+	var operands []interface{}
+	for !e.full() {
+		v, err := lx.value()
+		if err != nil {
+			return
+		}
+		op, isOp := v.(pdfKeyword)
+		if !isOp {
+			operands = append(operands, v)
+			continue
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					f, cached := fontCache[name]
+					if !cached {
+						f = e.doc.font(fonts[name])
+						fontCache[name] = f
+					}
+					font = f
+				}
+			}
+		case "Tj":
+			if s, ok := last(operands).(pdfString); ok {
+				e.write(font.decode(s))
+			}
+		case "'", "\"":
+			e.newline()
+			if s, ok := last(operands).(pdfString); ok {
+				e.write(font.decode(s))
+			}
+		case "TJ":
+			if arr, ok := last(operands).(pdfArray); ok {
+				for _, item := range arr {
+					switch it := item.(type) {
+					case pdfString:
+						e.write(font.decode(it))
+					case float64:
+						// A large negative kern is a word gap.
+						if it < -200 {
+							e.space()
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, ok := operands[len(operands)-1].(float64); ok && ty != 0 {
+					e.newline()
+				} else {
+					e.space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				if y, ok := operands[5].(float64); ok {
+					if y != e.lastY {
+						e.newline()
+					} else {
+						e.space()
+					}
+					e.lastY = y
+				}
+			}
+		case "T*", "ET":
+			e.newline()
+		case "BI":
+			lx.skipInlineImage()
+		case "Do":
+			if name, ok := last(operands).(pdfName); ok && depth < 8 {
+				ref := xobjects[name]
+				if x := e.doc.dict(ref); x != nil && x["Subtype"] == pdfName("Form") {
+					formRes := res
+					if r := e.doc.dict(x["Resources"]); r != nil {
+						formRes = r
+					}
+					e.runContent(e.doc.streamOf(ref), formRes, depth+1)
+					e.space()
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func last(vs []interface{}) interface{} {
+	if len(vs) == 0 {
+		return nil
+	}
+	return vs[len(vs)-1]
+}
+
+//
+// 🔹 Lexer
+//
+
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+// Structural tokens
+const (
+	tokDictStart  = pdfKeyword("<<")
+	tokDictEnd    = pdfKeyword(">>")
+	tokArrayStart = pdfKeyword("[")
+	tokArrayEnd   = pdfKeyword("]")
+)
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (lx *pdfLexer) skipSpace() {
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		if c == '%' {
+			for lx.pos < len(lx.data) && lx.data[lx.pos] != '\n' && lx.data[lx.pos] != '\r' {
+				lx.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		lx.pos++
+	}
+}
+
+// token returns the next primitive: float64, pdfName, pdfString or
+// pdfKeyword (operators and structural tokens).
+func (lx *pdfLexer) token() (interface{}, error) {
+	lx.skipSpace()
+	if lx.pos >= len(lx.data) {
+		return nil, io.EOF
+	}
+	c := lx.data[lx.pos]
+	switch {
+	case c == '/':
+		lx.pos++
+		start := lx.pos
+		for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelim(lx.data[lx.pos]) {
+			lx.pos++
+		}
+		return pdfName(unescapeName(lx.data[start:lx.pos])), nil
+	case c == '(':
+		return lx.literalString(), nil
+	case c == '<':
+		if lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == '<' {
+			lx.pos += 2
+			return tokDictStart, nil
+		}
+		return lx.hexString(), nil
+	case c == '>':
+		if lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == '>' {
+			lx.pos += 2
+			return tokDictEnd, nil
+		}
+		lx.pos++
+		return pdfKeyword(">"), nil
+	case c == '[' || c == ']' || c == '{' || c == '}' || c == ')':
+		lx.pos++
+		return pdfKeyword(lx.data[lx.pos-1 : lx.pos]), nil
+	}
+
+	start := lx.pos
+	for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelim(lx.data[lx.pos]) {
+		lx.pos++
+	}
+	word := string(lx.data[start:lx.pos])
+	if c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+		if f, err := strconv.ParseFloat(word, 64); err == nil {
+			return f, nil
+		}
+	}
+	return pdfKeyword(word), nil
+}
+
+// value parses one complete object: arrays, dictionaries and "N G R"
+// references are assembled from tokens.
+func (lx *pdfLexer) value() (interface{}, error) {
+	return lx.nested(0)
+}
+
+// nested is value at the given nesting depth. Running out of input closes
+// open arrays and dictionaries; nesting past maxPDFNesting is an error.
+func (lx *pdfLexer) nested(depth int) (interface{}, error) {
+	if depth > maxPDFNesting {
+		return nil, errPDFNesting
+	}
+	tok, err := lx.token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case tokArrayStart:
+		arr := pdfArray{}
+		for {
+			save := lx.pos
+			t, err := lx.token()
+			if err != nil {
+				return arr, nil
+			}
+			if t == tokArrayEnd {
+				return arr, nil
+			}
+			lx.pos = save
+			v, err := lx.nested(depth + 1)
+			if errors.Is(err, errPDFNesting) {
+				return nil, err
+			}
+			if err != nil {
+				return arr, nil
+			}
+			arr = append(arr, v)
+		}
+	case tokDictStart:
+		dict := pdfDict{}
+		for {
+			t, err := lx.token()
+			if err != nil || t == tokDictEnd {
+				return dict, nil
+			}
+			key, ok := t.(pdfName)
+			if !ok {
+				continue
+			}
+			v, err := lx.nested(depth + 1)
+			if errors.Is(err, errPDFNesting) {
+				return nil, err
+			}
+			if err != nil {
+				return dict, nil
+			}
+			dict[key] = v
+		}
+	}
+
+	if n, ok := tok.(float64); ok && n == float64(int(n)) {
+		save := lx.pos
+		if g, err := lx.token(); err == nil {
+			if gen, ok := g.(float64); ok {
+				if r, err := lx.token(); err == nil && r == pdfKeyword("R") {
+					return pdfRef{num: int(n), gen: int(gen)}, nil
+				}
+			}
+		}
+		lx.pos = save
+	}
+	return tok, nil
+}
+
+func (lx *pdfLexer) literalString() pdfString {
+	lx.pos++ // (
+	var out []byte
+	depth := 1
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		lx.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if lx.pos >= len(lx.data) {
+				return out
+			}
+			e := lx.data[lx.pos]
+			lx.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if lx.pos < len(lx.data) && lx.data[lx.pos] == '\n' {
+					lx.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && lx.pos < len(lx.data) && lx.data[lx.pos] >= '0' && lx.data[lx.pos] <= '7'; i++ {
+						v = v*8 + int(lx.data[lx.pos]-'0')
+						lx.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (lx *pdfLexer) hexString() pdfString {
+	lx.pos++ // <
+	var out []byte
+	var hi byte
+	half := false
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		lx.pos++
+		if c == '>' {
+			break
+		}
+		v, ok := hexVal(c)
+		if !ok {
+			continue
+		}
+		if half {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		out = append(out, hi<<4)
+	}
+	return out
+}
+
+func hexVal(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func unescapeName(b []byte) string {
+	if bytes.IndexByte(b, '#') < 0 {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) {
+			h, ok1 := hexVal(b[i+1])
+			l, ok2 := hexVal(b[i+2])
+			if ok1 && ok2 {
+				out = append(out, h<<4|l)
+				i += 2
+				continue
+			}
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+// skipInlineImage moves past the binary data of a BI ... ID ... EI image.
+func (lx *pdfLexer) skipInlineImage() {
+	id := bytes.Index(lx.data[lx.pos:], []byte("ID"))
+	if id < 0 {
+		lx.pos = len(lx.data)
+		return
+	}
+	lx.pos += id + 3
+	for lx.pos+2 <= len(lx.data) {
+		ei := bytes.Index(lx.data[lx.pos:], []byte("EI"))
+		if ei < 0 {
+			break
+		}
+		at := lx.pos + ei
+		before := at == 0 || isPDFSpace(lx.data[at-1])
+		after := at+2 == len(lx.data) || isPDFSpace(lx.data[at+2])
+		lx.pos = at + 2
+		if before && after {
+			return
+		}
+	}
+	lx.pos = len(lx.data)
+}
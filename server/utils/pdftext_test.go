@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// minimalPDF builds a one-page document whose page content is content,
+// drawn with a standard font.
+func minimalPDF(content string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	b.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+	b.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>\nendobj\n")
+	b.WriteString("4 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>\nendobj\n")
+	fmt.Fprintf(&b, "5 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content)
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	pdf := minimalPDF("BT /F1 12 Tf 72 720 Td (Hello world) Tj ET")
+	text, err := ExtractPDFText(pdf, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Hello world" {
+		t.Errorf("text = %q, want %q", text, "Hello world")
+	}
+}
+
+func TestExtractPDFTextDeepNesting(t *testing.T) {
+	deep := 8 << 20
+	tests := map[string][]byte{
+		"array object":  []byte("%PDF-1.4\n1 0 obj\n" + strings.Repeat("[", deep)),
+		"dict object":   []byte("%PDF-1.4\n1 0 obj\n" + strings.Repeat("<< /A ", deep/6)),
+		"array content": minimalPDF("BT /F1 12 Tf (kept) Tj ET " + strings.Repeat("[", deep)),
+		"mixed":         []byte("%PDF-1.4\n1 0 obj\n" + strings.Repeat("[<< /K ", deep/8)),
+	}
+	for name, pdf := range tests {
+		t.Run(name, func(t *testing.T) {
+			// A stack overflow here kills the test binary rather than failing
+			_, err := ExtractPDFText(pdf, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// Content before the hostile part is still extracted
+	text, _ := ExtractPDFText(tests["array content"], 1<<20)
+	if text != "kept" {
+		t.Errorf("text = %q, want %q", text, "kept")
+	}
+}
+
+func TestPDFLexerNestingLimit(t *testing.T) {
+	ok := strings.Repeat("[", maxPDFNesting) + strings.Repeat("]", maxPDFNesting)
+	lx := &pdfLexer{data: []byte(ok)}
+	if _, err := lx.value(); err != nil {
+		t.Errorf("%d levels: %v", maxPDFNesting, err)
+	}
+
+	tooDeep := strings.Repeat("[", maxPDFNesting+2)
+	lx = &pdfLexer{data: []byte(tooDeep)}
+	if _, err := lx.value(); err != errPDFNesting {
+		t.Errorf("%d levels: err = %v, want errPDFNesting", maxPDFNesting+2, err)
+	}
+}
+
+func TestExtractPDFTextTruncated(t *testing.T) {
+	pdf := minimalPDF("BT /F1 12 Tf 72 720 Td (Hello world) Tj ET")
+	for n := 0; n <= len(pdf); n++ {
+		// Must neither panic nor hang, whatever the cut
+		_, _ = ExtractPDFText(pdf[:n], 1<<20)
+	}
+}
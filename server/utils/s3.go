@@ -2,9 +2,19 @@ package utils
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
-	"log"
-	"os"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"server/config"
+	"server/metrics"
+	"server/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -16,44 +26,41 @@ var (
 	bucketName string
 )
 
-// InitAWS initializes the AWS session after env vars are loaded
-func InitAWS() {
-	bucketName = os.Getenv("S3_BUCKET")
-	region := os.Getenv("AWS_REGION")
-
-	if bucketName == "" || region == "" {
-		log.Fatalf("❌ Missing AWS env vars: S3_BUCKET=%s AWS_REGION=%s", bucketName, region)
-	}
+// InitAWS initializes the AWS session for the configured bucket
+func InitAWS(c config.Storage) {
+	bucketName = c.Bucket
 
 	sess = session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(region),
+		Region: aws.String(c.Region),
 	}))
 
-	log.Printf("✅ AWS initialized: bucket=%s, region=%s", bucketName, region)
+	slog.Info("AWS initialized", "bucket", bucketName, "region", c.Region)
 }
 
 // UploadToS3 uploads a file stream to S3 and updates DB stats
-func UploadToS3(file io.Reader, key string) error {
+func UploadToS3(ctx context.Context, file io.Reader, key string) (err error) {
 	svc := s3.New(sess)
 
 	buf := new(bytes.Buffer)
-	_, err := io.Copy(buf, file)
+	_, err = io.Copy(buf, file)
 	if err != nil {
 		return err
 	}
 
+	defer observeS3(ctx, "PutObject", key)(&err)
 	_, err = svc.PutObject(&s3.PutObjectInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(key),
 		Body:   bytes.NewReader(buf.Bytes()),
 	})
 
-	return nil
+	return err
 }
 
 // ListFiles lists all objects for a given prefix (e.g. "username/")
-func ListFiles(prefix string) ([]map[string]interface{}, error) {
+func ListFiles(ctx context.Context, prefix string) (_ []map[string]interface{}, err error) {
 	svc := s3.New(sess)
+	defer observeS3(ctx, "ListObjectsV2", prefix)(&err)
 	resp, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{
 		Bucket: aws.String(bucketName),
 		Prefix: aws.String(prefix),
@@ -74,11 +81,27 @@ func ListFiles(prefix string) ([]map[string]interface{}, error) {
 }
 
 // DownloadFromS3 downloads a file by key and updates DB stats
-func DownloadFromS3(key string) (io.ReadCloser, error) {
+func DownloadFromS3(ctx context.Context, key string) (_ io.ReadCloser, err error) {
+	svc := s3.New(sess)
+	defer observeS3(ctx, "GetObject", key)(&err)
+	resp, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// DownloadRangeFromS3 downloads bytes [start, end] (inclusive) of an object
+func DownloadRangeFromS3(ctx context.Context, key string, start, end int64) (_ io.ReadCloser, err error) {
 	svc := s3.New(sess)
+	defer observeS3(ctx, "GetObject", key)(&err)
 	resp, err := svc.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
 	})
 	if err != nil {
 		return nil, err
@@ -86,10 +109,27 @@ func DownloadFromS3(key string) (io.ReadCloser, error) {
 	return resp.Body, nil
 }
 
+// MoveInS3 moves an object to a new key within the bucket
+func MoveInS3(ctx context.Context, srcKey, dstKey string) error {
+	svc := s3.New(sess)
+	done := observeS3(ctx, "CopyObject", dstKey)
+	_, err := svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(bucketName),
+		CopySource: aws.String((&url.URL{Path: bucketName + "/" + srcKey}).EscapedPath()),
+		Key:        aws.String(dstKey),
+	})
+	done(&err)
+	if err != nil {
+		return err
+	}
+	return DeleteFromS3(ctx, srcKey)
+}
+
 // DeleteFromS3 deletes a file by key and updates DB stats
-func DeleteFromS3(key string) error {
+func DeleteFromS3(ctx context.Context, key string) (err error) {
 	svc := s3.New(sess)
-	_, err := svc.DeleteObject(&s3.DeleteObjectInput{
+	defer observeS3(ctx, "DeleteObject", key)(&err)
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(key),
 	})
@@ -99,3 +139,37 @@ func DeleteFromS3(key string) error {
 
 	return nil
 }
+
+// PingS3 checks that the bucket exists and the credentials can reach it
+func PingS3(ctx context.Context) (err error) {
+	svc := s3.New(sess)
+	defer observeS3(ctx, "HeadBucket", "")(&err)
+	_, err = svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	return err
+}
+
+// observeS3 starts a client span for one S3 call. The returned func ends it
+// and records the call's latency and outcome in metrics.
+//
+// ctx only parents the span. The transfer calls are not bound to it,
+// because a download's body keeps streaming long after the caller's open
+// timeout.
+func observeS3(ctx context.Context, operation, key string) func(*error) {
+	start := time.Now()
+	_, span := tracing.Tracer.Start(ctx, "S3 "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "aws-api"),
+			attribute.String("rpc.service", "S3"),
+			attribute.String("rpc.method", operation),
+			attribute.String("aws.s3.bucket", bucketName),
+			attribute.String("aws.s3.key", key),
+		),
+	)
+	return func(err *error) {
+		metrics.ObserveS3(operation, start, err)
+		tracing.End(span, *err)
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+)
+
+// magicSignature is a leading byte pattern http.DetectContentType does not
+// know about.
+type magicSignature struct {
+	offset int
+	magic  []byte
+	mime   string
+}
+
+var extraSignatures = []magicSignature{
+	{0, []byte("MZ"), "application/x-msdownload"},
+	{0, []byte("\x7fELF"), "application/x-executable"},
+	{0, []byte("\xfe\xed\xfa\xce"), "application/x-mach-binary"},
+	{0, []byte("\xfe\xed\xfa\xcf"), "application/x-mach-binary"},
+	{0, []byte("\xce\xfa\xed\xfe"), "application/x-mach-binary"},
+	{0, []byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{0, []byte("\x1f\x8b"), "application/gzip"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte("\xfd7zXZ\x00"), "application/x-xz"},
+	{4, []byte("ftypheic"), "image/heic"},
+	{4, []byte("ftypheix"), "image/heic"},
+	{4, []byte("ftypavif"), "image/avif"},
+	{4, []byte("ftypqt  "), "video/quicktime"},
+	{0, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), "application/x-ole-storage"},
+}
+
+// DetectMIME determines a file's media type from its content (magic bytes),
+// ignoring whatever the client claimed. It returns a bare media type without
+// parameters; application/octet-stream means "unknown binary".
+func DetectMIME(data []byte) string {
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+
+	for _, sig := range extraSignatures {
+		if len(head) >= sig.offset+len(sig.magic) && bytes.Equal(head[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.mime
+		}
+	}
+
+	detected, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+
+	// DetectContentType reports SVG as XML or plain text.
+	if (detected == "text/xml" || detected == "text/plain") && bytes.Contains(bytes.ToLower(head), []byte("<svg")) {
+		return "image/svg+xml"
+	}
+	return detected
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+)
+
+// MaxImagePixels bounds the images DecodeImage accepts. The header is
+// checked before decoding, so a small file claiming huge dimensions (a
+// decompression bomb) is rejected without allocating its pixels.
+const MaxImagePixels = 40_000_000
+
+// DecodeImage decodes a JPEG, PNG or GIF (first frame) into premultiplied
+// RGBA and reports the format name ("jpeg", "png", "gif").
+func DecodeImage(data []byte) (*image.RGBA, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxImagePixels {
+		return nil, "", fmt.Errorf("image dimensions %dx%d not supported", cfg.Width, cfg.Height)
+	}
+
+	var img image.Image
+	switch format {
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+	default:
+		return nil, "", fmt.Errorf("unsupported image format %q", format)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba, format, nil
+}
+
+// ResizeToFit scales src down so neither side exceeds maxSide, keeping the
+// aspect ratio. Images already small enough are returned as is; thumbnails
+// never upscale.
+//
+// Each destination pixel is the area-weighted average of the source pixels
+// it covers (a box filter with fractional edges), applied separably. That is
+// exact for downscaling and avoids the aliasing of nearest-neighbour.
+// Averaging happens on premultiplied values so transparent pixels do not
+// bleed their colour into edges.
+func ResizeToFit(src *image.RGBA, maxSide int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= maxSide && sh <= maxSide {
+		return src
+	}
+	scale := float64(maxSide) / float64(max(sw, sh))
+	dw := max(1, int(math.Round(float64(sw)*scale)))
+	dh := max(1, int(math.Round(float64(sh)*scale)))
+
+	xw := boxWeights(sw, dw)
+	yw := boxWeights(sh, dh)
+
+	// Horizontal pass: sw x sh → dw x sh
+	tmp := make([]float32, dw*sh*4)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[y*src.Stride:]
+		out := tmp[y*dw*4:]
+		for x, cs := range xw {
+			var r, g, b, a float32
+			for _, c := range cs {
+				p := row[c.idx*4:]
+				r += float32(p[0]) * c.w
+				g += float32(p[1]) * c.w
+				b += float32(p[2]) * c.w
+				a += float32(p[3]) * c.w
+			}
+			o := out[x*4:]
+			o[0], o[1], o[2], o[3] = r, g, b, a
+		}
+	}
+
+	// Vertical pass: dw x sh → dw x dh
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y, cs := range yw {
+		out := dst.Pix[y*dst.Stride:]
+		for x := 0; x < dw; x++ {
+			var r, g, b, a float32
+			for _, c := range cs {
+				p := tmp[(c.idx*dw+x)*4:]
+				r += p[0] * c.w
+				g += p[1] * c.w
+				b += p[2] * c.w
+				a += p[3] * c.w
+			}
+			o := out[x*4:]
+			o[0], o[1], o[2], o[3] = clamp8(r), clamp8(g), clamp8(b), clamp8(a)
+		}
+	}
+	return dst
+}
+
+type contribution struct {
+	idx int
+	w   float32
+}
+
+// boxWeights maps each of dstLen output samples to the input samples whose
+// span it covers, weighted by overlap; each sample's weights sum to 1.
+func boxWeights(srcLen, dstLen int) [][]contribution {
+	scale := float64(srcLen) / float64(dstLen)
+	out := make([][]contribution, dstLen)
+	for i := range out {
+		lo, hi := float64(i)*scale, float64(i+1)*scale
+		var cs []contribution
+		for j := int(lo); j < srcLen && float64(j) < hi; j++ {
+			overlap := math.Min(hi, float64(j+1)) - math.Max(lo, float64(j))
+			if overlap > 0 {
+				cs = append(cs, contribution{idx: j, w: float32(overlap / scale)})
+			}
+		}
+		out[i] = cs
+	}
+	return out
+}
+
+func clamp8(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
+
+// EncodeThumbnail encodes img as JPEG when the source was a JPEG and as PNG
+// otherwise, so transparency in PNGs and GIFs survives. It returns the
+// encoded bytes, their media type and file extension.
+func EncodeThumbnail(img *image.RGBA, sourceFormat string) ([]byte, string, string, error) {
+	var buf bytes.Buffer
+	if sourceFormat == "jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 82}); err != nil {
+			return nil, "", "", err
+		}
+		return buf.Bytes(), "image/jpeg", "jpg", nil
+	}
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, "", "", err
+	}
+	return buf.Bytes(), "image/png", "png", nil
+}